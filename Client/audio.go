@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/binary"
+	"math"
+
+	"github.com/hajimehoshi/ebiten/v2/audio"
+)
+
+// 効果音
+//
+// 音声ファイルは持たず、起動時に短い音をPCMで合成しておく。音量は設定の Volume に従う
+
+// sampleRate 効果音のサンプリングレート
+const sampleRate = 44100
+
+type sound int
+
+const (
+	// soundSelect メニューのカーソルを動かした
+	soundSelect sound = iota
+	// soundConfirm メニューの項目を決定した
+	soundConfirm
+	// soundDeath アウトになった
+	soundDeath
+	numSounds
+)
+
+// tone 効果音1つ分の音の高さと長さ。from から to まで周波数を滑らかに変える
+type tone struct {
+	from, to float64
+	seconds  float64
+}
+
+var tones = [numSounds]tone{
+	soundSelect:  {from: 660, to: 660, seconds: 0.04},
+	soundConfirm: {from: 660, to: 990, seconds: 0.08},
+	soundDeath:   {from: 440, to: 110, seconds: 0.35},
+}
+
+// sfx 効果音を鳴らす。main で作る
+var sfx *audioPlayer
+
+type audioPlayer struct {
+	players [numSounds]*audio.Player
+	volume  float64
+}
+
+func newAudioPlayer(volume float64) *audioPlayer {
+	ctx := audio.NewContext(sampleRate)
+	a := &audioPlayer{volume: volume}
+	for s, t := range tones {
+		a.players[s] = ctx.NewPlayerFromBytes(synthesize(t))
+	}
+	return a
+}
+
+// setVolume 音量(0〜1)を変える。次に鳴らす音から反映される
+func (a *audioPlayer) setVolume(v float64) {
+	if a != nil {
+		a.volume = v
+	}
+}
+
+// play 効果音を最初から鳴らす。音量が0なら鳴らさない
+func (a *audioPlayer) play(s sound) {
+	if a == nil || a.volume <= 0 {
+		return
+	}
+	p := a.players[s]
+	p.SetVolume(a.volume)
+	p.Rewind()
+	p.Play()
+}
+
+// synthesize 矩形波を、鳴り始めと終わりでぷつっと鳴らないよう減衰させた 16bit ステレオのPCMにする
+func synthesize(t tone) []byte {
+	n := int(t.seconds * sampleRate)
+	buf := make([]byte, n*4)
+	phase := 0.0
+	for i := 0; i < n; i++ {
+		progress := float64(i) / float64(n)
+		freq := t.from + (t.to-t.from)*progress
+		phase += freq / sampleRate
+		v := 0.25
+		if phase-math.Floor(phase) >= 0.5 {
+			v = -v
+		}
+		// 最初の数msで立ち上げ、あとは直線的に消える
+		v *= math.Min(float64(i)/(sampleRate*0.005), 1) * (1 - progress)
+		sample := uint16(int16(v * math.MaxInt16))
+		binary.LittleEndian.PutUint16(buf[i*4:], sample)
+		binary.LittleEndian.PutUint16(buf[i*4+2:], sample)
+	}
+	return buf
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/eiei114/dinosaur-jump/protocol"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+)
+
+// captureTimeout 割り当て直すときに、これだけ何も押されなければ取り消す
+const captureTimeout = 5 * time.Second
+
+// controlsScene 操作ごとの割り当てを変える画面
+// 決定してからキーを押すとキーの割り当てを、ボタンを押すとボタンの割り当てを、スティックを倒すとスティックの割り当てを置き換える
+type controlsScene struct {
+	overlayScene
+	g    *Game
+	menu menu
+
+	// capturing 0以上なら、次に押されたものをこの操作に割り当てる
+	capturing  action
+	captureEnd time.Time
+}
+
+func newControlsScene(g *Game) *controlsScene {
+	s := &controlsScene{g: g, capturing: -1}
+	s.refresh()
+	return s
+}
+
+// refresh 項目の表示を今の割り当てに合わせる。最後の2つは初期化と戻る
+func (s *controlsScene) refresh() {
+	s.menu.items = s.menu.items[:0]
+	for a := action(0); a < actionCount; a++ {
+		bound := s.g.settings.Bindings[a].String()
+		if a == s.capturing {
+			bound = tr("controls.capturing", int(time.Until(s.captureEnd).Seconds())+1)
+		}
+		label := []rune(fmt.Sprintf("%-11s%s", a.label(), bound))
+		if len(label) > optionLabelLength {
+			label = append(label[:optionLabelLength-3], []rune("...")...)
+		}
+		s.menu.items = append(s.menu.items, string(label))
+	}
+	s.menu.items = append(s.menu.items, tr("controls.reset"), tr("menu.back"))
+}
+
+func (s *controlsScene) Update() error {
+	g := s.g
+	if !g.pollReconnect() && g.online != nil {
+		g.updateOnline(protocol.Input{})
+	}
+	if g.scenes.Current() != s {
+		return nil
+	}
+	defer s.refresh()
+
+	if s.capturing >= 0 {
+		s.updateCapture()
+		return nil
+	}
+
+	if g.input.justPressed(actionCancel) {
+		g.scenes.Pop()
+		return nil
+	}
+	// 決定と取り消しは消すとこの画面から戻れなくなるので、割り当て直すことしかできない
+	if inpututil.IsKeyJustPressed(ebiten.KeyDelete) && s.menu.cursor < int(actionCount) && !action(s.menu.cursor).required() {
+		a := action(s.menu.cursor)
+		g.changeSettings(func(st *settings) { st.Bindings[a] = binding{} })
+		return nil
+	}
+	switch i := s.menu.update(&g.input); {
+	case i < 0:
+	case i < int(actionCount):
+		s.capturing = action(i)
+		s.captureEnd = time.Now().Add(captureTimeout)
+	case i == int(actionCount):
+		def := defaultBindings()
+		g.changeSettings(func(st *settings) {
+			for a, b := range def {
+				st.Bindings[a] = b
+			}
+		})
+	default:
+		g.scenes.Pop()
+	}
+	return nil
+}
+
+// updateCapture 押されたものを割り当てる。同じ種類の割り当て(キーならキー)はすべて置き換える
+func (s *controlsScene) updateCapture() {
+	a := s.capturing
+	if time.Now().After(s.captureEnd) {
+		s.capturing = -1
+		return
+	}
+	c, ok := captureInput()
+	if !ok {
+		return
+	}
+	s.capturing = -1
+
+	b := s.g.settings.Bindings[a]
+	switch {
+	case c.key != nil:
+		b.Keys = []key{*c.key}
+	case c.button != nil:
+		b.Buttons = []padButton{*c.button}
+	case c.stick != nil:
+		b.Sticks = []stick{*c.stick}
+	}
+	s.g.changeSettings(func(st *settings) { st.Bindings[a] = b })
+	s.g.input.resync(s.g.settings.Bindings, s.g.settings.DeadZone)
+}
+
+func (s *controlsScene) Draw(screen *ebiten.Image) {
+	note := tr("controls.note")
+	if s.capturing >= 0 {
+		note = tr("controls.captureNote")
+	}
+	s.menu.draw(screen, tr("controls.title"), note)
+}
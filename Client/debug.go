@@ -0,0 +1,262 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+
+	"github.com/eiei114/dinosaur-jump/protocol"
+	"github.com/eiei114/dinosaur-jump/protocol/sim"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"github.com/hajimehoshi/ebiten/v2/text"
+)
+
+// デバッグ表示
+//
+// 当たり判定のバグを追うためのもの。F4 か -debug で出し、出している間だけ次のキーが効く。
+//   F5 自由カメラ。右ドラッグで動かし、ホイールで拡大・縮小する
+//   F6 コマ送り。ゲームを止め、F7 で1フレームずつ進める(押し続けると連続で進む)。オフラインのときだけ
+// キーは割り当てを変えられる操作にはせず、直接読む
+
+const (
+	debugMinZoom = 0.25
+	debugMaxZoom = 8
+	// debugArrowScale NPCの動いた向きの矢印を、1フレームで動いた距離の何倍の長さで描くか
+	debugArrowScale = 6
+)
+
+var (
+	debugHitboxColor = color.RGBA{0x00, 0xa0, 0xff, 0xff}
+	debugHitColor    = color.RGBA{0xff, 0x20, 0x20, 0xff}
+	debugWallColor   = color.RGBA{0xff, 0x90, 0x00, 0xff}
+	debugArrowColor  = color.RGBA{0x20, 0xc0, 0x20, 0xff}
+	debugMaskColor   = color.RGBA{0x00, 0x50, 0x80, 0x50}
+	debugOutside     = color.RGBA{0x60, 0x60, 0x60, 0xff}
+)
+
+// debugOverlay デバッグ表示の状態
+type debugOverlay struct {
+	enabled bool
+
+	// free 自由カメラ。camX, camY は画面の左上に映る世界の座標
+	free       bool
+	camX, camY float64
+	zoom       float64
+	// dragX, dragY 前のフレームでのカーソルの位置。右ボタンを押していなければ dragging はfalse
+	dragX, dragY int
+	dragging     bool
+	// world 自由カメラのときに世界を描いておく画像
+	world *ebiten.Image
+
+	// stepping trueの間はゲームを止めてコマ送りする
+	stepping bool
+
+	// npcPrev npcMove 前のフレームのNPCの位置と、そこから動いた量
+	// NPCは目標に向かわずにランダムに動くので、向かっている先の代わりに動いた向きを描く
+	npcPrev []protocol.Position
+	npcMove []protocol.Position
+
+	// maskImages Mask を半透明で描いた画像
+	maskImages map[*sim.Mask]*ebiten.Image
+}
+
+// update デバッグ用のキーとカメラの操作を読む。このフレームでゲームを進めるならtrue
+func (d *debugOverlay) update(g *Game) bool {
+	if inpututil.IsKeyJustPressed(ebiten.KeyF4) {
+		d.enabled = !d.enabled
+	}
+	if !d.enabled {
+		d.free, d.stepping = false, false
+		return true
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyF5) {
+		d.free = !d.free
+		d.camX, d.camY, d.zoom = 0, 0, 1
+	}
+	if d.free {
+		d.updateCamera()
+	}
+	// オンラインでは止めている間にサーバーからのメッセージがあふれるので、コマ送りしない
+	if g.online != nil {
+		d.stepping = false
+		return true
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyF6) {
+		d.stepping = !d.stepping
+	}
+	return !d.stepping || repeatingKeyPressed(ebiten.KeyF7)
+}
+
+// updateCamera 右ドラッグで動かし、ホイールでカーソルの位置を中心に拡大・縮小する
+func (d *debugOverlay) updateCamera() {
+	x, y := ebiten.CursorPosition()
+	if ebiten.IsMouseButtonPressed(ebiten.MouseButtonRight) {
+		if d.dragging {
+			d.camX -= float64(x-d.dragX) / d.zoom
+			d.camY -= float64(y-d.dragY) / d.zoom
+		}
+		d.dragX, d.dragY, d.dragging = x, y, true
+	} else {
+		d.dragging = false
+	}
+
+	_, wheel := ebiten.Wheel()
+	if wheel == 0 {
+		return
+	}
+	zoom := math.Min(math.Max(d.zoom*math.Pow(1.1, wheel), debugMinZoom), debugMaxZoom)
+	// カーソルの下にある世界の点が動かないようにする
+	wx, wy := d.camX+float64(x)/d.zoom, d.camY+float64(y)/d.zoom
+	d.camX, d.camY, d.zoom = wx-float64(x)/zoom, wy-float64(y)/zoom, zoom
+}
+
+// track NPCが前のフレームから動いた量を覚える。ゲームを進めたフレームだけ呼ぶ
+func (d *debugOverlay) track(npcs []PlayerInfo) {
+	if len(d.npcPrev) != len(npcs) {
+		// NPCが入れ替わった(オンラインになったなど)ので測り直す
+		d.npcPrev = d.npcPrev[:0]
+		for _, npc := range npcs {
+			d.npcPrev = append(d.npcPrev, npc.pos())
+		}
+	}
+	d.npcMove = d.npcMove[:0]
+	for i, npc := range npcs {
+		pos := npc.pos()
+		d.npcMove = append(d.npcMove, protocol.Position{X: pos.X - d.npcPrev[i].X, Y: pos.Y - d.npcPrev[i].Y})
+		d.npcPrev[i] = pos
+	}
+}
+
+// worldTarget 世界を描く先。自由カメラのときは world に描き、present で画面に移す
+func (d *debugOverlay) worldTarget(screen *ebiten.Image) *ebiten.Image {
+	if !d.free {
+		return screen
+	}
+	if d.world == nil {
+		d.world = ebiten.NewImage(screenX, screenY)
+	}
+	d.world.Fill(color.White)
+	return d.world
+}
+
+// present 自由カメラのとき、world をカメラの位置と倍率で画面に描く
+func (d *debugOverlay) present(screen *ebiten.Image) {
+	if !d.free {
+		return
+	}
+	screen.Fill(debugOutside)
+	op := &ebiten.DrawImageOptions{}
+	op.GeoM.Translate(-d.camX, -d.camY)
+	op.GeoM.Scale(d.zoom, d.zoom)
+	screen.DrawImage(d.world, op)
+}
+
+// drawHitboxes 当たり判定の形とNPCの動いた向きを世界の座標で描く。自分とぶつかっているものは赤くする
+func (g *Game) drawHitboxes(dst *ebiten.Image) {
+	d := &g.debug
+	me := g.myCollider()
+	hit := false
+	for _, c := range g.obstacles() {
+		clr := debugHitboxColor
+		if c.Cause == protocol.CauseWall {
+			clr = debugWallColor
+		}
+		if sim.Overlap(me.Shape, me.Pos, c.Shape, c.Pos) {
+			clr, hit = debugHitColor, true
+		}
+		d.drawShape(dst, c.Shape, c.Pos, clr)
+	}
+	clr := debugHitboxColor
+	if hit {
+		clr = debugHitColor
+	}
+	d.drawShape(dst, me.Shape, me.Pos, clr)
+
+	for i, npc := range g.npcs {
+		if i >= len(d.npcMove) {
+			break
+		}
+		m := d.npcMove[i]
+		cx, cy := float64(npc.x)+sim.PlayerWidth/2, float64(npc.y)+sim.PlayerHeight/2
+		tx, ty := cx+m.X*debugArrowScale, cy+m.Y*debugArrowScale
+		ebitenutil.DrawLine(dst, cx, cy, tx, ty, debugArrowColor)
+		ebitenutil.DrawRect(dst, tx-2, ty-2, 4, 4, debugArrowColor)
+	}
+}
+
+// drawShape 形の輪郭を描く。Mask は当たる部分を半透明で塗り、囲む矩形を描く
+func (d *debugOverlay) drawShape(dst *ebiten.Image, shape sim.Shape, pos protocol.Position, clr color.Color) {
+	b := shape.Bounds(pos)
+	switch s := shape.(type) {
+	case *sim.Mask:
+		op := &ebiten.DrawImageOptions{}
+		op.GeoM.Translate(pos.X, pos.Y)
+		dst.DrawImage(d.maskImage(s), op)
+		drawRectOutline(dst, b, clr)
+	case sim.Circle:
+		const segments = 24
+		cx, cy := pos.X+s.X, pos.Y+s.Y
+		for i := 0; i < segments; i++ {
+			a1 := 2 * math.Pi * float64(i) / segments
+			a2 := 2 * math.Pi * float64(i+1) / segments
+			ebitenutil.DrawLine(dst, cx+s.R*math.Cos(a1), cy+s.R*math.Sin(a1), cx+s.R*math.Cos(a2), cy+s.R*math.Sin(a2), clr)
+		}
+	default:
+		drawRectOutline(dst, b, clr)
+	}
+}
+
+func (d *debugOverlay) maskImage(m *sim.Mask) *ebiten.Image {
+	if img, ok := d.maskImages[m]; ok {
+		return img
+	}
+	img := ebiten.NewImage(m.W, m.H)
+	for y := 0; y < m.H; y++ {
+		for x := 0; x < m.W; x++ {
+			if m.Solid(x, y) {
+				img.Set(x, y, debugMaskColor)
+			}
+		}
+	}
+	if d.maskImages == nil {
+		d.maskImages = make(map[*sim.Mask]*ebiten.Image)
+	}
+	d.maskImages[m] = img
+	return img
+}
+
+func drawRectOutline(dst *ebiten.Image, r sim.Rect, clr color.Color) {
+	ebitenutil.DrawLine(dst, r.X1, r.Y1, r.X2, r.Y1, clr)
+	ebitenutil.DrawLine(dst, r.X2, r.Y1, r.X2, r.Y2, clr)
+	ebitenutil.DrawLine(dst, r.X2, r.Y2, r.X1, r.Y2, clr)
+	ebitenutil.DrawLine(dst, r.X1, r.Y2, r.X1, r.Y1, clr)
+}
+
+// drawDebugStats FPS・TPS・NPCの速さの倍率・通信の状況を左下に表示する
+func (g *Game) drawDebugStats(screen *ebiten.Image) {
+	d := &g.debug
+	lines := []string{
+		fmt.Sprintf("FPS %.1f TPS %.1f", ebiten.CurrentFPS(), ebiten.CurrentTPS()),
+		fmt.Sprintf("speed x%.3f", g.speedMultiplier),
+	}
+	if g.online != nil && g.interp != nil {
+		st := g.interp.stats()
+		lines = append(lines,
+			fmt.Sprintf("rtt %dms pending %d", g.pred.rtt.Milliseconds(), len(g.pred.pending)),
+			fmt.Sprintf("buffer min %d max %d", st.minDepth, st.maxDepth),
+		)
+	} else {
+		lines = append(lines, "offline")
+	}
+	if d.free {
+		lines = append(lines, fmt.Sprintf("camera %.0f,%.0f x%.2f", d.camX, d.camY, d.zoom))
+	}
+	if d.stepping {
+		lines = append(lines, "STEP (F7)")
+	}
+	for i, line := range lines {
+		text.Draw(screen, line, arcadeFont, 10, screenY-10-(len(lines)-1-i)*14, color.Black)
+	}
+}
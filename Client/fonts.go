@@ -0,0 +1,101 @@
+package main
+
+import (
+	"image"
+	"log"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+const fontDPI = 72
+
+// newFace size の大きさのフォントを作る
+func newFace(f *sfnt.Font, size float64) font.Face {
+	face, err := opentype.NewFace(f, &opentype.FaceOptions{
+		Size:    size,
+		DPI:     fontDPI,
+		Hinting: font.HintingFull,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	return face
+}
+
+// fontLayer fallbackFace に重ねる1つのフォント
+type fontLayer struct {
+	font *sfnt.Font
+	size float64
+}
+
+// fallbackFace 文字ごとに、その文字を持っている一番手前のフォントで描く
+// PressStart2P には日本語がないので、アーケード風の見た目のまま日本語だけ後ろのフォントで描ける
+type fallbackFace struct {
+	fonts []*sfnt.Font
+	faces []font.Face
+	buf   sfnt.Buffer
+}
+
+func newFallbackFace(layers ...fontLayer) *fallbackFace {
+	f := &fallbackFace{}
+	for _, l := range layers {
+		f.fonts = append(f.fonts, l.font)
+		f.faces = append(f.faces, newFace(l.font, l.size))
+	}
+	return f
+}
+
+// pick r を持っているフォント。どれも持っていなければ先頭のフォントで豆腐を描く
+func (f *fallbackFace) pick(r rune) font.Face {
+	for i, sf := range f.fonts {
+		if idx, err := sf.GlyphIndex(&f.buf, r); err == nil && idx != 0 {
+			return f.faces[i]
+		}
+	}
+	return f.faces[0]
+}
+
+func (f *fallbackFace) Close() error {
+	for _, face := range f.faces {
+		if err := face.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *fallbackFace) Glyph(dot fixed.Point26_6, r rune) (image.Rectangle, image.Image, image.Point, fixed.Int26_6, bool) {
+	return f.pick(r).Glyph(dot, r)
+}
+
+func (f *fallbackFace) GlyphBounds(r rune) (fixed.Rectangle26_6, fixed.Int26_6, bool) {
+	return f.pick(r).GlyphBounds(r)
+}
+
+func (f *fallbackFace) GlyphAdvance(r rune) (fixed.Int26_6, bool) {
+	return f.pick(r).GlyphAdvance(r)
+}
+
+// Kern 違うフォントの文字の間は詰めない
+func (f *fallbackFace) Kern(r0, r1 rune) fixed.Int26_6 {
+	face := f.pick(r0)
+	if face != f.pick(r1) {
+		return 0
+	}
+	return face.Kern(r0, r1)
+}
+
+// Metrics 行が重ならないよう、すべてのフォントの大きい方に合わせる
+func (f *fallbackFace) Metrics() font.Metrics {
+	m := f.faces[0].Metrics()
+	for _, face := range f.faces[1:] {
+		fm := face.Metrics()
+		m.Height = max(m.Height, fm.Height)
+		m.Ascent = max(m.Ascent, fm.Ascent)
+		m.Descent = max(m.Descent, fm.Descent)
+	}
+	return m
+}
@@ -1,19 +1,30 @@
 module github.com/hokita/jump
 
-go 1.17
+go 1.21rc2
 
 require (
 	github.com/hajimehoshi/ebiten/v2 v2.2.3
 	golang.org/x/image v0.0.0-20210628002857-a66eb6448b8d
-	golang.org/x/net v0.0.0-20210805182204-aaa1db679c0d
 )
 
 require (
+	github.com/apapsch/go-jsonmerge/v2 v2.0.0 // indirect
 	github.com/go-gl/glfw/v3.3/glfw v0.0.0-20210727001814-0db043d8d5be // indirect
+	github.com/google/uuid v1.5.0 // indirect
+	github.com/hajimehoshi/oto/v2 v2.1.0-alpha.2 // indirect
 	github.com/jezek/xgb v0.0.0-20210312150743-0e0f116e1240 // indirect
+	github.com/oapi-codegen/runtime v1.1.1 // indirect
 	golang.org/x/exp v0.0.0-20190731235908-ec7cb31e5a56 // indirect
 	golang.org/x/mobile v0.0.0-20210902104108-5d9a33257ab5 // indirect
 	golang.org/x/sync v0.0.0-20210220032951-036812b2e83c // indirect
-	golang.org/x/sys v0.0.0-20210917161153-d61c044b1678 // indirect
-	golang.org/x/text v0.3.6 // indirect
 )
+
+require (
+	github.com/atotto/clipboard v0.1.4
+	github.com/eiei114/dinosaur-jump/protocol v0.0.0
+	golang.org/x/net v0.19.0
+	golang.org/x/sys v0.15.0
+	golang.org/x/text v0.15.0
+)
+
+replace github.com/eiei114/dinosaur-jump/protocol => ../protocol
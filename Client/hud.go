@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"time"
+
+	"github.com/eiei114/dinosaur-jump/protocol"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"github.com/hajimehoshi/ebiten/v2/text"
+)
+
+const (
+	// hudRows 部屋内ランキングに表示する人数。自分が入っていなければ最後の行に自分を出す
+	hudRows       = 5
+	hudWidth      = 190
+	hudLineHeight = 14
+	hudMargin     = 8
+)
+
+var (
+	hudBackground = color.RGBA{0xff, 0xff, 0xff, 0xc8}
+	hudHighlight  = color.RGBA{0x00, 0x66, 0xcc, 0xff}
+	hudDead       = color.RGBA{0x99, 0x99, 0x99, 0xff}
+)
+
+// setRoomRanking サーバーから届いた部屋内ランキングを反映する
+func (g *Game) setRoomRanking(r *protocol.Ranking) {
+	g.roomRanking = r.Entries
+	g.roomRankingAt = time.Now()
+}
+
+// drawHUD 右上に今回の生存時間と、オンラインなら部屋内ランキングを表示する
+func (g *Game) drawHUD(screen *ebiten.Image) {
+	rows := g.hudRows()
+	x := float64(screenX - hudWidth - hudMargin)
+	ebitenutil.DrawRect(screen, x, hudMargin, hudWidth, float64((len(rows)+1)*hudLineHeight+hudMargin), hudBackground)
+
+	tx, ty := int(x)+hudMargin, hudMargin+hudLineHeight
+	text.Draw(screen, tr("hud.score", g.timePassed), arcadeFont, tx, ty, color.Black)
+	for _, row := range rows {
+		ty += hudLineHeight
+		clr := color.Color(color.Black)
+		switch {
+		case row.mine:
+			clr = hudHighlight
+		case !row.alive:
+			clr = hudDead
+		}
+		text.Draw(screen, fmt.Sprintf("%d. %s", row.rank, row.name), arcadeFont, tx, ty, clr)
+		text.Draw(screen, tr("hud.survival", row.survival.Seconds()), arcadeFont, tx+hudWidth-60, ty, clr)
+	}
+}
+
+type hudRow struct {
+	rank     int
+	name     string
+	survival time.Duration
+	alive    bool
+	mine     bool
+}
+
+// hudRows 上位 hudRows 人と自分の行。生きているプレイヤーは最後に届いたランキングからの経過時間を足す
+func (g *Game) hudRows() []hudRow {
+	if g.online == nil {
+		return nil
+	}
+	elapsed := time.Since(g.roomRankingAt)
+	var rows []hudRow
+	for i, e := range g.roomRanking {
+		mine := e.PlayerID == g.myID
+		if i >= hudRows && !mine {
+			continue
+		}
+		if i >= hudRows && len(rows) == hudRows {
+			rows = rows[:hudRows-1]
+		}
+		survival := time.Duration(e.SurvivalMillis) * time.Millisecond
+		if e.Alive {
+			survival += elapsed
+		}
+		name := e.Name
+		if r := []rune(name); len(r) > 10 {
+			name = string(r[:10])
+		}
+		rows = append(rows, hudRow{rank: i + 1, name: name, survival: survival, alive: e.Alive, mine: mine})
+	}
+	return rows
+}
+
+// drawRunResult ゲームオーバー画面に自己ベストと全ユーザー中の順位を表示する
+func (g *Game) drawRunResult(screen *ebiten.Image) {
+	res := g.runResult
+	if res == nil {
+		return
+	}
+	best := tr("result.best", float64(res.HighScoreMillis)/1000)
+	if res.NewBest {
+		best += "  " + tr("result.newBest")
+	}
+	text.Draw(screen, best, arcadeFont, 275, 180, hudHighlight)
+	text.Draw(screen, tr("result.rank", res.GlobalRank, res.TotalPlayers), arcadeFont, 275, 200, hudHighlight)
+}
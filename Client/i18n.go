@@ -0,0 +1,113 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"log"
+	"path"
+
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+)
+
+// 画面に出す文字列の翻訳
+//
+// 文字列は locales/<言語>.json にキーと fmt の書式で書き、tr で引く。
+// 数字は言語ごとの書き方(桁区切りなど)で整形される。
+// 新しい言語は JSON を足して languages に加えるだけでよい。足りないキーは英語で表示する。
+
+//go:embed locales/*.json
+var localeFiles embed.FS
+
+// languages 選べる言語。並びは設定画面で切り替える順で、先頭が足りない翻訳を補う言語
+var languages = []language.Tag{language.English, language.Japanese}
+
+var languageMatcher = language.NewMatcher(languages)
+
+// locale 1つの言語の文字列と数字の書き方
+type locale struct {
+	tag      language.Tag
+	messages map[string]string
+	printer  *message.Printer
+}
+
+var (
+	// locales 言語のタグ("en" など)ごとの翻訳
+	locales = make(map[string]*locale)
+	// currentLocale 今の言語。setLanguage で変える
+	currentLocale *locale
+)
+
+func init() {
+	for _, tag := range languages {
+		data, err := localeFiles.ReadFile(path.Join("locales", tag.String()+".json"))
+		if err != nil {
+			log.Fatal(err)
+		}
+		l := &locale{tag: tag, printer: message.NewPrinter(tag)}
+		if err := json.Unmarshal(data, &l.messages); err != nil {
+			log.Fatalf("locale %s: %v", tag, err)
+		}
+		locales[tag.String()] = l
+	}
+	base := locales[languages[0].String()]
+	for _, l := range locales {
+		for k := range base.messages {
+			if _, ok := l.messages[k]; !ok {
+				log.Printf("locale %s: missing %q", l.tag, k)
+			}
+		}
+	}
+	currentLocale = base
+}
+
+// setLanguage 表示する言語を変える。空か知らない言語なら、OSの言語に一番近いものにする
+func setLanguage(name string) {
+	if l, ok := locales[name]; ok {
+		currentLocale = l
+		return
+	}
+	tag, _ := language.MatchStrings(languageMatcher, systemLanguages()...)
+	base, _ := tag.Base()
+	if l, ok := locales[base.String()]; ok {
+		currentLocale = l
+		return
+	}
+	currentLocale = locales[languages[0].String()]
+}
+
+// tr key の文字列を今の言語で引き、args で整形する
+func tr(key string, args ...interface{}) string {
+	format, ok := currentLocale.messages[key]
+	if !ok {
+		if format, ok = locales[languages[0].String()].messages[key]; !ok {
+			return key
+		}
+	}
+	return currentLocale.printer.Sprintf(format, args...)
+}
+
+// languageName 設定画面に出す言語の名前。空ならOSに合わせる
+func languageName(name string) string {
+	l, ok := locales[name]
+	if !ok {
+		return tr("options.languageAuto")
+	}
+	// それぞれの言語での呼び方(日本語なら「日本語」)にする
+	return l.messages["language.name"]
+}
+
+// nextLanguage 設定画面で言語を切り替える順番。自動 → languages の順 → 自動
+func nextLanguage(name string, dir int) string {
+	names := []string{""}
+	for _, tag := range languages {
+		names = append(names, tag.String())
+	}
+	i := 0
+	for j, n := range names {
+		if n == name {
+			i = j
+		}
+	}
+	return names[(i+dir+len(names))%len(names)]
+}
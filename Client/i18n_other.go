@@ -0,0 +1,20 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"strings"
+)
+
+// systemLanguages 環境変数の言語。"ja_JP.UTF-8" のような形式なので、"ja_JP" の部分だけにする
+func systemLanguages() []string {
+	var langs []string
+	for _, env := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if v := os.Getenv(env); v != "" && v != "C" && v != "POSIX" {
+			lang, _, _ := strings.Cut(v, ".")
+			langs = append(langs, strings.ReplaceAll(lang, "_", "-"))
+		}
+	}
+	return langs
+}
@@ -0,0 +1,17 @@
+package main
+
+import (
+	"log"
+
+	"golang.org/x/sys/windows"
+)
+
+// systemLanguages Windowsの表示言語。好ましい順
+func systemLanguages() []string {
+	langs, err := windows.GetUserPreferredUILanguages(windows.MUI_LANGUAGE_NAME)
+	if err != nil {
+		log.Printf("failed to get UI languages: %v", err)
+		return nil
+	}
+	return langs
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"image/color"
+	"time"
+
+	"github.com/eiei114/dinosaur-jump/protocol"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/text"
+)
+
+// idleWarning 放置でアウトになるまでの残りがこれを切ったらカウントダウンを表示する
+const idleWarning = 3 * time.Second
+
+var warningColor = color.RGBA{0xe0, 0x20, 0x20, 0xff}
+
+// causeMessages ゲームオーバー画面に表示する死因の翻訳のキー
+var causeMessages = map[string]string{
+	protocol.CauseWall:   "cause.wall",
+	protocol.CauseNPC:    "cause.npc",
+	protocol.CausePlayer: "cause.player",
+	protocol.CauseIdle:   "cause.idle",
+}
+
+// markMoved 動いた時刻を記録する。判定の正はサーバーで、ここでは表示のためだけに数える
+func (g *Game) markMoved() {
+	g.lastMoved = g.timePassed
+}
+
+// idleRemaining 放置でアウトになるまでの残り時間。判定しない設定ならfalse
+func (g *Game) idleRemaining() (time.Duration, bool) {
+	if g.idleTimeout <= 0 {
+		return 0, false
+	}
+	idle := time.Duration((g.timePassed - g.lastMoved) * float64(time.Second))
+	return max(g.idleTimeout-idle, 0), true
+}
+
+// drawIdleWarning 残り時間が少なくなったら画面中央にカウントダウンを表示する
+func (g *Game) drawIdleWarning(screen *ebiten.Image) {
+	remaining, ok := g.idleRemaining()
+	if !ok || remaining > idleWarning {
+		return
+	}
+	text.Draw(screen, tr("idle.warning", remaining.Seconds()), arcadeFont, 270, 200, warningColor)
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+)
+
+// action プレイヤーの操作。キー・ゲームパッドのボタン・スティックはすべて操作に割り当てて使う
+type action int
+
+const (
+	actionMoveUp action = iota
+	actionMoveDown
+	actionMoveLeft
+	actionMoveRight
+	// actionJump ジャンプはまだゲームにないので、割り当てだけ先に用意している
+	actionJump
+	actionPause
+	// actionConfirm メニューの決定
+	actionConfirm
+	// actionCancel メニューを閉じる・取り消す
+	actionCancel
+
+	actionCount
+)
+
+// actionNames 設定ファイルと操作の記録で使う名前
+var actionNames = [actionCount]string{"moveUp", "moveDown", "moveLeft", "moveRight", "jump", "pause", "confirm", "cancel"}
+
+func (a action) String() string {
+	return actionNames[a]
+}
+
+// required 割り当てを空にできない操作。決定と取り消しがないとメニューを操作できなくなる
+func (a action) required() bool {
+	return a == actionConfirm || a == actionCancel
+}
+
+// label 操作設定の画面に出す名前
+func (a action) label() string {
+	return tr("action." + a.String())
+}
+
+func (a action) MarshalText() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+func (a *action) UnmarshalText(text []byte) error {
+	for i, name := range actionNames {
+		if name == string(text) {
+			*a = action(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown action %q", text)
+}
+
+// binding 1つの操作に割り当てたもの。どれか1つでも押されていればその操作をしている
+type binding struct {
+	Keys    []key       `json:"keys,omitempty"`
+	Buttons []padButton `json:"buttons,omitempty"`
+	Sticks  []stick     `json:"sticks,omitempty"`
+}
+
+func (b binding) empty() bool {
+	return len(b.Keys) == 0 && len(b.Buttons) == 0 && len(b.Sticks) == 0
+}
+
+// String 操作設定の画面に出す割り当ての一覧
+func (b binding) String() string {
+	var names []string
+	for _, k := range b.Keys {
+		names = append(names, strings.ToUpper(k.String()))
+	}
+	for _, p := range b.Buttons {
+		names = append(names, p.String())
+	}
+	for _, s := range b.Sticks {
+		names = append(names, s.String())
+	}
+	if len(names) == 0 {
+		return "-"
+	}
+	return strings.Join(names, " ")
+}
+
+// bindings 操作ごとの割り当て
+type bindings map[action]binding
+
+func defaultBindings() bindings {
+	return bindings{
+		actionMoveUp: {
+			Keys:    []key{key(ebiten.KeyW), key(ebiten.KeyArrowUp)},
+			Buttons: []padButton{padButton(ebiten.StandardGamepadButtonLeftTop)},
+			Sticks:  []stick{{ebiten.StandardGamepadAxisLeftStickVertical, -1}},
+		},
+		actionMoveDown: {
+			Keys:    []key{key(ebiten.KeyS), key(ebiten.KeyArrowDown)},
+			Buttons: []padButton{padButton(ebiten.StandardGamepadButtonLeftBottom)},
+			Sticks:  []stick{{ebiten.StandardGamepadAxisLeftStickVertical, 1}},
+		},
+		actionMoveLeft: {
+			Keys:    []key{key(ebiten.KeyA), key(ebiten.KeyArrowLeft)},
+			Buttons: []padButton{padButton(ebiten.StandardGamepadButtonLeftLeft)},
+			Sticks:  []stick{{ebiten.StandardGamepadAxisLeftStickHorizontal, -1}},
+		},
+		actionMoveRight: {
+			Keys:    []key{key(ebiten.KeyD), key(ebiten.KeyArrowRight)},
+			Buttons: []padButton{padButton(ebiten.StandardGamepadButtonLeftRight)},
+			Sticks:  []stick{{ebiten.StandardGamepadAxisLeftStickHorizontal, 1}},
+		},
+		actionJump: {
+			Keys:    []key{key(ebiten.KeySpace)},
+			Buttons: []padButton{padButton(ebiten.StandardGamepadButtonRightBottom)},
+		},
+		actionPause: {
+			Keys:    []key{key(ebiten.KeyEscape)},
+			Buttons: []padButton{padButton(ebiten.StandardGamepadButtonCenterRight)},
+		},
+		actionConfirm: {
+			Keys:    []key{key(ebiten.KeyEnter), key(ebiten.KeySpace)},
+			Buttons: []padButton{padButton(ebiten.StandardGamepadButtonRightBottom)},
+		},
+		actionCancel: {
+			Keys:    []key{key(ebiten.KeyEscape)},
+			Buttons: []padButton{padButton(ebiten.StandardGamepadButtonRightRight)},
+		},
+	}
+}
+
+// padButton 標準配置のゲームパッドのボタン。設定ファイルには padButtonNames の名前で書く
+type padButton ebiten.StandardGamepadButton
+
+// padButtonNames Xbox のコントローラーでの呼び方
+var padButtonNames = map[ebiten.StandardGamepadButton]string{
+	ebiten.StandardGamepadButtonRightBottom:      "A",
+	ebiten.StandardGamepadButtonRightRight:       "B",
+	ebiten.StandardGamepadButtonRightLeft:        "X",
+	ebiten.StandardGamepadButtonRightTop:         "Y",
+	ebiten.StandardGamepadButtonFrontTopLeft:     "LB",
+	ebiten.StandardGamepadButtonFrontTopRight:    "RB",
+	ebiten.StandardGamepadButtonFrontBottomLeft:  "LT",
+	ebiten.StandardGamepadButtonFrontBottomRight: "RT",
+	ebiten.StandardGamepadButtonCenterLeft:       "BACK",
+	ebiten.StandardGamepadButtonCenterRight:      "START",
+	ebiten.StandardGamepadButtonCenterCenter:     "HOME",
+	ebiten.StandardGamepadButtonLeftStick:        "LS",
+	ebiten.StandardGamepadButtonRightStick:       "RS",
+	ebiten.StandardGamepadButtonLeftTop:          "DPAD-UP",
+	ebiten.StandardGamepadButtonLeftBottom:       "DPAD-DOWN",
+	ebiten.StandardGamepadButtonLeftLeft:         "DPAD-LEFT",
+	ebiten.StandardGamepadButtonLeftRight:        "DPAD-RIGHT",
+}
+
+func (p padButton) String() string {
+	return padButtonNames[ebiten.StandardGamepadButton(p)]
+}
+
+func (p padButton) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+func (p *padButton) UnmarshalText(text []byte) error {
+	for b, name := range padButtonNames {
+		if strings.EqualFold(name, string(text)) {
+			*p = padButton(b)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown gamepad button %q", text)
+}
+
+// stick スティックの軸の片側。dir が -1 なら左・上、1 なら右・下に倒したとき
+type stick struct {
+	axis ebiten.StandardGamepadAxis
+	dir  int
+}
+
+var stickAxisNames = map[ebiten.StandardGamepadAxis][2]string{
+	ebiten.StandardGamepadAxisLeftStickHorizontal:  {"LS-LEFT", "LS-RIGHT"},
+	ebiten.StandardGamepadAxisLeftStickVertical:    {"LS-UP", "LS-DOWN"},
+	ebiten.StandardGamepadAxisRightStickHorizontal: {"RS-LEFT", "RS-RIGHT"},
+	ebiten.StandardGamepadAxisRightStickVertical:   {"RS-UP", "RS-DOWN"},
+}
+
+func (s stick) String() string {
+	names := stickAxisNames[s.axis]
+	if s.dir < 0 {
+		return names[0]
+	}
+	return names[1]
+}
+
+func (s stick) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s *stick) UnmarshalText(text []byte) error {
+	for axis, names := range stickAxisNames {
+		for i, name := range names {
+			if strings.EqualFold(name, string(text)) {
+				*s = stick{axis: axis, dir: i*2 - 1}
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("unknown stick direction %q", text)
+}
+
+// tilted デッドゾーンより大きく dir の向きに倒されているか
+func (s stick) tilted(id ebiten.GamepadID, deadZone float64) bool {
+	return ebiten.StandardGamepadAxisValue(id, s.axis)*float64(s.dir) > deadZone
+}
+
+// actionSet 操作ごとに1ビット
+type actionSet uint16
+
+func (s actionSet) has(a action) bool {
+	return s&(1<<a) != 0
+}
+
+// input 1フレームごとの操作の状態
+// 毎フレーム最初に update を呼び、あとは操作で問い合わせる。キーやボタンを直接読まない
+type input struct {
+	pressed, prev actionSet
+
+	// recorder nilでなければプレイ中の操作を書き出す
+	recorder *inputRecorder
+	// replay nilでなければ、プレイ中はキーやボタンの代わりに記録した操作を使う。記録を使い切ったらnilに戻す
+	replay *inputReplay
+}
+
+// update 今のフレームの操作を読む
+func (in *input) update(b bindings, deadZone float64) {
+	in.prev = in.pressed
+	if in.replay != nil {
+		if set, ok := in.replay.next(); ok {
+			in.pressed = set
+			return
+		}
+	}
+	in.pressed = pollActions(b, deadZone)
+	if in.recorder != nil {
+		in.recorder.write(in.pressed)
+	}
+}
+
+// resync 割り当てを変えたときに呼ぶ。押したままのものが、次のフレームで押され始めたことにならないようにする
+func (in *input) resync(b bindings, deadZone float64) {
+	if !in.replay.playing() {
+		in.pressed = pollActions(b, deadZone)
+	}
+}
+
+func (in *input) isPressed(a action) bool {
+	return in.pressed.has(a)
+}
+
+// justPressed このフレームで押され始めたか
+func (in *input) justPressed(a action) bool {
+	return in.pressed.has(a) && !in.prev.has(a)
+}
+
+// pollActions キーボードとつながっているすべてのゲームパッドから、押されている操作を集める
+func pollActions(b bindings, deadZone float64) actionSet {
+	var set actionSet
+	pads := ebiten.AppendGamepadIDs(nil)
+	for a, bind := range b {
+		if bindingPressed(bind, pads, deadZone) {
+			set |= 1 << a
+		}
+	}
+	return set
+}
+
+func bindingPressed(b binding, pads []ebiten.GamepadID, deadZone float64) bool {
+	for _, k := range b.Keys {
+		if ebiten.IsKeyPressed(ebiten.Key(k)) {
+			return true
+		}
+	}
+	for _, id := range pads {
+		if !ebiten.IsStandardGamepadLayoutAvailable(id) {
+			continue
+		}
+		for _, p := range b.Buttons {
+			if ebiten.IsStandardGamepadButtonPressed(id, ebiten.StandardGamepadButton(p)) {
+				return true
+			}
+		}
+		for _, s := range b.Sticks {
+			if s.tilted(id, deadZone) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// capturedInput 割り当て直すときに押されたもの。どれか1つだけが設定される
+type capturedInput struct {
+	key    *key
+	button *padButton
+	stick  *stick
+}
+
+// captureInput このフレームで押され始めたキー・ボタンか、大きく倒されたスティックを1つ返す
+func captureInput() (capturedInput, bool) {
+	for _, k := range inpututil.AppendPressedKeys(nil) {
+		if inpututil.IsKeyJustPressed(k) {
+			c := key(k)
+			return capturedInput{key: &c}, true
+		}
+	}
+	for _, id := range ebiten.AppendGamepadIDs(nil) {
+		if !ebiten.IsStandardGamepadLayoutAvailable(id) {
+			continue
+		}
+		for b := range padButtonNames {
+			if inpututil.IsStandardGamepadButtonJustPressed(id, b) {
+				c := padButton(b)
+				return capturedInput{button: &c}, true
+			}
+		}
+		for axis := range stickAxisNames {
+			// デッドゾーンの設定に関わらず、はっきり倒したときだけ受け付ける
+			for _, dir := range []int{-1, 1} {
+				if s := (stick{axis: axis, dir: dir}); s.tilted(id, 0.7) {
+					return capturedInput{stick: &s}, true
+				}
+			}
+		}
+	}
+	return capturedInput{}, false
+}
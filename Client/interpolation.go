@@ -0,0 +1,203 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/eiei114/dinosaur-jump/protocol"
+)
+
+const (
+	// defaultInterpDelay 他のプレイヤーとNPCをどれだけ過去の時点で描画するか
+	// スナップショット2〜3回分あれば、1回落ちても補間を続けられる
+	defaultInterpDelay = 100 * time.Millisecond
+	// maxExtrapolation パケットが途切れたときに、最後の速度で先読みする最大時間
+	maxExtrapolation = 250 * time.Millisecond
+	// maxSamples エンティティごとに保持するスナップショットの数
+	maxSamples = 32
+	// clockSnapThreshold 描画時刻が目標からこれ以上遅れたら補正せずに合わせ直す(秒)
+	clockSnapThreshold = 0.25
+	// clockCorrection 描画時刻を1フレームごとに目標へ寄せる割合
+	clockCorrection = 0.05
+)
+
+type entitySample struct {
+	t     float64 // サーバー時刻(秒) = tick / tickRate
+	pos   protocol.Position
+	flags protocol.EntityFlags
+}
+
+// interpolator 自分以外のエンティティのスナップショットをためておき、
+// 少し過去の時点の位置を前後2つのスナップショットから補間して返す
+type interpolator struct {
+	delay    time.Duration
+	tickRate int
+
+	entities map[uint32][]entitySample
+	// latest 最後に受け取ったスナップショットのサーバー時刻
+	latest float64
+	// received スナップショットを1つ以上受け取ったか
+	received bool
+	// clock 描画に使うサーバー時刻
+	clock     float64
+	clockSet  bool
+	lastFrame time.Time
+}
+
+func newInterpolator(delay time.Duration, tickRate int) *interpolator {
+	if tickRate <= 0 {
+		tickRate = 30
+	}
+	return &interpolator{
+		delay:    delay,
+		tickRate: tickRate,
+		entities: make(map[uint32][]entitySample),
+	}
+}
+
+// push スナップショットを受け取る。skip(自分)のエンティティは予測で動かすので含めない
+func (ip *interpolator) push(snap *protocol.EntitySnapshot, skip uint32) {
+	t := float64(snap.Tick) / float64(ip.tickRate)
+	if ip.received && t <= ip.latest {
+		// 順番が入れ替わって届いた古いスナップショットや、同じtickの重複は捨てる
+		// 同じ時刻のサンプルが並ぶと sample で補間の幅が0になる
+		return
+	}
+	ip.latest = t
+	ip.received = true
+
+	seen := make(map[uint32]bool, len(snap.Entities))
+	for _, e := range snap.Entities {
+		if e.ID == skip {
+			continue
+		}
+		seen[e.ID] = true
+		samples := append(ip.entities[e.ID], entitySample{t: t, pos: e.Position, flags: e.Flags})
+		if len(samples) > maxSamples {
+			samples = samples[len(samples)-maxSamples:]
+		}
+		ip.entities[e.ID] = samples
+	}
+	// 最新のスナップショットにいないエンティティは部屋からいなくなった
+	for id := range ip.entities {
+		if !seen[id] {
+			delete(ip.entities, id)
+		}
+	}
+}
+
+// advance 描画時刻を1フレーム分進める
+// 目標(最新のスナップショット - delay)に少しずつ寄せて、受信間隔のゆらぎを吸収する
+func (ip *interpolator) advance(now time.Time) {
+	target := ip.latest - ip.delay.Seconds()
+	if !ip.clockSet {
+		ip.clock = target
+		ip.clockSet = true
+		ip.lastFrame = now
+		return
+	}
+
+	elapsed := now.Sub(ip.lastFrame).Seconds()
+	ip.lastFrame = now
+
+	diff := target - (ip.clock + elapsed)
+	if diff > clockSnapThreshold {
+		// 大きく遅れている(接続直後や処理落ち)。補正せずに追いつく
+		ip.clock = target
+		return
+	}
+	// 進みすぎているとき(パケットロス中)は遅くするだけで、時刻を巻き戻さない
+	ip.clock += math.Max(elapsed+diff*clockCorrection, 0)
+}
+
+// viewTick いま描画しているサーバーのtick。入力と一緒に送り、サーバーのラグ補償に使う
+func (ip *interpolator) viewTick() uint32 {
+	if ip.clock <= 0 {
+		return 0
+	}
+	return uint32(math.Round(ip.clock * float64(ip.tickRate)))
+}
+
+// each 全エンティティの描画時刻での状態を、IDの昇順で fn に渡す
+func (ip *interpolator) each(fn func(id uint32, pos protocol.Position, flags protocol.EntityFlags)) {
+	ids := make([]uint32, 0, len(ip.entities))
+	for id := range ip.entities {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	for _, id := range ids {
+		pos, flags := ip.sample(ip.entities[id])
+		fn(id, pos, flags)
+	}
+}
+
+func (ip *interpolator) sample(samples []entitySample) (protocol.Position, protocol.EntityFlags) {
+	t := ip.clock
+	first := samples[0]
+	if t <= first.t || len(samples) == 1 {
+		return first.pos, first.flags
+	}
+
+	for i := 1; i < len(samples); i++ {
+		a, b := samples[i-1], samples[i]
+		if t <= b.t {
+			if b.t <= a.t {
+				return b.pos, b.flags
+			}
+			f := (t - a.t) / (b.t - a.t)
+			return lerp(a.pos, b.pos, f), a.flags
+		}
+	}
+
+	// 描画時刻がスナップショットを追い越した(パケットロス)。直近の速度で少しだけ先読みする
+	a, b := samples[len(samples)-2], samples[len(samples)-1]
+	if b.t <= a.t {
+		return b.pos, b.flags
+	}
+	ahead := math.Min(t-b.t, maxExtrapolation.Seconds())
+	f := 1 + ahead/(b.t-a.t)
+	return lerp(a.pos, b.pos, f), b.flags
+}
+
+func lerp(a, b protocol.Position, f float64) protocol.Position {
+	return protocol.Position{X: a.X + (b.X-a.X)*f, Y: a.Y + (b.Y-a.Y)*f}
+}
+
+// interpStats デバッグ表示用の、バッファにたまっているスナップショットの状況
+type interpStats struct {
+	entities      int
+	minDepth      int
+	maxDepth      int
+	extrapolating int
+	// lag 描画時刻が最新のスナップショットからどれだけ遅れているか
+	lag time.Duration
+}
+
+func (ip *interpolator) stats() interpStats {
+	s := interpStats{entities: len(ip.entities), minDepth: -1}
+	for _, samples := range ip.entities {
+		// 描画時刻より未来にあるスナップショットの数 = まだ使っていないバッファ
+		depth := 0
+		for _, smp := range samples {
+			if smp.t > ip.clock {
+				depth++
+			}
+		}
+		if s.minDepth < 0 || depth < s.minDepth {
+			s.minDepth = depth
+		}
+		if depth > s.maxDepth {
+			s.maxDepth = depth
+		}
+		if depth == 0 {
+			s.extrapolating++
+		}
+	}
+	if s.minDepth < 0 {
+		s.minDepth = 0
+	}
+	s.lag = time.Duration((ip.latest - ip.clock) * float64(time.Second))
+	return s
+}
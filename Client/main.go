@@ -2,18 +2,24 @@ package main
 
 import (
 	"bytes"
+	"context"
 	_ "embed"
-	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"image"
 	"image/color"
 	_ "image/png"
 	"log"
+	"maps"
 	"math/rand"
-	"net/http"
-	"strings"
+	"os"
+	"slices"
 	"time"
 
+	"github.com/eiei114/dinosaur-jump/protocol"
+	"github.com/eiei114/dinosaur-jump/protocol/apiclient"
+	"github.com/eiei114/dinosaur-jump/protocol/sim"
 	"github.com/hajimehoshi/ebiten/v2"
 	"github.com/hajimehoshi/ebiten/v2/examples/resources/fonts"
 	"github.com/hajimehoshi/ebiten/v2/inpututil"
@@ -23,40 +29,43 @@ import (
 )
 
 const (
+	// debug 起動したときからデバッグ表示を出すか。-debug フラグと F4 キーでも切り替えられる
 	debug    = false
 	screenX  = 640
 	screenY  = 640
 	fontSize = 10
-
-	// game modes
-	modeTitle    = 0
-	modeLogin    = 1
-	modeGame     = 2
-	modeGameOver = 3
+	// fallbackFontSize arcadeFont にない日本語などを描く大きさ
+	fallbackFontSize = 12
+	// textFontSize 漢字が潰れないよう arcadeFont より大きくする
+	textFontSize = 14
 
 	// image sizes
-	playerHeight = 100
-	playerWidth  = 100
-	wallHeight   = 50
-	wallWidth    = 50
-)
+	wallHeight = 50
+	wallWidth  = 50
 
-//go:embed resources/images/player.png
-var bytePlayerImg []byte
+	// defaultServerURL 設定ファイルにもフラグにもないときに接続するサーバー
+	defaultServerURL = "http://localhost:8080"
+)
 
 //go:embed resources/images/wall.png
 var byteWallImg []byte
 
 var (
-	playerImg  *ebiten.Image
-	wallImg    *ebiten.Image
+	playerImg *ebiten.Image
+	wallImg   *ebiten.Image
+	// arcadeFont 画面の文字のほとんどに使う。日本語は M+ で描く
 	arcadeFont font.Face
+	// textFont 日本語も描けるフォント。名前などプレイヤーが入力した文字に使う
+	textFont font.Face
+	// serverURL 接続するサーバー。setServerURL で変える
+	serverURL string
+	api       *apiclient.Client
 )
 
 func init() {
 	rand.Seed(time.Now().UnixNano())
 
-	img, _, err := image.Decode(bytes.NewReader(bytePlayerImg))
+	img, _, err := image.Decode(bytes.NewReader(sim.PlayerSprite))
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -68,16 +77,16 @@ func init() {
 	}
 	wallImg = ebiten.NewImageFromImage(img)
 
-	tt, err := opentype.Parse(fonts.PressStart2P_ttf)
+	arcade, err := opentype.Parse(fonts.PressStart2P_ttf)
 	if err != nil {
 		log.Fatal(err)
 	}
-	const dpi = 72
-	arcadeFont, err = opentype.NewFace(tt, &opentype.FaceOptions{
-		Size:    fontSize,
-		DPI:     dpi,
-		Hinting: font.HintingFull,
-	})
+	mplus, err := opentype.Parse(fonts.MPlus1pRegular_ttf)
+	if err != nil {
+		log.Fatal(err)
+	}
+	arcadeFont = newFallbackFace(fontLayer{arcade, fontSize}, fontLayer{mplus, fallbackFontSize})
+	textFont = newFace(mplus, textFontSize)
 }
 
 type wall struct {
@@ -98,19 +107,66 @@ func (w *wall) move(speed float64) {
 
 // Game struct
 type Game struct {
-	mode               int
+	scenes             sceneManager
 	playerX            int
 	playerY            int
 	players            []PlayerInfo
 	myPlayer           PlayerInfo
-	wall               *wall // 壁の配列を追加
-	runes              []rune
-	text               string
-	counter            int
+	wall               *wall  // 壁の配列を追加
+	text               string // ログインした名前
 	npcs               []PlayerInfo
 	speedMultiplier    float64
 	maxSpeedMultiplier float64
 	timePassed         float64 // 経過時間（秒）
+	// rnd オフラインのプレイで使う乱数。記録したプレイを再生できるよう、プレイごとにシードを決め直す
+	rnd     *rand.Rand
+	ranking []protocol.UserRankingResponse
+	// rankingFetch ランキングを取得している間だけnilでない
+	rankingFetch chan rankingResult
+	// body オフラインでの自分の位置と速度。オンラインでは pred が持つ
+	body sim.Body
+	// grid オフラインの当たり判定。毎フレーム入れ直して使い回す
+	grid *sim.Grid
+	// debug 当たり判定などのデバッグ表示
+	debug debugOverlay
+	// lastMoved 最後に動いたときの timePassed
+	lastMoved float64
+	// idleTimeout これだけ動かないとアウトになる。オンラインではサーバーの設定に従う
+	idleTimeout time.Duration
+	// maxPause オンラインでポーズしている間、放置と衝突の判定から守られる時間。1回のプレイでの合計
+	maxPause time.Duration
+	// pauseLeft このプレイでまだ守られるポーズの時間
+	pauseLeft time.Duration
+	// deathCause 直前のプレイの死因 (protocol.CauseWall など)
+	deathCause string
+
+	// オンラインプレイ中だけ使う
+	online      *session
+	myID        uint32
+	names       map[uint32]string
+	looks       map[uint32]protocol.Appearance
+	pred        predictor
+	hasSnapshot bool
+	// selfPaused サーバーが自分をポーズ中として扱っているか。ポーズは断られることがある
+	selfPaused bool
+	interp     *interpolator
+	// reconnecting 接続が切れて再接続している間だけnilでない
+	reconnecting chan reconnectResult
+	// input 操作の状態。キーやボタンは直接読まずにこれに問い合わせる
+	input input
+	// settings 今の設定。フラグで上書きした値も含む
+	settings settings
+	// store 設定ファイル。nilなら保存しない
+	store *settingsStore
+	// windowWidth, windowHeight 最後に見たウィンドウの大きさ。ドラッグで変えられたら終了時に保存する
+	windowWidth, windowHeight int
+	// appearance ログインしたときにサーバーに保存する色とスキン。空なら変更しない
+	appearance protocol.Appearance
+	// roomRanking 部屋内の生存時間ランキングと、それが届いた時刻
+	roomRanking   []protocol.RankingEntry
+	roomRankingAt time.Time
+	// runResult 直前のプレイの自己ベストと全ユーザー中の順位。サーバーが保存し終えると届く
+	runResult *protocol.RunResult
 }
 
 type PlayerInfo struct {
@@ -119,14 +175,22 @@ type PlayerInfo struct {
 	username string
 	id       int
 	isMine   bool
+	look     protocol.Appearance
+	// status 他のプレイヤーがポーズ中・切断中なら頭上に出す
+	status string
 }
 
 // NewGame method
-func NewGame() *Game {
+func NewGame(s settings, store *settingsStore) *Game {
 	g := &Game{
 		maxSpeedMultiplier: 10.0, // この値は任意で設定できます。例として3倍速とします。
+		settings:           s,
+		store:              store,
+		rnd:                rand.New(rand.NewSource(time.Now().UnixNano())),
 	}
+	g.applySettings()
 	g.init()
+	g.scenes.Push(newTitleScene(g))
 	return g
 }
 
@@ -134,7 +198,10 @@ func NewGame() *Game {
 func (g *Game) init() {
 	first := InitPlayer(g.text, true)
 	g.myPlayer = first
+	g.body = sim.Body{Pos: protocol.Position{X: float64(first.x), Y: float64(first.y)}}
 	g.timePassed = 0
+	g.lastMoved = 0
+	g.idleTimeout = sim.DefaultIdleTimeout
 
 	// 壁の初期配置
 	g.wall = &wall{
@@ -144,135 +211,88 @@ func (g *Game) init() {
 		bottomY: screenY - wallHeight,
 		size:    50,
 	}
+	g.grid = sim.NewGrid(sim.GridCellSize)
 
 	// NPCの初期化: 前回のNPCをクリアしてから新しいNPCを追加
 	g.npcs = []PlayerInfo{}
-	g.npcs = append(g.npcs, InitNPC("NPC1"))
-	g.npcs = append(g.npcs, InitNPC("NPC2"))
-	g.npcs = append(g.npcs, InitNPC("NPC3"))
+	g.npcs = append(g.npcs, InitNPC("NPC1", g.rnd))
+	g.npcs = append(g.npcs, InitNPC("NPC2", g.rnd))
+	g.npcs = append(g.npcs, InitNPC("NPC3", g.rnd))
 
 	g.speedMultiplier = 1.0 // 初期の乗数
 }
 
 // Update method
 func (g *Game) Update() error {
-	switch g.mode {
-	case modeTitle:
-		if g.isKeySpaceJustPressed() {
-			g.mode = modeLogin
-		}
-	case modeLogin:
-		g.runes = ebiten.AppendInputChars(g.runes[:0])
-		g.text += string(g.runes)
-		// Adjust the string to be at most 10 lines.
-		ss := strings.Split(g.text, "\n")
-		if len(ss) > 10 {
-			g.text = strings.Join(ss[len(ss)-10:], "\n")
-		}
-
-		// If the backspace key is pressed, remove one character.
-		if repeatingKeyPressed(ebiten.KeyBackspace) {
-			if len(g.text) >= 1 {
-				g.text = g.text[:len(g.text)-1]
-			}
-		}
-
-		g.counter++
-
-		if g.isKeyEnterJustPressed() {
-
-			g.mode = modeGame
-		}
-	case modeGame:
-
-		g.timePassed += 1 / 60.0 // 60FPSを仮定
-
-		if inpututil.IsKeyJustPressed(ebiten.KeyW) {
-			g.myPlayer.y -= 25
-		}
-
-		if inpututil.IsKeyJustPressed(ebiten.KeyS) {
-			g.myPlayer.y += 25
-
-		}
-
-		if inpututil.IsKeyJustPressed(ebiten.KeyD) {
-			g.myPlayer.x += 25
-
-		}
-
-		if inpututil.IsKeyJustPressed(ebiten.KeyA) {
-			g.myPlayer.x -= 25
-		}
-
-		if inpututil.IsKeyJustPressed(ebiten.KeyE) {
-			//サーバーにリクエストを送るコードをここに書いて
-			//go g.sendMessageToServer("A message from the client") // using goroutine so it doesn't block the main loop
-		}
-
-		//g.wall.move(0.01) // 速度は任意で設定可能
-
-		// Check for collision with wall
-		if g.isPlayerCollidingWithWall() {
-			g.mode = modeGameOver
-		}
-
-		if g.isPlayerCollidingWithOtherPlayers() {
-			g.mode = modeGameOver
-		}
-
-		fmt.Println("プレイヤー情報", g.myPlayer)
-
-		// NPCsを更新
-		for i := range g.npcs {
-			g.moveNPC(&g.npcs[i])
-		}
-
-		// Check for collision with NPCs
-		if g.isPlayerCollidingWithNPCs() {
-			g.mode = modeGameOver
-		}
+	if inpututil.IsKeyJustPressed(ebiten.KeyF3) {
+		g.setShowNetStats(!g.settings.ShowNetStats)
+	}
+	g.windowWidth, g.windowHeight = ebiten.WindowSize()
+	if !g.debug.update(g) {
+		return nil
+	}
+	g.input.update(g.settings.Bindings, g.settings.DeadZone)
+	g.pollRanking()
+	err := g.scenes.Update()
+	if g.debug.enabled {
+		g.debug.track(g.npcs)
+	}
+	return err
+}
 
-		g.speedMultiplier += 0.001 // この値は微調整する必要があります。
-		if g.speedMultiplier > g.maxSpeedMultiplier {
-			g.speedMultiplier = g.maxSpeedMultiplier
-		}
+// gameOver ゲームオーバー画面に切り替える
+// cause は死因。接続が切れた場合などは空
+func (g *Game) gameOver(cause string) {
+	if _, ok := g.scenes.Current().(*gameOverScene); ok {
+		return
+	}
+	g.endRun()
+	if cause != "" {
+		sfx.play(soundDeath)
+	}
+	g.deathCause = cause
+	g.runResult = nil
+	g.scenes.Replace(newGameOverScene(g))
+}
 
-	case modeGameOver:
-		if g.isKeySpaceJustPressed() {
-			g.init()
-			g.mode = modeGame
+// beginRun プレイを1回始める。乱数のシードを決め直し、操作の記録と再生もここから始める
+// 再生中は記録したシードを使うので、NPCの配置と動きも記録したときと同じになる
+func (g *Game) beginRun() {
+	seed := time.Now().UnixNano()
+	if g.input.replay != nil {
+		if s, ok := g.input.replay.begin(); ok {
+			seed = s
+		} else {
+			g.input.replay = nil
 		}
 	}
+	if g.input.recorder != nil {
+		g.input.recorder.begin(seed)
+	}
+	g.rnd = rand.New(rand.NewSource(seed))
+}
 
-	return nil
+// endRun プレイが終わった。アウトになったときと、ポーズメニューからタイトルに戻ったときに呼ぶ
+func (g *Game) endRun() {
+	if g.input.recorder != nil {
+		g.input.recorder.end()
+	}
+	if g.input.replay != nil {
+		g.input.replay.end()
+	}
 }
 
-func InitNPC(name string) PlayerInfo {
+func InitNPC(name string, rnd *rand.Rand) PlayerInfo {
 	var npc PlayerInfo
 	npc.username = name
 	// Adjusting the initial position of the NPC considering the collision offset
-	npc.x = rand.Intn(screenX-playerWidth*2) + playerWidth/2
-	npc.y = rand.Intn(screenY-playerHeight*2) + playerHeight/2
+	npc.x = rnd.Intn(screenX-sim.PlayerWidth*2) + sim.PlayerWidth/2
+	npc.y = rnd.Intn(screenY-sim.PlayerHeight*2) + sim.PlayerHeight/2
 	return npc
 }
 
-func (g *Game) isPlayerCollidingWithNPCs() bool {
-	px1, py1, px2, py2 := g.myPlayer.bounds()
-
-	collisionOffset := 50 // Adjust this value to increase or decrease the collision offset
-
-	for _, npc := range g.npcs {
-		nx1, ny1, nx2, ny2 := npc.x+collisionOffset, npc.y+collisionOffset, npc.x+playerWidth-collisionOffset, npc.y+playerHeight-collisionOffset
-		if px1 < nx2 && px2 > nx1 && py1 < ny2 && py2 > ny1 {
-			return true
-		}
-	}
-	return false
-}
-
 func (g *Game) moveNPC(npc *PlayerInfo) {
-	direction := rand.Intn(4)             // 0:上, 1:下, 2:左, 3:右
+	direction := g.rnd.Intn(4)            // 0:上, 1:下, 2:左, 3:右
 	moveAmount := 5.0 * g.speedMultiplier // 乗数を考慮して移動量を計算
 
 	switch direction {
@@ -293,61 +313,67 @@ func (g *Game) moveNPC(npc *PlayerInfo) {
 	if npc.y < 0 {
 		npc.y = 0
 	}
-	if npc.x > screenX-playerWidth {
-		npc.x = screenX - playerWidth
+	if npc.x > screenX-sim.PlayerWidth {
+		npc.x = screenX - sim.PlayerWidth
 	}
-	if npc.y > screenY-playerHeight {
-		npc.y = screenY - playerHeight
+	if npc.y > screenY-sim.PlayerHeight {
+		npc.y = screenY - sim.PlayerHeight
 	}
 }
 
 // Draw method
 func (g *Game) Draw(screen *ebiten.Image) {
 	screen.Fill(color.White)
+	g.scenes.Draw(screen)
 
-	g.drawWall(screen) // 壁を描画
-	g.drawPlayer(screen, g.myPlayer)
+	if g.reconnecting != nil {
+		text.Draw(screen, tr("game.reconnecting"), arcadeFont, 250, 320, color.Black)
+	}
+
+	if g.settings.ShowNetStats {
+		g.drawNetStats(screen)
+	}
+	if g.debug.enabled {
+		g.drawDebugStats(screen)
+	}
+}
+
+// drawWorld 壁とプレイヤーとNPCを描く
+// デバッグ表示を出しているときは当たり判定も重ねて描き、自由カメラならその視点で描く
+func (g *Game) drawWorld(screen *ebiten.Image) {
+	dst := g.debug.worldTarget(screen)
+	g.drawWall(dst) // 壁を描画
+	g.drawPlayer(dst, g.myPlayer)
 
 	for i := 0; i < len(g.players); i++ {
-		g.drawPlayer(screen, g.players[i])
+		g.drawPlayer(dst, g.players[i])
 	}
 
 	for _, npc := range g.npcs {
-		g.drawNpcPlayer(screen, npc)
+		g.drawNpcPlayer(dst, npc)
 	}
 
-	switch g.mode {
-	case modeTitle:
-		text.Draw(screen, "PRESS SPACE KEY", arcadeFont, 245, 240, color.Black)
-	case modeLogin:
-		//todo 名前を入力してとテキストを入れたい
+	if g.debug.enabled {
+		g.drawHitboxes(dst)
+	}
+	g.debug.present(screen)
+}
 
-		// Blink the cursor.
-		t := g.text
-		if g.counter%60 < 30 {
-			t += "_"
-		}
-		text.Draw(screen, t, arcadeFont, 275, 240, color.Black)
-	case modeGame:
-		timeText := fmt.Sprintf("%.1f", g.timePassed)
-		text.Draw(screen, timeText, arcadeFont, screenX-50, 20, color.White)
-	case modeGameOver:
-		screen.Fill(color.White) // Clear the screen
-
-		users, err := getUserData()
-		if err == nil {
-			// リストの開始位置を定義
-			yPosition := 260
-
-			// 配列内の各ユーザー情報を表示
-			for _, user := range users {
-				text.Draw(screen, fmt.Sprintf("Name: %s", user.Name), arcadeFont, 275, yPosition, color.Black)
-				yPosition += 20 // 次の行の位置に移動
-				text.Draw(screen, fmt.Sprintf("HighScore: %d", user.HighScore), arcadeFont, 275, yPosition, color.Black)
-				yPosition += 20 // 次の行の位置に移動
-			}
-		}
-		text.Draw(screen, "GAME OVER", arcadeFont, 275, 240, color.Black)
+// drawNetStats 補間バッファの深さなど、通信の状況を左上に表示する
+func (g *Game) drawNetStats(screen *ebiten.Image) {
+	if g.online == nil || g.interp == nil {
+		text.Draw(screen, "offline", arcadeFont, 10, 20, color.Black)
+		return
+	}
+	st := g.interp.stats()
+	lines := []string{
+		fmt.Sprintf("delay %dms lag %dms", g.interp.delay.Milliseconds(), st.lag.Milliseconds()),
+		fmt.Sprintf("entities %d", st.entities),
+		fmt.Sprintf("buffer min %d max %d", st.minDepth, st.maxDepth),
+		fmt.Sprintf("extrapolating %d", st.extrapolating),
+	}
+	for i, line := range lines {
+		text.Draw(screen, line, arcadeFont, 10, 20+i*14, color.Black)
 	}
 }
 
@@ -364,10 +390,27 @@ func InitPlayer(username string, isMine bool) PlayerInfo {
 	return player
 }
 
+// drawPlayer サーバーから届いた色で塗り、スキンに合わせて描き方を変える
 func (g *Game) drawPlayer(screen *ebiten.Image, player PlayerInfo) {
+	look := player.look.Normalized()
+	c, _ := protocol.FindColor(look.Color)
+	alpha := 1.0
+
 	op := &ebiten.DrawImageOptions{}
+	switch look.Skin {
+	case "mirror":
+		op.GeoM.Scale(-1, 1)
+		op.GeoM.Translate(sim.PlayerWidth, 0)
+	case "ghost":
+		alpha = 0.5
+	}
+	if player.status != "" {
+		// 凍結中で当たらないので薄く描く
+		alpha *= 0.4
+		text.Draw(screen, player.status, arcadeFont, player.x+20, player.y-4, hudDead)
+	}
 	op.GeoM.Translate(float64(player.x), float64(player.y))
-	op.ColorM.Scale(0, 0.99, 0.89, 1) // この例では、赤はそのまま、緑は0.99倍、青は0.89倍にスケーリングされます。
+	op.ColorM.Scale(float64(c.R)/0xff, float64(c.G)/0xff, float64(c.B)/0xff, alpha)
 	op.Filter = ebiten.FilterLinear
 	screen.DrawImage(playerImg, op)
 }
@@ -408,51 +451,38 @@ func (g *Game) drawWall(screen *ebiten.Image) {
 	screen.DrawImage(wallImg, op)
 }
 
-func (g *Game) isPlayerCollidingWithWall() bool {
-	playerRight := float64(g.myPlayer.x + playerImg.Bounds().Dx())
-	playerBottom := float64(g.myPlayer.y + playerImg.Bounds().Dy())
-
-	// 左側の壁との衝突
-	if float64(g.myPlayer.x) < g.wall.leftX+float64(wallWidth) {
-		return true
+// collisions 自分のプレイヤーがぶつかっているもの。先頭が死因になる
+// サーバーと同じ形と順番で判定する
+func (g *Game) collisions() []sim.Event {
+	g.grid.Reset()
+	for _, c := range g.obstacles() {
+		g.grid.Insert(c)
 	}
-	// 右側の壁との衝突
-	if playerRight > g.wall.rightX {
-		return true
-	}
-	// 上側の壁との衝突
-	if float64(g.myPlayer.y) < g.wall.topY+float64(wallHeight) {
-		return true
-	}
-	// 下側の壁との衝突
-	if playerBottom > g.wall.bottomY {
-		return true
-	}
-	return false
+	return g.grid.Collisions(g.myCollider())
 }
 
-func (g *Game) isPlayerCollidingWithOtherPlayers() bool {
-	px1, py1, px2, py2 := g.myPlayer.bounds()
-
-	for _, otherPlayer := range g.players {
-		if otherPlayer.isMine {
+// obstacles 自分のプレイヤーがぶつかるもの。壁・NPC・他のプレイヤーの順で、先にあるものほど優先する死因
+func (g *Game) obstacles() []sim.Collider {
+	inner := sim.Rect{X1: g.wall.leftX + wallWidth, Y1: g.wall.topY + wallHeight, X2: g.wall.rightX, Y2: g.wall.bottomY}
+	colliders := sim.WallColliders(inner)
+	for _, npc := range g.npcs {
+		colliders = append(colliders, sim.Collider{Pos: npc.pos(), Shape: sim.NPCHitbox, Cause: protocol.CauseNPC})
+	}
+	for _, other := range g.players {
+		if other.isMine {
 			continue
 		}
-
-		ox1, oy1, ox2, oy2 := otherPlayer.bounds()
-		if px1 < ox2 && px2 > ox1 && py1 < oy2 && py2 > oy1 {
-			return true
-		}
+		colliders = append(colliders, sim.Collider{Pos: other.pos(), Shape: sim.PlayerHitbox, Cause: protocol.CausePlayer})
 	}
-	return false
+	return colliders
+}
+
+func (g *Game) myCollider() sim.Collider {
+	return sim.Collider{Pos: g.myPlayer.pos(), Shape: sim.PlayerHitbox}
 }
 
-func (p *PlayerInfo) bounds() (x1, y1, x2, y2 int) {
-	x1 = p.x
-	y1 = p.y
-	x2 = p.x + playerWidth
-	y2 = p.y + playerHeight
-	return
+func (p *PlayerInfo) pos() protocol.Position {
+	return protocol.Position{X: float64(p.x), Y: float64(p.y)}
 }
 
 // Layout method
@@ -476,44 +506,140 @@ func repeatingKeyPressed(key ebiten.Key) bool {
 	return false
 }
 
-func (g *Game) isKeySpaceJustPressed() bool {
-	if inpututil.IsKeyJustPressed(ebiten.KeySpace) {
-		return true
+func main() {
+	settingsPath := flag.String("settings", defaultSettingsPath(), "settings file")
+	server := flag.String("server", "", "server URL for this run (overrides "+serverEnv+" and the settings file)")
+	name := flag.String("name", "", "username to prefill for this run (overrides the settings file)")
+	lang := flag.String("lang", "", "UI language, en or ja (overrides the settings file)")
+	volume := flag.Float64("volume", 0, "volume from 0 to 1 for this run (overrides the settings file)")
+	windowWidth := flag.Int("window-width", 0, "window width for this run (overrides the settings file)")
+	windowHeight := flag.Int("window-height", 0, "window height for this run (overrides the settings file)")
+	interpDelay := flag.Duration("interp-delay", defaultInterpDelay, "how far in the past other players and NPCs are rendered (overrides the settings file)")
+	lookColor := flag.String("color", "", "player color to save on the server when logging in (e.g. sky, coral)")
+	lookSkin := flag.String("skin", "", "player skin to save on the server when logging in (e.g. mirror)")
+	record := flag.String("record", "", "record actions to this file")
+	replay := flag.String("replay", "", "play back actions recorded with -record")
+	debugFlag := flag.Bool("debug", debug, "show hitboxes and frame stats (toggle in game with F4)")
+	netsimConfig.RegisterFlags(flag.CommandLine)
+	flag.Parse()
+	if err := netsimConfig.Validate(); err != nil {
+		log.Fatalf("netsim: %v", err)
 	}
-	return false
-}
 
-func (g *Game) isKeyEnterJustPressed() bool {
-	if inpututil.IsKeyJustPressed(ebiten.KeyEnter) {
-		return true
+	store := openSettings(*settingsPath)
+	s := store.saved
+	// 保存する設定と共有しないように複製しておく
+	s.Servers = slices.Clone(s.Servers)
+	s.Bindings = maps.Clone(s.Bindings)
+	// 環境変数と、指定されたフラグだけ、この実行の間だけ上書きする
+	if url := os.Getenv(serverEnv); url != "" {
+		s.ServerURL = url
+	}
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "server":
+			s.ServerURL = *server
+		case "name":
+			s.Username = *name
+		case "lang":
+			s.Language = *lang
+		case "volume":
+			s.Volume = *volume
+		case "window-width":
+			s.WindowWidth = *windowWidth
+		case "window-height":
+			s.WindowHeight = *windowHeight
+		case "interp-delay":
+			s.InterpDelayMillis = interpDelay.Milliseconds()
+		}
+	})
+	s.normalize()
+
+	sfx = newAudioPlayer(s.Volume)
+	g := NewGame(s, store)
+	g.appearance = protocol.Appearance{Color: *lookColor, Skin: *lookSkin}
+	g.debug.enabled = *debugFlag
+	if *replay != "" {
+		rp, err := openInputReplay(*replay)
+		if err != nil {
+			log.Fatalf("replay: %v", err)
+		}
+		g.input.replay = rp
+	}
+	if *record != "" {
+		rec, err := newInputRecorder(*record)
+		if err != nil {
+			log.Fatalf("record: %v", err)
+		}
+		g.input.recorder = rec
 	}
-	return false
-}
 
-func main() {
-	ebiten.SetWindowSize(screenX, screenY)
+	ebiten.SetWindowSize(s.WindowWidth, s.WindowHeight)
+	ebiten.SetWindowResizable(true)
 	ebiten.SetWindowTitle("Dinosaur Jump")
-	if err := ebiten.RunGame(NewGame()); err != nil {
+	err := ebiten.RunGame(g)
+	g.saveWindowSize()
+	if g.input.recorder != nil {
+		if err := g.input.recorder.Close(); err != nil {
+			log.Printf("record: %v", err)
+		}
+	}
+	if err != nil && !errors.Is(err, errQuit) {
 		log.Fatal(err)
 	}
 }
 
-type User struct {
-	Name      string `json:"name"`
-	HighScore int    `json:"highScore"`
+// saveWindowSize ウィンドウの大きさがドラッグで変えられていたら保存する
+func (g *Game) saveWindowSize() {
+	w, h := g.windowWidth, g.windowHeight
+	if w == 0 || (w == g.settings.WindowWidth && h == g.settings.WindowHeight) {
+		return
+	}
+	g.changeSettings(func(st *settings) { st.WindowWidth, st.WindowHeight = w, h })
 }
 
-func getUserData() ([]User, error) {
-	resp, err := http.Get("http://localhost:8080/users/get")
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
+// setServerURL 接続するサーバーを変える。次にログインしたときから使われる
+func setServerURL(url string) {
+	serverURL = url
+	api = apiclient.New(url)
+}
 
-	var users []User
-	if err := json.NewDecoder(resp.Body).Decode(&users); err != nil {
-		return nil, err
-	}
+func getUserData(client *apiclient.Client) ([]protocol.UserRankingResponse, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	return client.GetUserRanking(ctx)
+}
 
-	return users, nil
+type rankingResult struct {
+	ranking []protocol.UserRankingResponse
+	err     error
+}
+
+// fetchRanking ランキングの取得を始める。Update を止めないよう別のgoroutineで取得し、pollRanking で反映する
+// 取得中にもう一度呼ばれたら、前の結果は捨てて新しいほうを使う
+func (g *Game) fetchRanking() {
+	result := make(chan rankingResult, 1)
+	g.rankingFetch = result
+	client := api
+	go func() {
+		ranking, err := getUserData(client)
+		result <- rankingResult{ranking: ranking, err: err}
+	}()
+}
+
+// pollRanking ランキングの取得が終わっていれば反映する
+func (g *Game) pollRanking() {
+	if g.rankingFetch == nil {
+		return
+	}
+	select {
+	case res := <-g.rankingFetch:
+		g.rankingFetch = nil
+		if res.err != nil {
+			log.Printf("failed to get ranking: %v", res.err)
+			return
+		}
+		g.ranking = res.ranking
+	default:
+	}
 }
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/rand"
+	"net"
+	"time"
+
+	"github.com/eiei114/dinosaur-jump/protocol"
+	"github.com/eiei114/dinosaur-jump/protocol/apiclient"
+	"github.com/eiei114/dinosaur-jump/protocol/netsim"
+	"golang.org/x/net/websocket"
+)
+
+// netsimConfig 設定されていれば、Welcome の後のやり取りに遅延やパケットロスを加える
+var netsimConfig netsim.Config
+
+// session サーバーとのリアルタイム通信1本分
+// 受信はgoroutineで行い、Game.Update から incoming を読んで反映する
+type session struct {
+	ws *websocket.Conn
+	// token ログインしたユーザーの認証トークン。再接続に使う
+	token    string
+	welcome  *protocol.Welcome
+	incoming chan interface{} // protocol.Message か *protocol.EntitySnapshot
+	closed   chan struct{}
+	decoder  protocol.SnapshotDecoder
+
+	// out, in netsimConfig が設定されているときの送信・受信の回線
+	out, in *netsim.Link
+}
+
+// login ユーザーを作成してリアルタイム通信に接続する
+// look が空でなければ、接続する前に色とスキンをサーバーに保存する。解除していないものなら既定の見た目のまま遊ぶ
+func login(name string, look protocol.Appearance) (*session, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	user, err := api.CreateUser(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if look != (protocol.Appearance{}) {
+		authed := apiclient.New(serverURL, apiclient.WithToken(user.Token))
+		if _, err := authed.UpdateAppearance(ctx, look); err != nil {
+			log.Printf("failed to update appearance: %v", err)
+		}
+	}
+	return dialSession(user.Token, "", "")
+}
+
+// dialSession resume に前回の Welcome.ResumeToken を指定すると、切断前のプレイヤーとして再開する
+func dialSession(token, room, resume string) (*session, error) {
+	cfg, err := websocket.NewConfig(protocol.RealtimeURL(serverURL), serverURL)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Dialer = &net.Dialer{Timeout: 3 * time.Second}
+	ws, err := websocket.DialConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &session{
+		ws:       ws,
+		token:    token,
+		incoming: make(chan interface{}, 256),
+		closed:   make(chan struct{}),
+	}
+	if err := s.send(&protocol.Hello{Version: protocol.Version, Token: token, Room: room, Resume: resume}); err != nil {
+		ws.Close()
+		return nil, err
+	}
+
+	// 最初にWelcomeかErrorが届く
+	ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var data []byte
+	if err := websocket.Message.Receive(ws, &data); err != nil {
+		ws.Close()
+		return nil, err
+	}
+	msg, err := protocol.Decode(data)
+	if err != nil {
+		ws.Close()
+		return nil, err
+	}
+	switch m := msg.(type) {
+	case *protocol.Welcome:
+		s.welcome = m
+	case *protocol.Error:
+		ws.Close()
+		return nil, errors.New(m.Code + ": " + m.Message)
+	default:
+		ws.Close()
+		return nil, errors.New("unexpected message: " + string(msg.MessageType()))
+	}
+	ws.SetReadDeadline(time.Time{})
+
+	if netsimConfig.Enabled() {
+		s.out = netsim.NewLink(netsimConfig, func(data []byte) { s.write(data) })
+		s.in = netsim.NewLink(netsimConfig, s.handle)
+	}
+	go s.readLoop()
+	return s, nil
+}
+
+const (
+	reconnectInitialBackoff = 250 * time.Millisecond
+	reconnectMaxBackoff     = 4 * time.Second
+)
+
+// reconnectResult 再接続を試みた結果
+type reconnectResult struct {
+	session *session
+	err     error
+}
+
+// reconnect 切れたセッションを再開する
+// 失敗したら間隔を倍にしながら、サーバーが待ってくれる猶予の間だけ繰り返す
+func reconnect(old *session) (*session, error) {
+	deadline := time.Now().Add(time.Duration(old.welcome.ResumeGraceMillis) * time.Millisecond)
+	backoff := reconnectInitialBackoff
+	for {
+		s, err := dialSession(old.token, old.welcome.Room, old.welcome.ResumeToken)
+		if err == nil {
+			return s, nil
+		}
+		// 同時に切れたクライアントが一斉に再接続しないように揺らす
+		wait := backoff/2 + time.Duration(rand.Int63n(int64(backoff)))
+		if time.Now().Add(wait).After(deadline) {
+			return nil, err
+		}
+		log.Printf("reconnect failed, retrying in %v: %v", wait.Round(time.Millisecond), err)
+		time.Sleep(wait)
+		backoff = min(backoff*2, reconnectMaxBackoff)
+	}
+}
+
+func (s *session) send(msg protocol.Message) error {
+	data, err := protocol.Encode(msg)
+	if err != nil {
+		return err
+	}
+	if s.out != nil {
+		// 入力と受信確認は失われても次のもので取り戻せるので、ロスや順序の入れ替わりの対象にする
+		switch msg.(type) {
+		case *protocol.Input, *protocol.SnapshotAck:
+			s.out.Send(data, false)
+		default:
+			s.out.Send(data, true)
+		}
+		return nil
+	}
+	return s.write(data)
+}
+
+func (s *session) write(data []byte) error {
+	return websocket.Message.Send(s.ws, string(data))
+}
+
+func (s *session) close() {
+	s.ws.Close()
+}
+
+// isClosed 接続が切れたか
+func (s *session) isClosed() bool {
+	select {
+	case <-s.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *session) readLoop() {
+	defer close(s.closed)
+	if s.in != nil {
+		defer s.in.Close()
+		defer s.out.Close()
+	}
+
+	for {
+		var data []byte
+		if err := websocket.Message.Receive(s.ws, &data); err != nil {
+			log.Printf("realtime connection closed: %v", err)
+			return
+		}
+		if s.in != nil {
+			s.in.Send(data, !protocol.IsEntitySnapshot(data))
+			continue
+		}
+		s.handle(data)
+	}
+}
+
+// handle 受信したフレームをデコードして Game.Update に渡す
+func (s *session) handle(data []byte) {
+	if protocol.IsEntitySnapshot(data) {
+		snap, err := s.decoder.Decode(data)
+		if err != nil {
+			// 基準がないときは受信確認を送らずにいればフルスナップショットが届く
+			return
+		}
+		s.send(&protocol.SnapshotAck{Seq: snap.Seq})
+		s.push(snap)
+		return
+	}
+
+	msg, err := protocol.Decode(data)
+	if err != nil {
+		log.Printf("ignoring malformed message: %v", err)
+		return
+	}
+	s.push(msg)
+}
+
+// push 受信したものを Game.Update に渡す。詰まっていたら古いものから捨てる
+func (s *session) push(v interface{}) {
+	for {
+		select {
+		case s.incoming <- v:
+			return
+		default:
+			select {
+			case <-s.incoming:
+			default:
+			}
+		}
+	}
+}
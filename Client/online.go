@@ -0,0 +1,186 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/eiei114/dinosaur-jump/protocol"
+)
+
+// startOnline ログインに成功したらオンラインの部屋でプレイする
+// 再接続したものの再開できなかった場合も、新しい参加としてここから始め直す
+func (g *Game) startOnline(s *session) {
+	g.online = s
+	g.myID = s.welcome.PlayerID
+	g.names = make(map[uint32]string)
+	g.looks = make(map[uint32]protocol.Appearance)
+	g.roomRanking = nil
+	g.pred = predictor{movement: s.welcome.Movement}
+	g.hasSnapshot = false
+	g.interp = newInterpolator(g.settings.interpDelay(), s.welcome.TickRate)
+	g.idleTimeout = time.Duration(s.welcome.IdleTimeoutMillis) * time.Millisecond
+	g.maxPause = time.Duration(s.welcome.MaxPauseMillis) * time.Millisecond
+	g.pauseLeft = g.maxPause
+	g.selfPaused = false
+	g.markMoved()
+}
+
+// updateOnline オンライン時の1フレーム分の更新
+// 自分の入力はすぐに予測に反映し、他のプレイヤーとNPCは少し過去の状態を補間して表示する
+func (g *Game) updateOnline(in protocol.Input) {
+	if (!in.IsEmpty() || g.pred.moving()) && g.hasSnapshot {
+		if !in.IsEmpty() {
+			g.markMoved()
+		}
+		in.ViewTick = g.interp.viewTick()
+		sent := g.pred.apply(in)
+		if err := g.online.send(&sent); err != nil {
+			log.Printf("failed to send input: %v", err)
+		}
+	}
+
+	g.drainOnline()
+	if g.online == nil {
+		return
+	}
+
+	g.pred.update()
+	pos := g.pred.displayPosition()
+	g.myPlayer.x = int(pos.X)
+	g.myPlayer.y = int(pos.Y)
+
+	g.interp.advance(time.Now())
+	g.players = g.players[:0]
+	g.npcs = g.npcs[:0]
+	g.interp.each(func(id uint32, pos protocol.Position, flags protocol.EntityFlags) {
+		info := PlayerInfo{
+			x:        int(pos.X),
+			y:        int(pos.Y),
+			id:       int(id),
+			username: g.names[id],
+			look:     g.looks[id],
+		}
+		switch {
+		case flags&protocol.EntityDisconnected != 0:
+			info.status = tr("player.offline")
+		case flags&protocol.EntityPaused != 0:
+			info.status = tr("player.paused")
+		}
+		switch {
+		case flags&protocol.EntityNPC != 0:
+			g.npcs = append(g.npcs, info)
+		case flags&protocol.EntityDead == 0:
+			g.players = append(g.players, info)
+		}
+	})
+}
+
+// drainOnline 受信済みのメッセージとスナップショットをすべて反映する
+func (g *Game) drainOnline() {
+	for {
+		select {
+		case v := <-g.online.incoming:
+			g.receive(v)
+		default:
+			if g.online.isClosed() {
+				g.startReconnect()
+			}
+			return
+		}
+	}
+}
+
+// startReconnect 接続が切れたら裏で再接続を始める。再開できない設定のサーバーならオフラインに切り替える
+func (g *Game) startReconnect() {
+	old := g.online
+	if old.welcome.ResumeGraceMillis <= 0 {
+		log.Printf("lost connection to server, switching to offline play")
+		g.online = nil
+		g.gameOver("")
+		return
+	}
+
+	log.Printf("lost connection to server, reconnecting")
+	result := make(chan reconnectResult, 1)
+	g.reconnecting = result
+	go func() {
+		s, err := reconnect(old)
+		result <- reconnectResult{session: s, err: err}
+	}()
+}
+
+// pollReconnect 再接続が終わっていれば結果を反映する。再接続中ならtrueを返す
+func (g *Game) pollReconnect() bool {
+	if g.reconnecting == nil {
+		return false
+	}
+	select {
+	case res := <-g.reconnecting:
+		g.reconnecting = nil
+		switch {
+		case res.err != nil:
+			log.Printf("failed to reconnect, switching to offline play: %v", res.err)
+			g.online = nil
+			g.gameOver("")
+		case res.session.welcome.Resumed:
+			log.Printf("resumed session in room %s", res.session.welcome.Room)
+			g.online = res.session
+			// サーバーも再開した時点から放置の判定を数え直している
+			g.markMoved()
+			// 切断中に送れなかった入力があるので、次のスナップショットで予測をやり直す
+			g.hasSnapshot = false
+		default:
+			log.Printf("could not resume, joined room %s as a new player", res.session.welcome.Room)
+			g.beginRun()
+			g.timePassed = 0
+			g.startOnline(res.session)
+			g.scenes.Replace(newGameScene(g))
+		}
+		return false
+	default:
+		return true
+	}
+}
+
+func (g *Game) receive(v interface{}) {
+	switch m := v.(type) {
+	case *protocol.EntitySnapshot:
+		g.applySnapshot(m)
+	case *protocol.Snapshot:
+		for _, p := range m.Players {
+			g.names[p.ID] = p.Name
+			g.looks[p.ID] = p.Appearance
+			if p.ID == g.myID {
+				g.myPlayer.look = p.Appearance
+			}
+		}
+	case *protocol.Death:
+		if m.PlayerID == g.myID {
+			g.gameOver(m.Cause)
+		}
+	case *protocol.Ranking:
+		g.setRoomRanking(m)
+	case *protocol.RunResult:
+		g.runResult = m
+		// 今回の結果が反映されたランキングを取り直す
+		g.fetchRanking()
+	case *protocol.Error:
+		log.Printf("server error: %s: %s", m.Code, m.Message)
+	}
+}
+
+// applySnapshot 自分の位置はサーバーと突き合わせ、それ以外は補間用のバッファに積む
+func (g *Game) applySnapshot(snap *protocol.EntitySnapshot) {
+	for _, e := range snap.Entities {
+		if e.ID != g.myID {
+			continue
+		}
+		if !g.hasSnapshot || e.Flags&protocol.EntityDead != 0 {
+			g.pred.reset(e.Position)
+			g.hasSnapshot = true
+		}
+		g.pred.reconcile(e.Position, snap.Velocity, snap.LastInput)
+		g.selfPaused = e.Flags&protocol.EntityPaused != 0
+	}
+	g.interp.push(snap, g.myID)
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/eiei114/dinosaur-jump/protocol"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+)
+
+const (
+	// interpDelayStep 設定画面で補間の遅れを1回に変える量
+	interpDelayStep = 25 * time.Millisecond
+	maxInterpDelay  = 500 * time.Millisecond
+
+	volumeStep   = 0.1
+	deadZoneStep = 0.05
+
+	// optionLabelLength 設定画面の1行に表示する最大文字数
+	optionLabelLength = 34
+)
+
+// windowSizes 設定画面で選べるウィンドウの大きさ(正方形の一辺)
+var windowSizes = []int{480, 640, 800, 960}
+
+// option 設定画面の1項目
+type option struct {
+	label func() string
+	// change 左右キーで値を変える。dir は -1 か 1。nilなら左右では変えない
+	change func(dir int)
+	// activate 決定したとき
+	activate func()
+}
+
+// optionsScene 設定画面。タイトルとポーズメニューから開き、変えた設定はすぐに保存する
+type optionsScene struct {
+	overlayScene
+	g       *Game
+	menu    menu
+	options []option
+
+	// editing nilでなければ文字を入力していて、Enter で commit に渡す
+	editing *textEdit
+}
+
+// textEdit メニューの項目の中での1行の文字入力
+type textEdit struct {
+	textField
+	commit func(string)
+}
+
+func newTextEdit(value string, maxLength int, commit func(string)) *textEdit {
+	return &textEdit{textField: *newTextField(value, "", maxLength), commit: commit}
+}
+
+// update 1フレーム分の入力を反映する。Enter で commit を呼び、Esc で取り消す。どちらかなら終わったのでtrue
+func (e *textEdit) update() bool {
+	if inpututil.IsKeyJustPressed(ebiten.KeyEscape) {
+		return true
+	}
+	if e.textField.update() {
+		e.commit(e.String())
+		return true
+	}
+	return false
+}
+
+func newOptionsScene(g *Game) *optionsScene {
+	s := &optionsScene{g: g}
+	s.options = []option{
+		{
+			label: func() string { return tr("options.name", g.settings.Username) },
+			activate: func() {
+				s.edit(g.settings.Username, maxUsernameLength, func(v string) {
+					g.changeSettings(func(st *settings) { st.Username = strings.TrimSpace(v) })
+				})
+			},
+		},
+		{
+			label:    func() string { return tr("options.server", g.settings.currentServer().String()) },
+			activate: func() { g.scenes.Push(newServersScene(g)) },
+		},
+		{
+			label: func() string { return tr("options.language", languageName(g.settings.Language)) },
+			change: func(dir int) {
+				lang := nextLanguage(g.settings.Language, dir)
+				g.changeSettings(func(st *settings) { st.Language = lang })
+				g.applySettings()
+			},
+		},
+		{
+			label: func() string {
+				return tr("options.window", fmt.Sprintf("%dx%d", g.settings.WindowWidth, g.settings.WindowHeight))
+			},
+			change: s.changeWindowSize,
+		},
+		{
+			label: func() string { return tr("options.volume", int(g.settings.Volume*100+0.5)) },
+			change: func(dir int) {
+				v := min(max(g.settings.Volume+float64(dir)*volumeStep, 0), 1)
+				g.changeSettings(func(st *settings) { st.Volume = v })
+				// 変えた音量で鳴らして確かめられるようにする
+				sfx.play(soundSelect)
+			},
+		},
+		{
+			label: func() string { return tr("options.interpDelay", g.settings.InterpDelayMillis) },
+			change: func(dir int) {
+				d := min(max(g.settings.interpDelay()+time.Duration(dir)*interpDelayStep, 0), maxInterpDelay)
+				g.changeSettings(func(st *settings) { st.InterpDelayMillis = d.Milliseconds() })
+				g.applySettings()
+			},
+		},
+		{
+			label:    func() string { return tr("options.netStats", onOff(g.settings.ShowNetStats)) },
+			activate: func() { g.setShowNetStats(!g.settings.ShowNetStats) },
+		},
+		{
+			label: func() string { return tr("options.deadZone", int(g.settings.DeadZone*100+0.5)) },
+			change: func(dir int) {
+				v := min(max(g.settings.DeadZone+float64(dir)*deadZoneStep, 0), maxDeadZone)
+				g.changeSettings(func(st *settings) { st.DeadZone = v })
+			},
+		},
+		{
+			label:    func() string { return tr("options.controls") },
+			activate: func() { g.scenes.Push(newControlsScene(g)) },
+		},
+		{
+			label:    func() string { return tr("menu.back") },
+			activate: func() { g.scenes.Pop() },
+		},
+	}
+	s.menu.items = make([]string, len(s.options))
+	s.refresh()
+	return s
+}
+
+func (s *optionsScene) edit(value string, maxLength int, commit func(string)) {
+	s.editing = newTextEdit(value, maxLength, commit)
+}
+
+// changeWindowSize windowSizes の中で次(前)の大きさにする
+func (s *optionsScene) changeWindowSize(dir int) {
+	g := s.g
+	i := 0
+	for j, size := range windowSizes {
+		if size <= g.settings.WindowWidth {
+			i = j
+		}
+	}
+	size := windowSizes[(i+dir+len(windowSizes))%len(windowSizes)]
+	g.changeSettings(func(st *settings) { st.WindowWidth, st.WindowHeight = size, size })
+	ebiten.SetWindowSize(size, size)
+}
+
+// refresh 項目の表示を今の設定に合わせる
+func (s *optionsScene) refresh() {
+	for i, o := range s.options {
+		label := o.label()
+		if s.editing != nil && i == s.menu.cursor {
+			label = labelName(label) + s.editing.withCursor()
+		}
+		if r := []rune(label); len(r) > optionLabelLength {
+			// 長いものは後ろを見せる
+			label = "..." + string(r[len(r)-optionLabelLength+3:])
+		}
+		s.menu.items[i] = label
+	}
+}
+
+// labelName "NAME: value" の "NAME: " の部分
+func labelName(label string) string {
+	for i := 0; i+1 < len(label); i++ {
+		if label[i] == ':' && label[i+1] == ' ' {
+			return label[:i+2]
+		}
+	}
+	return label
+}
+
+func (s *optionsScene) Update() error {
+	g := s.g
+	if !g.pollReconnect() && g.online != nil {
+		g.updateOnline(protocol.Input{})
+	}
+	if g.scenes.Current() != s {
+		return nil
+	}
+	defer s.refresh()
+
+	if s.editing != nil {
+		if s.editing.update() {
+			s.editing = nil
+		}
+		return nil
+	}
+
+	if g.input.justPressed(actionCancel) {
+		g.scenes.Pop()
+		return nil
+	}
+	o := s.options[s.menu.cursor]
+	if o.change != nil {
+		switch {
+		case g.input.justPressed(actionMoveLeft):
+			o.change(-1)
+		case g.input.justPressed(actionMoveRight):
+			o.change(1)
+		}
+	}
+	if i := s.menu.update(&g.input); i >= 0 {
+		if o := s.options[i]; o.activate != nil {
+			o.activate()
+		} else if o.change != nil {
+			o.change(1)
+		}
+	}
+	return nil
+}
+
+func (s *optionsScene) Draw(screen *ebiten.Image) {
+	note := tr("options.note")
+	if s.editing != nil {
+		note = tr("options.editNote")
+	}
+	s.menu.draw(screen, tr("options.title"), note)
+}
+
+// setShowNetStats 通信の状況の表示を切り替えて保存する
+func (g *Game) setShowNetStats(show bool) {
+	g.changeSettings(func(st *settings) { st.ShowNetStats = show })
+}
+
+func onOff(b bool) string {
+	if b {
+		return tr("options.on")
+	}
+	return tr("options.off")
+}
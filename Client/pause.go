@@ -0,0 +1,209 @@
+package main
+
+import (
+	"errors"
+	"image/color"
+	"log"
+	"time"
+
+	"github.com/eiei114/dinosaur-jump/protocol"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"github.com/hajimehoshi/ebiten/v2/text"
+)
+
+// errQuit ポーズメニューで終了を選んだときに Update から返し、RunGame を終わらせる
+var errQuit = errors.New("quit")
+
+const (
+	menuWidth      = 400
+	menuLineHeight = 24
+)
+
+var (
+	menuDim        = color.RGBA{0x00, 0x00, 0x00, 0x80}
+	menuBackground = color.RGBA{0xff, 0xff, 0xff, 0xf0}
+)
+
+// menu 上下の操作で選んで決定する縦並びのメニュー
+type menu struct {
+	items  []string
+	cursor int
+}
+
+// update カーソルを動かし、決定された項目の番号を返す。決定されなければ-1
+func (m *menu) update(in *input) int {
+	switch {
+	case in.justPressed(actionMoveUp):
+		m.cursor = (m.cursor + len(m.items) - 1) % len(m.items)
+		sfx.play(soundSelect)
+	case in.justPressed(actionMoveDown):
+		m.cursor = (m.cursor + 1) % len(m.items)
+		sfx.play(soundSelect)
+	case in.justPressed(actionConfirm):
+		sfx.play(soundConfirm)
+		return m.cursor
+	}
+	return -1
+}
+
+// draw 画面を暗くして中央にタイトルと項目を描く。notes は項目の下に小さく出す
+func (m *menu) draw(screen *ebiten.Image, title string, notes ...string) {
+	w, h := screen.Size()
+	ebitenutil.DrawRect(screen, 0, 0, float64(w), float64(h), menuDim)
+
+	height := (len(m.items)+len(notes)+2)*menuLineHeight + hudMargin
+	x, y := (w-menuWidth)/2, (h-height)/2
+	ebitenutil.DrawRect(screen, float64(x), float64(y), menuWidth, float64(height), menuBackground)
+
+	tx, ty := x+menuLineHeight, y+menuLineHeight
+	text.Draw(screen, title, arcadeFont, tx, ty, color.Black)
+	ty += menuLineHeight / 2
+	for i, item := range m.items {
+		ty += menuLineHeight
+		clr := color.Color(color.Black)
+		if i == m.cursor {
+			clr = hudHighlight
+			text.Draw(screen, ">", arcadeFont, tx-14, ty, clr)
+		}
+		text.Draw(screen, item, arcadeFont, tx, ty, clr)
+	}
+	ty += menuLineHeight / 2
+	for _, note := range notes {
+		ty += menuLineHeight
+		text.Draw(screen, note, arcadeFont, tx, ty, hudDead)
+	}
+}
+
+// pauseConfirmWait ポーズを送ってから、サーバーが受け付けたかを判断するまで待つ時間
+const pauseConfirmWait = 500 * time.Millisecond
+
+// pauseScene ゲーム中に Esc で開くメニュー
+// オフラインでは下のゲームが止まる。オンラインでは部屋は止まらないので、
+// サーバーにポーズを伝えて MaxPause の残りの間だけ放置と衝突の判定から外してもらう
+type pauseScene struct {
+	overlayScene
+	g        *Game
+	menu     menu
+	pausedAt time.Time
+	// confirmed サーバーがポーズを受け付けた(自分が EntityPaused になった)
+	confirmed bool
+}
+
+const (
+	pauseResume = iota
+	pauseOptions
+	pauseTitle
+	pauseQuit
+)
+
+func newPauseScene(g *Game) *pauseScene {
+	s := &pauseScene{g: g}
+	s.refresh()
+	return s
+}
+
+// refresh 設定画面で言語が変わっていることがあるので、項目を引き直す
+func (s *pauseScene) refresh() {
+	s.menu.items = []string{tr("pause.resume"), tr("pause.options"), tr("pause.returnToTitle"), tr("pause.quit")}
+}
+
+func (s *pauseScene) Enter() {
+	s.pausedAt = time.Now()
+	// 前のポーズのときの値が残っているので、次のスナップショットで確かめ直す
+	s.g.selfPaused = false
+	s.g.sendPause(true)
+}
+
+func (s *pauseScene) Exit() {
+	s.g.sendPause(false)
+	// ポーズ中は timePassed が進まないので、放置の判定はポーズした時点の続きになる。サーバーも同じように数える
+	if s.confirmed {
+		s.g.pauseLeft = max(s.g.pauseLeft-time.Since(s.pausedAt), 0)
+	}
+}
+
+func (s *pauseScene) Update() error {
+	g := s.g
+	// 部屋は進み続けるので、受信したものを反映しておく。自分は動かない
+	if !g.pollReconnect() && g.online != nil {
+		g.updateOnline(protocol.Input{})
+	}
+	if g.scenes.Current() != s {
+		// アウトになったか、再接続して新しく参加し直した
+		return nil
+	}
+	s.confirmed = s.confirmed || g.selfPaused
+	s.refresh()
+
+	if g.input.justPressed(actionCancel) || g.input.justPressed(actionPause) {
+		g.scenes.Pop()
+		return nil
+	}
+	switch s.menu.update(&g.input) {
+	case pauseResume:
+		g.scenes.Pop()
+	case pauseOptions:
+		g.scenes.Push(newOptionsScene(g))
+	case pauseTitle:
+		g.endRun()
+		g.leaveOnline()
+		g.scenes.Replace(newTitleScene(g))
+	case pauseQuit:
+		g.endRun()
+		g.leaveOnline()
+		return errQuit
+	}
+	return nil
+}
+
+func (s *pauseScene) Draw(screen *ebiten.Image) {
+	s.menu.draw(screen, tr("pause.title"), s.status())
+}
+
+// status オンラインなら、あとどれだけ放置と衝突の判定から守られるか
+func (s *pauseScene) status() string {
+	g := s.g
+	if g.online == nil {
+		return tr("pause.offline")
+	}
+	elapsed := time.Since(s.pausedAt)
+	if !s.confirmed && elapsed > pauseConfirmWait {
+		return tr("pause.refused")
+	}
+	remaining := g.pauseLeft - elapsed
+	if remaining <= 0 || (s.confirmed && !g.selfPaused) {
+		return tr("pause.unprotected")
+	}
+	return tr("pause.protected", int(remaining.Seconds())+1)
+}
+
+// sendPause オンラインならサーバーにポーズの開始・終了を伝える
+func (g *Game) sendPause(paused bool) {
+	if g.online == nil {
+		return
+	}
+	if paused {
+		// サーバーはポーズしたところで止める。止まるまで入力を送り続けないようにする
+		g.pred.stop()
+	}
+	if err := g.online.send(&protocol.Pause{Paused: paused}); err != nil {
+		log.Printf("failed to send pause: %v", err)
+	}
+}
+
+// leaveOnline 部屋から抜ける。再接続中ならつながり次第切る
+func (g *Game) leaveOnline() {
+	if g.online != nil {
+		g.online.close()
+		g.online = nil
+	}
+	if result := g.reconnecting; result != nil {
+		go func() {
+			if res := <-result; res.err == nil {
+				res.session.close()
+			}
+		}()
+		g.reconnecting = nil
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"math"
+	"time"
+
+	"github.com/eiei114/dinosaur-jump/protocol"
+	"github.com/eiei114/dinosaur-jump/protocol/sim"
+)
+
+const (
+	// correctionDecay 1フレームごとに表示上のずれを縮める割合
+	correctionDecay = 0.8
+	// snapDistance これ以上ずれていたら補間せずに一気に合わせる
+	snapDistance = 150.0
+)
+
+// predictor 自分のプレイヤーのクライアント側予測とサーバーとの突き合わせ
+// 入力はすぐに自分の位置へ反映してサーバーに送り、サーバーのスナップショットが届いたら
+// その位置からまだ処理されていない入力をやり直す
+type predictor struct {
+	nextSeq uint32
+	pending []protocol.Input
+	// sentAt pending を送った時刻
+	sentAt []time.Time
+	// rtt 入力を送ってから、処理済みだとスナップショットで分かるまでの時間。最後に測った値
+	// スナップショットを待つ分だけ、実際の往復時間より長めに出る
+	rtt time.Duration
+	// movement サーバーから Welcome で届いた動き方
+	movement protocol.Movement
+
+	// body サーバーの位置と速度に未処理の入力を適用した、予測上の正しい位置と速度
+	body sim.Body
+	// server 最後に届いたサーバーの位置と速度
+	server sim.Body
+	// offset 表示位置 - body.Pos。突き合わせで位置が飛んだ分を少しずつ0に戻す
+	offset protocol.Position
+}
+
+func (p *predictor) reset(pos protocol.Position) {
+	p.pending = p.pending[:0]
+	p.sentAt = p.sentAt[:0]
+	p.body = sim.Body{Pos: pos}
+	p.server = p.body
+	p.offset = protocol.Position{}
+}
+
+// moving 止まるまでは何も押していなくても入力を送る
+// 止まる入力が失われるとサーバーだけが動いたままになるので、サーバーが止まったと分かるまで送り続ける
+func (p *predictor) moving() bool {
+	return p.body.Moving() || p.server.Moving()
+}
+
+// stop その場で止まる。サーバーもポーズしたときに止めている
+func (p *predictor) stop() {
+	p.body.Vel = protocol.Velocity{}
+}
+
+// apply 入力に通し番号を付けて自分の位置にすぐ反映する。サーバーに送る入力を返す
+func (p *predictor) apply(in protocol.Input) protocol.Input {
+	p.nextSeq++
+	in.Seq = p.nextSeq
+	p.pending = append(p.pending, in)
+	p.sentAt = append(p.sentAt, time.Now())
+	p.body = sim.Step(p.body, &in, p.movement)
+	return in
+}
+
+// reconcile サーバーから届いた自分の位置と速度と、サーバーが処理済みの入力の番号で予測をやり直す
+func (p *predictor) reconcile(server protocol.Position, vel protocol.Velocity, lastInput uint32) {
+	displayed := p.displayPosition()
+
+	// 処理済みの入力を捨てる
+	i := 0
+	for i < len(p.pending) && p.pending[i].Seq <= lastInput {
+		i++
+	}
+	if i > 0 {
+		p.rtt = time.Since(p.sentAt[i-1])
+	}
+	p.pending = append(p.pending[:0], p.pending[i:]...)
+	p.sentAt = append(p.sentAt[:0], p.sentAt[i:]...)
+
+	p.server = sim.Body{Pos: server, Vel: vel}
+	predicted := p.server
+	for k := range p.pending {
+		predicted = sim.Step(predicted, &p.pending[k], p.movement)
+	}
+	p.body = predicted
+
+	// 見た目の位置は変えずに、ずれをoffsetに移して徐々に戻す
+	p.offset = protocol.Position{X: displayed.X - predicted.Pos.X, Y: displayed.Y - predicted.Pos.Y}
+	if math.Hypot(p.offset.X, p.offset.Y) > snapDistance {
+		p.offset = protocol.Position{}
+	}
+}
+
+// update 1フレーム分、表示上のずれを縮める
+func (p *predictor) update() {
+	p.offset.X *= correctionDecay
+	p.offset.Y *= correctionDecay
+	if math.Abs(p.offset.X) < 0.5 {
+		p.offset.X = 0
+	}
+	if math.Abs(p.offset.Y) < 0.5 {
+		p.offset.Y = 0
+	}
+}
+
+// displayPosition 描画に使う位置
+func (p *predictor) displayPosition() protocol.Position {
+	return protocol.Position{X: p.body.Pos.X + p.offset.X, Y: p.body.Pos.Y + p.offset.Y}
+}
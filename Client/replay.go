@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+)
+
+// 操作の記録
+//
+// キーやボタンではなく操作(action)を1フレームごとに記録するので、割り当てを変えても同じように再生できる。
+// 記録するのはプレイ1回(beginRun から endRun まで)ごとで、乱数のシードもプレイごとに記録して同じ展開を再現する。
+// タイトルやログイン画面はキーや入力した文字を直接読むので記録せず、再生中もその間は実際のキーで操作する。
+// オンラインのプレイは通信のタイミングが変わるので再現しない。
+//
+// フォーマット: 1行目にJSONのヘッダー、続いてプレイ1回ごとに
+// シード(8バイト) フレーム数(4バイト) 1フレームにつき actionSet(2バイト)。すべてリトルエンディアン
+
+// replayVersion 記録のフォーマットのバージョン
+const replayVersion = 2
+
+type replayHeader struct {
+	Version int `json:"version"`
+	// Actions ビットの順番に並べた操作の名前。再生するときは名前で対応付ける
+	Actions []string `json:"actions"`
+}
+
+// inputRecorder 操作をファイルに書き出す
+// フレーム数を先に書くので、プレイ1回分はメモリにためておき、プレイが終わったときにまとめて書き出す
+type inputRecorder struct {
+	f *os.File
+	w *bufio.Writer
+
+	// recording プレイ中だけtrue。seed と frames がそのプレイの記録
+	recording bool
+	seed      int64
+	frames    []actionSet
+}
+
+func newInputRecorder(path string) (*inputRecorder, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	r := &inputRecorder{f: f, w: bufio.NewWriter(f)}
+	header, err := json.Marshal(replayHeader{Version: replayVersion, Actions: actionNames[:]})
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	r.w.Write(append(header, '\n'))
+	return r, nil
+}
+
+// begin seed で始めるプレイの記録を始める。前のプレイが終わっていなければ書き出す
+func (r *inputRecorder) begin(seed int64) {
+	r.end()
+	r.recording = true
+	r.seed = seed
+	r.frames = r.frames[:0]
+}
+
+// write プレイ中ならこのフレームの操作を記録する
+func (r *inputRecorder) write(set actionSet) {
+	if r.recording {
+		r.frames = append(r.frames, set)
+	}
+}
+
+// end プレイが終わったので記録を書き出す
+func (r *inputRecorder) end() {
+	if !r.recording {
+		return
+	}
+	r.recording = false
+	var buf [12]byte
+	binary.LittleEndian.PutUint64(buf[:8], uint64(r.seed))
+	binary.LittleEndian.PutUint32(buf[8:], uint32(len(r.frames)))
+	r.w.Write(buf[:])
+	for _, set := range r.frames {
+		binary.LittleEndian.PutUint16(buf[:2], uint16(set))
+		r.w.Write(buf[:2])
+	}
+}
+
+func (r *inputRecorder) Close() error {
+	r.end()
+	if err := r.w.Flush(); err != nil {
+		r.f.Close()
+		return err
+	}
+	return r.f.Close()
+}
+
+// inputReplay 記録した操作をプレイごとに1フレームずつ返す
+type inputReplay struct {
+	r *bufio.Reader
+	f *os.File
+	// bits 記録のビット番号から今の操作への対応。知らない操作は-1
+	bits []action
+	// left 再生中のプレイの残りフレーム数。0ならプレイの外で、実際のキーを使う
+	left uint32
+}
+
+func openInputReplay(path string) (*inputReplay, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	r := bufio.NewReader(f)
+	line, err := r.ReadBytes('\n')
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("read replay header: %w", err)
+	}
+	var header replayHeader
+	if err := json.Unmarshal(line, &header); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("read replay header: %w", err)
+	}
+	if header.Version != replayVersion {
+		f.Close()
+		return nil, fmt.Errorf("unsupported replay version %d", header.Version)
+	}
+
+	rp := &inputReplay{r: r, f: f}
+	for _, name := range header.Actions {
+		var a action
+		if err := a.UnmarshalText([]byte(name)); err != nil {
+			log.Printf("replay: ignoring %v", err)
+			a = -1
+		}
+		rp.bits = append(rp.bits, a)
+	}
+	return rp, nil
+}
+
+// begin 次のプレイの記録を読み始め、そのシードを返す。もう記録がなければファイルを閉じてfalseを返す
+func (rp *inputReplay) begin() (int64, bool) {
+	rp.end()
+	var buf [12]byte
+	if _, err := io.ReadFull(rp.r, buf[:]); err != nil {
+		if !errors.Is(err, io.EOF) {
+			log.Printf("replay: %v", err)
+		}
+		log.Printf("replay finished")
+		rp.f.Close()
+		return 0, false
+	}
+	rp.left = binary.LittleEndian.Uint32(buf[8:])
+	return int64(binary.LittleEndian.Uint64(buf[:8])), true
+}
+
+// end プレイが終わった。記録より早く終わったら(再現できなかったら)残りを読み飛ばす
+func (rp *inputReplay) end() {
+	if rp.left > 0 {
+		log.Printf("replay: run ended %d frames early", rp.left)
+		rp.r.Discard(int(rp.left) * 2)
+		rp.left = 0
+	}
+}
+
+// playing プレイの記録を再生しているか
+func (rp *inputReplay) playing() bool {
+	return rp != nil && rp.left > 0
+}
+
+// next 再生中のプレイの次のフレームの操作。プレイの記録が終わっていればfalse
+func (rp *inputReplay) next() (actionSet, bool) {
+	if rp.left == 0 {
+		return 0, false
+	}
+	var buf [2]byte
+	if _, err := io.ReadFull(rp.r, buf[:]); err != nil {
+		log.Printf("replay: %v", err)
+		rp.left = 0
+		return 0, false
+	}
+	rp.left--
+	recorded := binary.LittleEndian.Uint16(buf[:])
+	var set actionSet
+	for bit, a := range rp.bits {
+		if a >= 0 && recorded&(1<<bit) != 0 {
+			set |= 1 << a
+		}
+	}
+	return set, true
+}
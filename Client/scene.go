@@ -0,0 +1,148 @@
+package main
+
+import (
+	"image/color"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+)
+
+// fadeFrames シーンを切り替えるときに暗転・明転にかけるフレーム数
+const fadeFrames = 15
+
+// Scene 1つの画面
+// 新しい画面を足すときは Scene を実装して sceneManager に積むだけでよい
+type Scene interface {
+	// Enter スタックに積まれたときに呼ばれる
+	Enter()
+	// Exit スタックから取り除かれるときに呼ばれる
+	Exit()
+	// Update 一番上にあるシーンだけが毎フレーム呼ばれる
+	Update() error
+	Draw(screen *ebiten.Image)
+}
+
+// Overlay ポーズや設定のように、下のシーンの上に重ねて表示するシーン
+// 下のシーンは描画だけされ、Update は呼ばれない
+type Overlay interface {
+	Scene
+	overlay()
+}
+
+// baseScene Enter と Exit で何もしないシーンに埋め込む
+type baseScene struct{}
+
+func (baseScene) Enter() {}
+func (baseScene) Exit()  {}
+
+// overlayScene Overlay にするシーンに埋め込む
+type overlayScene struct{ baseScene }
+
+func (overlayScene) overlay() {}
+
+// sceneManager シーンのスタック
+// Replace は暗転してから一番上のシーンを入れ替え、明転する。Push と Pop はすぐに切り替える
+type sceneManager struct {
+	stack []Scene
+
+	// next 暗転が終わったら一番上と入れ替えるシーン
+	next Scene
+	// fade 暗転・明転の残りフレーム数。正なら暗転中、負なら明転中
+	fade int
+}
+
+// Current 一番上のシーン。切り替えの途中なら切り替え先
+func (m *sceneManager) Current() Scene {
+	if m.next != nil {
+		return m.next
+	}
+	if len(m.stack) == 0 {
+		return nil
+	}
+	return m.stack[len(m.stack)-1]
+}
+
+// Push sを一番上に積む
+func (m *sceneManager) Push(s Scene) {
+	m.stack = append(m.stack, s)
+	s.Enter()
+}
+
+// Pop 一番上のシーンを取り除く
+func (m *sceneManager) Pop() {
+	if len(m.stack) == 0 {
+		return
+	}
+	top := m.stack[len(m.stack)-1]
+	m.stack = m.stack[:len(m.stack)-1]
+	top.Exit()
+}
+
+// Replace 暗転してから、重なっているOverlayごと一番上のシーンをsに入れ替える
+func (m *sceneManager) Replace(s Scene) {
+	if len(m.stack) == 0 {
+		m.Push(s)
+		return
+	}
+	if m.next == nil {
+		// 明転の途中なら、その暗さから暗転に切り替える
+		m.fade = fadeFrames - max(-m.fade, 0)
+	}
+	m.next = s
+}
+
+func (m *sceneManager) Update() error {
+	switch {
+	case m.fade > 0:
+		m.fade--
+		if m.fade == 0 {
+			m.swap()
+			m.fade = -fadeFrames
+		}
+		// 暗転中は入力を受け付けない
+		return nil
+	case m.fade < 0:
+		m.fade++
+	}
+	if top := m.Current(); top != nil {
+		return top.Update()
+	}
+	return nil
+}
+
+// swap 暗転し終わったので、重なっているOverlayとその下のシーンを取り除いて next を積む
+func (m *sceneManager) swap() {
+	for len(m.stack) > 0 {
+		_, isOverlay := m.stack[len(m.stack)-1].(Overlay)
+		m.Pop()
+		if !isOverlay {
+			break
+		}
+	}
+	next := m.next
+	m.next = nil
+	m.Push(next)
+}
+
+// Draw 一番上の不透明なシーンから上を順に描き、切り替え中なら暗くする
+func (m *sceneManager) Draw(screen *ebiten.Image) {
+	from := 0
+	for i := len(m.stack) - 1; i >= 0; i-- {
+		if _, ok := m.stack[i].(Overlay); !ok {
+			from = i
+			break
+		}
+	}
+	for _, s := range m.stack[from:] {
+		s.Draw(screen)
+	}
+
+	if m.fade != 0 {
+		alpha := float64(fadeFrames-m.fade) / fadeFrames
+		if m.fade < 0 {
+			alpha = float64(-m.fade) / fadeFrames
+		}
+		w, h := screen.Size()
+		ebitenutil.DrawRect(screen, 0, 0, float64(w), float64(h), color.RGBA{0, 0, 0, uint8(alpha * 0xff)})
+	}
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"image/color"
+	"log"
+	"strings"
+
+	"github.com/eiei114/dinosaur-jump/protocol"
+	"github.com/eiei114/dinosaur-jump/protocol/sim"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"github.com/hajimehoshi/ebiten/v2/text"
+)
+
+// titleScene スタート画面
+type titleScene struct {
+	baseScene
+	g *Game
+}
+
+func newTitleScene(g *Game) *titleScene {
+	return &titleScene{g: g}
+}
+
+func (s *titleScene) Update() error {
+	switch {
+	case s.g.input.justPressed(actionConfirm):
+		s.g.scenes.Replace(newLoginScene(s.g))
+	case inpututil.IsKeyJustPressed(ebiten.KeyO):
+		s.g.scenes.Push(newOptionsScene(s.g))
+	case inpututil.IsKeyJustPressed(ebiten.KeyV):
+		s.g.scenes.Push(newServersScene(s.g))
+	}
+	return nil
+}
+
+func (s *titleScene) Draw(screen *ebiten.Image) {
+	s.g.drawWorld(screen)
+	text.Draw(screen, tr("title.start"), arcadeFont, 245, 240, color.Black)
+	text.Draw(screen, tr("title.options"), arcadeFont, 270, 270, color.Black)
+	text.Draw(screen, tr("title.server", s.g.settings.currentServer().String()), arcadeFont, 270, 290, color.Black)
+}
+
+// maxUsernameLength 名前に入力できる文字数
+const maxUsernameLength = 12
+
+// loginScene 名前を入力してログインする画面
+type loginScene struct {
+	baseScene
+	g     *Game
+	field *textField
+	// connecting ログイン中なら結果が届くチャネル。Update を止めないよう別のgoroutineでログインする
+	connecting chan loginResult
+}
+
+type loginResult struct {
+	session *session
+	err     error
+}
+
+// newLoginScene 前回ログインした名前を最初から入れておく
+func newLoginScene(g *Game) *loginScene {
+	return &loginScene{g: g, field: newTextField(g.settings.Username, tr("login.placeholder"), maxUsernameLength)}
+}
+
+func (s *loginScene) Update() error {
+	if s.connecting != nil {
+		s.pollLogin()
+		return nil
+	}
+	if !s.field.update() {
+		return nil
+	}
+	name := strings.TrimSpace(s.field.String())
+	if name == "" {
+		return nil
+	}
+
+	g := s.g
+	g.text = name
+	g.changeSettings(func(st *settings) { st.Username = name })
+	result := make(chan loginResult, 1)
+	s.connecting = result
+	look := g.appearance
+	go func() {
+		session, err := login(name, look)
+		result <- loginResult{session: session, err: err}
+	}()
+	return nil
+}
+
+// pollLogin ログインが終わっていればゲームを始める。サーバーに繋がらなければオフラインで遊ぶ
+func (s *loginScene) pollLogin() {
+	var res loginResult
+	select {
+	case res = <-s.connecting:
+		s.connecting = nil
+	default:
+		return
+	}
+
+	g := s.g
+	g.beginRun()
+	g.init()
+	if res.err != nil {
+		log.Printf("failed to join online game, playing offline: %v", res.err)
+	} else {
+		g.startOnline(res.session)
+	}
+	g.scenes.Replace(newGameScene(g))
+}
+
+func (s *loginScene) Draw(screen *ebiten.Image) {
+	s.g.drawWorld(screen)
+	s.field.draw(screen, 275, 240, color.Black)
+	if s.connecting != nil {
+		text.Draw(screen, tr("login.connecting"), arcadeFont, 265, 270, color.Black)
+	}
+}
+
+// gameScene メインゲーム画面
+type gameScene struct {
+	baseScene
+	g *Game
+}
+
+func newGameScene(g *Game) *gameScene {
+	return &gameScene{g: g}
+}
+
+func (s *gameScene) Update() error {
+	g := s.g
+	if g.input.justPressed(actionPause) {
+		g.scenes.Push(newPauseScene(g))
+		return nil
+	}
+	// 再接続している間は時間を止めて待つ
+	if g.pollReconnect() {
+		return nil
+	}
+
+	g.timePassed += 1 / 60.0 // 60FPSを仮定
+
+	in := protocol.Input{
+		Up:    g.input.isPressed(actionMoveUp),
+		Down:  g.input.isPressed(actionMoveDown),
+		Right: g.input.isPressed(actionMoveRight),
+		Left:  g.input.isPressed(actionMoveLeft),
+	}
+
+	// オンラインでは当たり判定やNPCの移動はサーバーが行う
+	if g.online != nil {
+		g.updateOnline(in)
+		return nil
+	}
+
+	prev := g.body.Pos
+	g.body = sim.Step(g.body, &in, sim.DefaultMovement())
+	if g.body.Pos != prev {
+		g.markMoved()
+	}
+	g.myPlayer.x = int(g.body.Pos.X)
+	g.myPlayer.y = int(g.body.Pos.Y)
+
+	if remaining, ok := g.idleRemaining(); ok && remaining == 0 {
+		g.gameOver(protocol.CauseIdle)
+		return nil
+	}
+
+	//g.wall.move(0.01) // 速度は任意で設定可能
+
+	// NPCsを更新
+	for i := range g.npcs {
+		g.moveNPC(&g.npcs[i])
+	}
+
+	// 壁・NPC・他のプレイヤーとの衝突
+	if events := g.collisions(); len(events) > 0 {
+		g.gameOver(events[0].Cause)
+	}
+
+	g.speedMultiplier += 0.001 // この値は微調整する必要があります。
+	if g.speedMultiplier > g.maxSpeedMultiplier {
+		g.speedMultiplier = g.maxSpeedMultiplier
+	}
+	return nil
+}
+
+func (s *gameScene) Draw(screen *ebiten.Image) {
+	s.g.drawWorld(screen)
+	s.g.drawHUD(screen)
+	s.g.drawIdleWarning(screen)
+}
+
+// gameOverScene ゲームオーバー画面。死因・自己ベスト・ランキングを表示する
+type gameOverScene struct {
+	baseScene
+	g *Game
+}
+
+func newGameOverScene(g *Game) *gameOverScene {
+	return &gameOverScene{g: g}
+}
+
+func (s *gameOverScene) Enter() {
+	s.g.fetchRanking()
+}
+
+func (s *gameOverScene) Update() error {
+	g := s.g
+	if g.pollReconnect() {
+		return nil
+	}
+	if g.online != nil {
+		g.drainOnline()
+	}
+	if g.input.justPressed(actionConfirm) {
+		g.beginRun()
+		if g.online != nil {
+			if err := g.online.send(&protocol.Respawn{}); err != nil {
+				log.Printf("failed to respawn: %v", err)
+			}
+			g.timePassed = 0
+			g.lastMoved = 0
+			g.pauseLeft = g.maxPause
+		} else {
+			g.init()
+		}
+		g.scenes.Replace(newGameScene(g))
+	}
+	return nil
+}
+
+func (s *gameOverScene) Draw(screen *ebiten.Image) {
+	g := s.g
+	// リストの開始位置を定義
+	yPosition := 260
+
+	// 配列内の各ユーザー情報を表示
+	for _, user := range g.ranking {
+		text.Draw(screen, tr("gameOver.name", user.Name), arcadeFont, 275, yPosition, color.Black)
+		yPosition += 20 // 次の行の位置に移動
+		text.Draw(screen, tr("gameOver.highScore", float64(user.HighScore)/1000), arcadeFont, 275, yPosition, color.Black)
+		yPosition += 20 // 次の行の位置に移動
+	}
+	text.Draw(screen, tr("gameOver.title"), arcadeFont, 275, 240, color.Black)
+	if key, ok := causeMessages[g.deathCause]; ok {
+		text.Draw(screen, tr(key), arcadeFont, 275, 220, color.Black)
+	}
+	g.drawRunResult(screen)
+}
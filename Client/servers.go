@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/eiei114/dinosaur-jump/protocol"
+	"github.com/eiei114/dinosaur-jump/protocol/apiclient"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+)
+
+const (
+	// pingTimeout これだけ待っても /healthz が返ってこなければオフラインとみなす
+	pingTimeout = 3 * time.Second
+	// pingInterval サーバー選択画面を開いている間、この間隔で測り直す
+	pingInterval = 5 * time.Second
+)
+
+// serverEnv 設定ファイルより優先して使うサーバーのURLを指定する環境変数
+const serverEnv = "DINOSAUR_JUMP_SERVER"
+
+// serverStatus /healthz を呼んだ結果
+type serverStatus struct {
+	health *protocol.HealthResponse
+	ping   time.Duration
+	err    error
+}
+
+// String サーバー一覧に出す状態
+func (st *serverStatus) String() string {
+	switch {
+	case st == nil:
+		return tr("servers.checking")
+	case st.err != nil:
+		return tr("servers.offline")
+	case protocol.Version < st.health.MinSupportedVersion || protocol.Version > st.health.Version:
+		return tr("servers.incompatible")
+	}
+	return tr("servers.status", st.ping.Milliseconds(), st.health.Players)
+}
+
+type pingResult struct {
+	url    string
+	status *serverStatus
+}
+
+// pingServer url の /healthz を呼んで、かかった時間を測る
+func pingServer(url string) *serverStatus {
+	ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+	defer cancel()
+	start := time.Now()
+	health, err := apiclient.New(url).Health(ctx)
+	return &serverStatus{health: health, ping: time.Since(start), err: err}
+}
+
+// serversScene 保存してあるサーバーの一覧。応答時間と接続できるかを表示し、接続先を選ぶ
+type serversScene struct {
+	overlayScene
+	g    *Game
+	menu menu
+
+	statuses map[string]*serverStatus
+	results  chan pingResult
+	pingedAt time.Time
+	// adding nilでなければ新しいサーバーのURLを入力している
+	adding *textEdit
+}
+
+func newServersScene(g *Game) *serversScene {
+	s := &serversScene{
+		g:        g,
+		statuses: make(map[string]*serverStatus),
+		results:  make(chan pingResult, 16),
+	}
+	s.refresh()
+	for i, sv := range g.settings.Servers {
+		if sv.URL == g.settings.ServerURL {
+			s.menu.cursor = i
+		}
+	}
+	return s
+}
+
+func (s *serversScene) Enter() {
+	s.pingAll()
+}
+
+// pingAll 一覧のすべてのサーバーを裏で測り直す
+func (s *serversScene) pingAll() {
+	s.pingedAt = time.Now()
+	for _, sv := range s.g.settings.Servers {
+		go s.ping(sv.URL)
+	}
+}
+
+// ping 結果は Update で受け取る。画面を閉じた後や詰まっているときは捨てる
+func (s *serversScene) ping(url string) {
+	select {
+	case s.results <- pingResult{url: url, status: pingServer(url)}:
+	default:
+	}
+}
+
+// refresh 項目の表示を今の一覧と状態に合わせる。最後の2つは追加と戻る
+func (s *serversScene) refresh() {
+	servers := s.g.settings.Servers
+	s.menu.items = s.menu.items[:0]
+	for _, sv := range servers {
+		mark := "  "
+		if sv.URL == s.g.settings.ServerURL {
+			mark = "* "
+		}
+		name := []rune(sv.String())
+		if len(name) > 20 {
+			name = append(name[:17], []rune("...")...)
+		}
+		s.menu.items = append(s.menu.items, fmt.Sprintf("%s%-20s %s", mark, string(name), s.statuses[sv.URL]))
+	}
+	add := tr("servers.add")
+	if s.adding != nil {
+		add = tr("servers.url", s.adding.withCursor())
+	}
+	s.menu.items = append(s.menu.items, add, tr("menu.back"))
+	s.menu.cursor = min(s.menu.cursor, len(s.menu.items)-1)
+}
+
+func (s *serversScene) Update() error {
+	g := s.g
+	for {
+		select {
+		case res := <-s.results:
+			s.statuses[res.url] = res.status
+			continue
+		default:
+		}
+		break
+	}
+	if time.Since(s.pingedAt) > pingInterval {
+		s.pingAll()
+	}
+	defer s.refresh()
+
+	if s.adding != nil {
+		if s.adding.update() {
+			s.adding = nil
+		}
+		return nil
+	}
+
+	servers := g.settings.Servers
+	if g.input.justPressed(actionCancel) {
+		g.scenes.Pop()
+		return nil
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyR) {
+		s.pingAll()
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyDelete) && s.menu.cursor < len(servers) && len(servers) > 1 {
+		s.remove(servers[s.menu.cursor])
+		return nil
+	}
+
+	i := s.menu.update(&g.input)
+	switch {
+	case i < 0:
+	case i < len(servers):
+		g.useServer(servers[i].URL)
+		g.scenes.Pop()
+	case i == len(servers):
+		s.adding = newTextEdit("http://", 0, s.add)
+	default:
+		g.scenes.Pop()
+	}
+	return nil
+}
+
+// add 入力されたURLを一覧に足して測る
+func (s *serversScene) add(url string) {
+	if url == "" {
+		return
+	}
+	s.g.changeSettings(func(st *settings) { st.addServer(url) })
+	go s.ping(url)
+}
+
+// remove 一覧から消す。接続先だったら残っている最初のサーバーに変える
+func (s *serversScene) remove(sv savedServer) {
+	g := s.g
+	g.changeSettings(func(st *settings) {
+		for i := range st.Servers {
+			if st.Servers[i].URL == sv.URL {
+				st.Servers = append(st.Servers[:i:i], st.Servers[i+1:]...)
+				break
+			}
+		}
+	})
+	if g.settings.ServerURL == sv.URL {
+		g.useServer(g.settings.Servers[0].URL)
+	}
+}
+
+func (s *serversScene) Draw(screen *ebiten.Image) {
+	note := tr("servers.note")
+	if s.adding != nil {
+		note = tr("servers.addNote")
+	}
+	s.menu.draw(screen, tr("servers.title"), note)
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// settingsVersion 設定ファイルの形式のバージョン
+// 形式を変えたら上げて、1つ前の形式からの変換を settingsMigrations に足す
+const settingsVersion = 3
+
+// settingsMigrations settingsMigrations[v] はバージョンvの設定をv+1の形式に書き換える
+var settingsMigrations = map[int]func(raw map[string]interface{}) error{
+	// 1 → 2: サーバーの一覧 servers を追加。それまで使っていた serverUrl を一覧に入れる
+	1: func(raw map[string]interface{}) error {
+		url, _ := raw["serverUrl"].(string)
+		if url == "" {
+			return nil
+		}
+		raw["servers"] = []interface{}{map[string]interface{}{"url": url}}
+		return nil
+	},
+	// 2 → 3: 1操作1キーの keys を、操作ごとにキー・ボタン・スティックを割り当てる bindings にする
+	// ゲームパッドの割り当ては既定のものを入れる
+	2: func(raw map[string]interface{}) error {
+		keys, _ := raw["keys"].(map[string]interface{})
+		delete(raw, "keys")
+		renamed := map[string]action{"up": actionMoveUp, "down": actionMoveDown, "left": actionMoveLeft, "right": actionMoveRight, "pause": actionPause}
+		defaults := defaultBindings()
+		b := make(map[string]interface{})
+		for name, a := range renamed {
+			k, ok := keys[name].(string)
+			if !ok {
+				continue
+			}
+			b[a.String()] = map[string]interface{}{"keys": []string{k}, "buttons": defaults[a].Buttons, "sticks": defaults[a].Sticks}
+		}
+		raw["bindings"] = b
+		return nil
+	},
+}
+
+const (
+	settingsDir  = "dinosaur-jump"
+	settingsFile = "settings.json"
+
+	minWindowSize = 320
+	maxWindowSize = 1920
+
+	defaultDeadZone = 0.3
+	maxDeadZone     = 0.9
+)
+
+// settings 終了しても残しておくクライアントの設定
+type settings struct {
+	Version      int `json:"version"`
+	WindowWidth  int `json:"windowWidth"`
+	WindowHeight int `json:"windowHeight"`
+	// Bindings 操作ごとのキー・ボタン・スティックの割り当て
+	Bindings bindings `json:"bindings"`
+	// DeadZone スティックをこれより大きく倒したら操作したとみなす(0〜1)
+	DeadZone float64 `json:"deadZone"`
+	// ServerURL 接続するサーバー。Servers のどれか
+	ServerURL string `json:"serverUrl"`
+	// Servers サーバー選択画面に出すサーバーの一覧
+	Servers []savedServer `json:"servers"`
+	// Volume 効果音の音量(0〜1)
+	Volume float64 `json:"volume"`
+	// Language 表示する言語("en" や "ja")。空ならOSの言語に合わせる
+	Language string `json:"language,omitempty"`
+	// Username ログイン画面に最初から入れておく名前
+	Username string `json:"username"`
+	// InterpDelayMillis 他のプレイヤーとNPCを何ミリ秒遅れで描画するか
+	InterpDelayMillis int64 `json:"interpDelayMillis"`
+	ShowNetStats      bool  `json:"showNetStats"`
+}
+
+// savedServer サーバー一覧の1件分
+type savedServer struct {
+	// Name 表示名。空ならURLを表示する
+	Name string `json:"name,omitempty"`
+	URL  string `json:"url"`
+}
+
+func (s savedServer) String() string {
+	if s.Name != "" {
+		return s.Name
+	}
+	return s.URL
+}
+
+func defaultSettings() settings {
+	return settings{
+		Version:           settingsVersion,
+		WindowWidth:       screenX,
+		WindowHeight:      screenY,
+		Bindings:          defaultBindings(),
+		DeadZone:          defaultDeadZone,
+		ServerURL:         defaultServerURL,
+		Servers:           []savedServer{{Name: "LOCAL", URL: defaultServerURL}},
+		Volume:            1,
+		InterpDelayMillis: defaultInterpDelay.Milliseconds(),
+	}
+}
+
+// interpDelay InterpDelayMillis を time.Duration にしたもの
+func (s *settings) interpDelay() time.Duration {
+	return time.Duration(s.InterpDelayMillis) * time.Millisecond
+}
+
+// normalize 手で書き換えられた範囲外の値を、使える値に直す
+func (s *settings) normalize() {
+	def := defaultSettings()
+	s.Version = settingsVersion
+	if s.WindowWidth < minWindowSize || s.WindowWidth > maxWindowSize {
+		s.WindowWidth = def.WindowWidth
+	}
+	if s.WindowHeight < minWindowSize || s.WindowHeight > maxWindowSize {
+		s.WindowHeight = def.WindowHeight
+	}
+	s.Volume = min(max(s.Volume, 0), 1)
+	if _, ok := locales[s.Language]; !ok {
+		s.Language = ""
+	}
+	s.DeadZone = min(max(s.DeadZone, 0), maxDeadZone)
+	if s.Bindings == nil {
+		s.Bindings = make(bindings)
+	}
+	for a, b := range def.Bindings {
+		// 決定と取り消しが空ならメニューを操作できないので、設定ファイルを書き換えられていても元に戻す
+		if cur, ok := s.Bindings[a]; !ok || (a.required() && cur.empty()) {
+			s.Bindings[a] = b
+		}
+	}
+	s.InterpDelayMillis = min(max(s.InterpDelayMillis, 0), maxInterpDelay.Milliseconds())
+	if s.ServerURL == "" {
+		s.ServerURL = def.ServerURL
+	}
+	s.Servers = slices.DeleteFunc(s.Servers, func(sv savedServer) bool { return sv.URL == "" })
+	s.addServer(s.ServerURL)
+}
+
+// addServer urlがサーバー一覧になければ足す
+func (s *settings) addServer(url string) {
+	for _, sv := range s.Servers {
+		if sv.URL == url {
+			return
+		}
+	}
+	s.Servers = append(s.Servers, savedServer{URL: url})
+}
+
+// currentServer 接続するサーバー
+func (s *settings) currentServer() savedServer {
+	for _, sv := range s.Servers {
+		if sv.URL == s.ServerURL {
+			return sv
+		}
+	}
+	return savedServer{URL: s.ServerURL}
+}
+
+// key 設定ファイルにはキーの名前("W" や "Escape")で書く
+type key ebiten.Key
+
+func (k key) String() string {
+	return ebiten.Key(k).String()
+}
+
+func (k key) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+func (k *key) UnmarshalText(text []byte) error {
+	for c := ebiten.Key(0); c <= ebiten.KeyMax; c++ {
+		if strings.EqualFold(c.String(), string(text)) {
+			*k = key(c)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown key %q", text)
+}
+
+// settingsStore 設定ファイルの読み書き
+// saved はファイルに書いてある内容。コマンドラインフラグでの上書きは Game.settings にだけ反映し、保存しない
+type settingsStore struct {
+	path  string
+	saved settings
+	// readOnly 新しいバージョンのクライアントが書いたファイルなど、上書きすると困るときはtrue
+	readOnly bool
+}
+
+// defaultSettingsPath OSのユーザー設定ディレクトリの下の設定ファイル
+func defaultSettingsPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		log.Printf("no user config directory, settings are saved in the working directory: %v", err)
+		return settingsFile
+	}
+	return filepath.Join(dir, settingsDir, settingsFile)
+}
+
+// openSettings 設定ファイルを読む。なければ既定値で、古い形式なら変換して書き直す
+// 読めないファイルは .broken に退避して既定値から始める
+func openSettings(path string) *settingsStore {
+	st := &settingsStore{path: path, saved: defaultSettings()}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return st
+	}
+	if err != nil {
+		log.Printf("failed to read settings, using defaults: %v", err)
+		st.readOnly = true
+		return st
+	}
+
+	s, migrated, err := parseSettings(data)
+	var newer *newerSettingsError
+	switch {
+	case errors.As(err, &newer):
+		log.Printf("settings were written by a newer client, using defaults without saving: %v", err)
+		st.readOnly = true
+		return st
+	case err != nil:
+		log.Printf("broken settings file, moving it aside and using defaults: %v", err)
+		if err := os.Rename(path, path+".broken"); err != nil {
+			log.Printf("failed to move broken settings: %v", err)
+			st.readOnly = true
+		}
+		return st
+	}
+
+	st.saved = s
+	if migrated {
+		// 変換に失敗していたときに戻せるよう、元のファイルを残しておく
+		if err := os.WriteFile(path+".bak", data, 0o644); err != nil {
+			log.Printf("failed to back up old settings: %v", err)
+		}
+		st.save()
+	}
+	return st
+}
+
+// newerSettingsError このクライアントより新しい形式の設定ファイル
+type newerSettingsError struct {
+	version int
+}
+
+func (e *newerSettingsError) Error() string {
+	return fmt.Sprintf("settings version %d is newer than %d", e.version, settingsVersion)
+}
+
+// parseSettings 設定ファイルの中身を読み、古い形式なら今の形式に変換する。変換したら migrated がtrue
+// ファイルにない項目は既定値になる
+func parseSettings(data []byte) (s settings, migrated bool, err error) {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return s, false, err
+	}
+	v, ok := raw["version"].(float64)
+	if !ok || v < 1 || v != float64(int(v)) {
+		return s, false, fmt.Errorf("invalid settings version %v", raw["version"])
+	}
+	version := int(v)
+	if version > settingsVersion {
+		return s, false, &newerSettingsError{version: version}
+	}
+	for ; version < settingsVersion; version++ {
+		migrate, ok := settingsMigrations[version]
+		if !ok {
+			return s, false, fmt.Errorf("no migration from settings version %d", version)
+		}
+		if err := migrate(raw); err != nil {
+			return s, false, fmt.Errorf("migrate settings from version %d: %w", version, err)
+		}
+		migrated = true
+	}
+
+	data, err = json.Marshal(raw)
+	if err != nil {
+		return s, false, err
+	}
+	s = defaultSettings()
+	if err := json.Unmarshal(data, &s); err != nil {
+		return s, false, err
+	}
+	s.normalize()
+	return s, migrated, nil
+}
+
+// save saved をファイルに書く。書きかけのファイルが残らないよう、一時ファイルに書いてから置き換える
+func (st *settingsStore) save() {
+	if st.readOnly {
+		return
+	}
+	data, err := json.MarshalIndent(st.saved, "", "  ")
+	if err != nil {
+		log.Printf("failed to encode settings: %v", err)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(st.path), 0o755); err != nil {
+		log.Printf("failed to create settings directory: %v", err)
+		return
+	}
+	tmp := st.path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		log.Printf("failed to save settings: %v", err)
+		return
+	}
+	if err := os.Rename(tmp, st.path); err != nil {
+		log.Printf("failed to save settings: %v", err)
+	}
+}
+
+// changeSettings 設定を変えて保存する。fn は今の設定と保存されている設定の両方に適用される
+// フラグで上書きしている項目も、fn で変えた項目だけは保存される
+func (g *Game) changeSettings(fn func(s *settings)) {
+	fn(&g.settings)
+	if g.store == nil {
+		return
+	}
+	fn(&g.store.saved)
+	g.store.save()
+}
+
+// useServer 接続するサーバーを変えて、一覧になければ足す
+func (g *Game) useServer(url string) {
+	g.changeSettings(func(st *settings) {
+		st.ServerURL = url
+		st.addServer(url)
+	})
+	g.applySettings()
+}
+
+// applySettings 今の設定をゲームに反映する
+func (g *Game) applySettings() {
+	setServerURL(g.settings.ServerURL)
+	setLanguage(g.settings.Language)
+	sfx.setVolume(g.settings.Volume)
+	if g.interp != nil {
+		g.interp.delay = g.settings.interpDelay()
+	}
+}
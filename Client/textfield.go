@@ -0,0 +1,125 @@
+package main
+
+import (
+	"image/color"
+	"log"
+	"strings"
+	"unicode"
+
+	"github.com/atotto/clipboard"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"github.com/hajimehoshi/ebiten/v2/text"
+	"golang.org/x/image/font"
+)
+
+var placeholderColor = color.RGBA{0x99, 0x99, 0x99, 0xff}
+
+// textField 1行の文字入力欄
+// 文字(rune)単位で編集するので、日本語の名前でも途中で切れない。改行などの制御文字は入らない
+type textField struct {
+	runes []rune
+	// cursor カーソルの位置。runes の何文字目の前か
+	cursor int
+	// maxLength 入力できる文字数。0なら制限しない
+	maxLength int
+	// placeholder 空のときに薄く表示する案内
+	placeholder string
+	counter     int
+}
+
+func newTextField(value, placeholder string, maxLength int) *textField {
+	f := &textField{placeholder: placeholder, maxLength: maxLength}
+	f.insert(value)
+	return f
+}
+
+func (f *textField) String() string {
+	return string(f.runes)
+}
+
+// update 1フレーム分の入力を反映する。Enter が押されたらtrue
+func (f *textField) update() bool {
+	f.counter++
+	f.insert(string(ebiten.AppendInputChars(nil)))
+
+	ctrl := ebiten.IsKeyPressed(ebiten.KeyControl) || ebiten.IsKeyPressed(ebiten.KeyMeta)
+	switch {
+	case inpututil.IsKeyJustPressed(ebiten.KeyEnter):
+		return true
+	case ctrl && inpututil.IsKeyJustPressed(ebiten.KeyV),
+		ebiten.IsKeyPressed(ebiten.KeyShift) && inpututil.IsKeyJustPressed(ebiten.KeyInsert):
+		f.paste()
+	case repeatingKeyPressed(ebiten.KeyBackspace):
+		if f.cursor > 0 {
+			f.runes = append(f.runes[:f.cursor-1], f.runes[f.cursor:]...)
+			f.cursor--
+		}
+	case repeatingKeyPressed(ebiten.KeyDelete):
+		if f.cursor < len(f.runes) {
+			f.runes = append(f.runes[:f.cursor], f.runes[f.cursor+1:]...)
+		}
+	case repeatingKeyPressed(ebiten.KeyArrowLeft):
+		f.cursor = max(f.cursor-1, 0)
+	case repeatingKeyPressed(ebiten.KeyArrowRight):
+		f.cursor = min(f.cursor+1, len(f.runes))
+	case inpututil.IsKeyJustPressed(ebiten.KeyHome):
+		f.cursor = 0
+	case inpututil.IsKeyJustPressed(ebiten.KeyEnd):
+		f.cursor = len(f.runes)
+	default:
+		return false
+	}
+	// 操作した直後はカーソルを点灯させる
+	f.counter = 0
+	return false
+}
+
+// insert カーソルの位置に s を入れる。制御文字は捨て、maxLength を超える分は入れない
+func (f *textField) insert(s string) {
+	var rs []rune
+	for _, r := range s {
+		if unicode.IsPrint(r) {
+			rs = append(rs, r)
+		}
+	}
+	if f.maxLength > 0 {
+		rs = rs[:min(len(rs), f.maxLength-len(f.runes))]
+	}
+	if len(rs) == 0 {
+		return
+	}
+	f.runes = append(f.runes[:f.cursor], append(rs, f.runes[f.cursor:]...)...)
+	f.cursor += len(rs)
+}
+
+// paste クリップボードの1行目を貼り付ける
+func (f *textField) paste() {
+	s, err := clipboard.ReadAll()
+	if err != nil {
+		log.Printf("failed to read clipboard: %v", err)
+		return
+	}
+	line, _, _ := strings.Cut(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+	f.insert(line)
+}
+
+// withCursor カーソルの位置に "_" を入れた文字列。メニューの中で編集するときに使う
+func (f *textField) withCursor() string {
+	return string(f.runes[:f.cursor]) + "_" + string(f.runes[f.cursor:])
+}
+
+// draw (x, y) を左下にして日本語も描けるフォントで描く。カーソルは点滅する縦線
+func (f *textField) draw(screen *ebiten.Image, x, y int, clr color.Color) {
+	if len(f.runes) == 0 {
+		text.Draw(screen, f.placeholder, textFont, x, y, placeholderColor)
+	} else {
+		text.Draw(screen, f.String(), textFont, x, y, clr)
+	}
+	if f.counter%60 < 30 {
+		cx := x + font.MeasureString(textFont, string(f.runes[:f.cursor])).Ceil()
+		m := textFont.Metrics()
+		ebitenutil.DrawRect(screen, float64(cx), float64(y-m.Ascent.Ceil()), 1, float64((m.Ascent + m.Descent).Ceil()), clr)
+	}
+}
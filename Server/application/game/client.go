@@ -0,0 +1,33 @@
+package game
+
+import "github.com/eiei114/dinosaur-jump/protocol"
+
+// Client 部屋に参加しているプレイヤー1人分の接続
+// 接続側(WebSocketのハンドラー)は Send から送信するフレームを受け取り、
+// 受信したメッセージは Submit で部屋に渡す
+type Client struct {
+	PlayerID uint32
+	// Send 送信するフレーム。JSONのメッセージとバイナリスナップショットが混ざる
+	// 部屋を抜けると閉じられる
+	Send <-chan []byte
+
+	room *Room
+	// conn 接続の世代。再開で新しい接続に置き換わった後の古い接続からのメッセージと Disconnect を無視する
+	conn uint32
+}
+
+// RoomID 参加している部屋のID
+func (c *Client) RoomID() string {
+	return c.room.ID()
+}
+
+// Submit 受信したメッセージを部屋に渡す
+func (c *Client) Submit(msg protocol.Message) {
+	c.room.handle(c.PlayerID, c.conn, msg)
+}
+
+// Disconnect 接続が切れたことを部屋に伝える
+// プレイヤーは再接続の猶予の間凍結され、Hub.Resume で戻れる。猶予が過ぎると部屋から抜ける
+func (c *Client) Disconnect() {
+	c.room.disconnect(c.PlayerID, c.conn)
+}
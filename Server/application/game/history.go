@@ -0,0 +1,51 @@
+package game
+
+import "github.com/eiei114/dinosaur-jump/protocol"
+
+// history 直近のtickのエンティティの位置を保持するリングバッファ
+// クライアントは他のプレイヤーとNPCを少し過去の状態で描画しているので、
+// 当たり判定はそのプレイヤーが見ていた時点まで巻き戻して行う
+type history struct {
+	frames []historyFrame
+}
+
+type historyFrame struct {
+	tick     uint32
+	entities map[uint32]historyEntry
+}
+
+type historyEntry struct {
+	pos   protocol.Position
+	alive bool
+}
+
+// newHistory maxTicks tick前まで巻き戻せる履歴を作る
+func newHistory(maxTicks uint32) *history {
+	h := &history{frames: make([]historyFrame, maxTicks+1)}
+	for i := range h.frames {
+		h.frames[i].entities = make(map[uint32]historyEntry)
+	}
+	return h
+}
+
+// record tickの状態を記録する。一番古いフレームを上書きする
+func (h *history) record(tick uint32, players map[uint32]*player, npcs []*npc) {
+	f := &h.frames[int(tick)%len(h.frames)]
+	f.tick = tick
+	clear(f.entities)
+	for _, p := range players {
+		f.entities[p.id] = historyEntry{pos: p.pos, alive: p.alive}
+	}
+	for _, n := range npcs {
+		f.entities[n.id] = historyEntry{pos: n.pos, alive: true}
+	}
+}
+
+// at tickの状態を返す。もう上書きされていればfalse
+func (h *history) at(tick uint32) (map[uint32]historyEntry, bool) {
+	f := &h.frames[int(tick)%len(h.frames)]
+	if f.tick != tick {
+		return nil, false
+	}
+	return f.entities, true
+}
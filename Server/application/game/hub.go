@@ -0,0 +1,244 @@
+package game
+
+import (
+	"context"
+	"errors"
+	"example.com/application/logging"
+	"example.com/config"
+	"example.com/domain"
+	"fmt"
+	"github.com/eiei114/dinosaur-jump/protocol"
+	"github.com/google/uuid"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// recordTimeout プレイ結果の保存を待つ最大時間
+const recordTimeout = 5 * time.Second
+
+var (
+	// ErrRoomFull 指定された部屋が満員
+	ErrRoomFull = errors.New("room is full")
+	// ErrTooManyRooms 部屋の数が MaxRooms に達していて新しい部屋を作れない
+	ErrTooManyRooms = errors.New("too many rooms")
+	// ErrInvalidRoomName 指定された部屋の名前が protocol.ValidRoomName を満たさない
+	ErrInvalidRoomName = errors.New("invalid room name")
+	// ErrResumeFailed 再開用トークンが不正か、再接続の猶予が過ぎた
+	ErrResumeFailed = errors.New("resume token is invalid or expired")
+)
+
+// MatchRecorder プレイ1回分の結果を保存して、自己ベストと順位を返す
+type MatchRecorder interface {
+	RecordMatch(ctx context.Context, match *domain.Match) (*domain.MatchResult, error)
+}
+
+// Hub 部屋の一覧を管理する
+// プレイヤーは空きのある部屋に入り、部屋が空になったら片付ける
+type Hub struct {
+	cfg     config.GameConfig
+	logger  *slog.Logger
+	matches MatchRecorder
+
+	mu         sync.Mutex
+	rooms      map[string]*Room
+	nextRoomID int
+	// resumes 再開用トークン → 再接続を待っているプレイヤー
+	resumes map[string]resumeTarget
+
+	nextEntityID atomic.Uint32
+
+	ticks        atomic.Uint64
+	tickOverruns atomic.Uint64
+}
+
+// Stats 負荷の状況
+type Stats struct {
+	Rooms        int
+	Players      int
+	Ticks        uint64
+	TickOverruns uint64
+}
+
+// NewHub matches が nil ならプレイ結果を保存しない
+func NewHub(cfg config.GameConfig, logger *slog.Logger, matches MatchRecorder) *Hub {
+	return &Hub{
+		cfg:     cfg,
+		logger:  logger,
+		matches: matches,
+		rooms:   make(map[string]*Room),
+		resumes: make(map[string]resumeTarget),
+	}
+}
+
+type resumeTarget struct {
+	room     *Room
+	playerID uint32
+}
+
+// Join プレイヤーを部屋に入れる
+// roomID が空の場合は空きのある部屋、なければ新しい部屋に入る。部屋が MaxRooms あって入れなければ ErrTooManyRooms
+func (h *Hub) Join(user *domain.User, roomID string) (*Client, error) {
+	if roomID != "" && !protocol.ValidRoomName(roomID) {
+		return nil, ErrInvalidRoomName
+	}
+	for {
+		room, err := h.pickRoom(roomID)
+		if err != nil {
+			return nil, err
+		}
+		client, err := room.join(user)
+		if errors.Is(err, errRoomClosed) {
+			// 部屋が片付けられた直後だった。選び直す
+			continue
+		}
+		if errors.Is(err, ErrRoomFull) && roomID == "" {
+			continue
+		}
+		return client, err
+	}
+}
+
+// Resume 切断されたプレイヤーを、Welcome で渡した再開用トークンから元の部屋に戻す
+func (h *Hub) Resume(userID, token string) (*Client, error) {
+	h.mu.Lock()
+	target, ok := h.resumes[token]
+	h.mu.Unlock()
+	if !ok {
+		return nil, ErrResumeFailed
+	}
+	client, err := target.room.resume(target.playerID, userID, token)
+	if errors.Is(err, errRoomClosed) {
+		return nil, ErrResumeFailed
+	}
+	return client, err
+}
+
+// UpdateAppearance 部屋にいるユーザーの見た目を変え、部屋の全員に知らせる
+func (h *Hub) UpdateAppearance(userID string, look protocol.Appearance) {
+	h.mu.Lock()
+	rooms := make([]*Room, 0, len(h.rooms))
+	for _, room := range h.rooms {
+		rooms = append(rooms, room)
+	}
+	h.mu.Unlock()
+	for _, room := range rooms {
+		room.updateAppearance(userID, look)
+	}
+}
+
+func (h *Hub) pickRoom(roomID string) (*Room, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if roomID != "" {
+		if room, ok := h.rooms[roomID]; ok {
+			return room, nil
+		}
+		if len(h.rooms) >= h.cfg.MaxRooms {
+			return nil, ErrTooManyRooms
+		}
+		return h.newRoomLocked(roomID), nil
+	}
+
+	for _, room := range h.rooms {
+		if room.size() < h.cfg.RoomSize {
+			return room, nil
+		}
+	}
+	if len(h.rooms) >= h.cfg.MaxRooms {
+		return nil, ErrTooManyRooms
+	}
+	// クライアントが同じ名前の部屋を作っていれば飛ばす
+	for {
+		h.nextRoomID++
+		id := fmt.Sprintf("room-%d", h.nextRoomID)
+		if _, ok := h.rooms[id]; !ok {
+			return h.newRoomLocked(id), nil
+		}
+	}
+}
+
+func (h *Hub) newRoomLocked(id string) *Room {
+	room := newRoom(id, h.cfg, h, h.logger.With("room", id))
+	h.rooms[id] = room
+	go room.run()
+	h.logger.Info("room created", "room", id)
+	return room
+}
+
+// newEntityID 部屋をまたいで重複しないエンティティIDを振る
+func (h *Hub) newEntityID() uint32 {
+	return h.nextEntityID.Add(1)
+}
+
+// Stats 部屋とプレイヤーの数、これまでのtickの数と処理が間に合わなかったtickの数を返す
+func (h *Hub) Stats() Stats {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	st := Stats{
+		Rooms:        len(h.rooms),
+		Ticks:        h.ticks.Load(),
+		TickOverruns: h.tickOverruns.Load(),
+	}
+	for _, room := range h.rooms {
+		st.Players += room.size()
+	}
+	return st
+}
+
+// recordTick 部屋が1tick処理するたびに呼ぶ
+func (h *Hub) recordTick(overrun bool) {
+	h.ticks.Add(1)
+	if overrun {
+		h.tickOverruns.Add(1)
+	}
+}
+
+// recordMatch プレイ結果を保存する。部屋のtickを止めないように別のgoroutineで行う
+// done が nil でなければ、保存できたときに結果を渡して呼ぶ
+func (h *Hub) recordMatch(match *domain.Match, done func(*domain.MatchResult)) {
+	if h.matches == nil {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), recordTimeout)
+		defer cancel()
+		ctx = logging.SetLogger(ctx, h.logger.With("room", match.Room))
+		result, err := h.matches.RecordMatch(ctx, match)
+		if err != nil {
+			h.logger.Error("record match failed", "user_id", match.UserId, "err", err)
+			return
+		}
+		if done != nil {
+			done(result)
+		}
+	}()
+}
+
+// issueResumeToken プレイヤーの再開用トークンを発行する
+func (h *Hub) issueResumeToken(room *Room, playerID uint32) string {
+	token := uuid.NewString()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.resumes[token] = resumeTarget{room: room, playerID: playerID}
+	return token
+}
+
+// revokeResumeToken 使い終わった・期限切れの再開用トークンを無効にする
+func (h *Hub) revokeResumeToken(token string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.resumes, token)
+}
+
+// remove 空になった部屋を一覧から外す
+func (h *Hub) remove(room *Room) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.rooms[room.id] == room {
+		delete(h.rooms, room.id)
+		h.logger.Info("room closed", "room", room.id)
+	}
+}
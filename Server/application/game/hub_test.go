@@ -0,0 +1,86 @@
+package game
+
+import (
+	"errors"
+	"example.com/config"
+	"example.com/domain"
+	"github.com/eiei114/dinosaur-jump/protocol"
+	"io"
+	"log/slog"
+	"testing"
+)
+
+func TestJoinRoomLimits(t *testing.T) {
+	cfg := config.Default().Game
+	cfg.MaxRooms = 1
+	cfg.ResumeGrace = 0
+	hub := NewHub(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)), nil)
+	user := &domain.User{Id: "user", Name: "dino"}
+
+	for _, name := range []string{"has space", "../room", "日本語", "a-very-long-room-name-that-is-over-32"} {
+		if _, err := hub.Join(user, name); !errors.Is(err, ErrInvalidRoomName) {
+			t.Errorf("Join(%q) err = %v, want ErrInvalidRoomName", name, err)
+		}
+	}
+
+	client, err := hub.Join(user, "room_A-1")
+	if err != nil {
+		t.Fatalf("Join with a valid name: %v", err)
+	}
+	defer client.Disconnect()
+	if _, err := hub.Join(user, "other"); !errors.Is(err, ErrTooManyRooms) {
+		t.Errorf("Join into a new room over MaxRooms err = %v, want ErrTooManyRooms", err)
+	}
+	// 既にある部屋には上限に関係なく入れる
+	second, err := hub.Join(user, "room_A-1")
+	if err != nil {
+		t.Fatalf("Join into an existing room: %v", err)
+	}
+	second.Disconnect()
+}
+
+// inRoom fn を部屋のgoroutineで実行して終わるまで待つ
+func inRoom(t *testing.T, r *Room, fn func()) {
+	t.Helper()
+	done := make(chan struct{})
+	if !r.do(func() {
+		fn()
+		close(done)
+	}) {
+		t.Fatal("room is closed")
+	}
+	<-done
+}
+
+func TestSubmitFromReplacedConnection(t *testing.T) {
+	cfg := config.Default().Game
+	hub := NewHub(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)), nil)
+	user := &domain.User{Id: "user", Name: "dino"}
+
+	old, err := hub.Join(user, "resume")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var token string
+	inRoom(t, old.room, func() { token = old.room.players[old.PlayerID].resumeToken })
+	// 古い接続の切断に気づく前に再開した
+	client, err := hub.Resume(user.Id, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Disconnect()
+
+	// 2つ分の入力を受け付けられるまで待つ
+	budget := 0.0
+	for budget < 2 {
+		inRoom(t, client.room, func() { budget = client.room.players[client.PlayerID].inputBudget })
+	}
+	old.Submit(&protocol.Input{Seq: 5, Right: true})
+	client.Submit(&protocol.Input{Seq: 1, Right: true})
+
+	var lastInput uint32
+	inRoom(t, client.room, func() { lastInput = client.room.players[client.PlayerID].lastInput })
+	if lastInput != 1 {
+		t.Errorf("last input = %d, want 1: the input from the replaced connection was not dropped", lastInput)
+	}
+}
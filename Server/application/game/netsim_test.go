@@ -0,0 +1,135 @@
+package game
+
+import (
+	"example.com/config"
+	"github.com/eiei114/dinosaur-jump/protocol"
+	"github.com/eiei114/dinosaur-jump/protocol/netsim"
+	"github.com/eiei114/dinosaur-jump/protocol/sim"
+	"testing"
+	"time"
+)
+
+// TestSessionConvergesOverNetsim 遅延とパケットロスのある回線越しに部屋を動かし、
+// クライアントの予測がサーバーの位置に収束することを確かめる
+func TestSessionConvergesOverNetsim(t *testing.T) {
+	if testing.Short() {
+		t.Skip("runs in real time")
+	}
+	cfg := config.Default().Game
+	cfg.IdleTimeout = 0
+	r := newTestRoom(t, cfg)
+	r.npcs = nil
+	p := addTestPlayer(r, protocol.Position{X: 300, Y: 300})
+	client := r.connect(p, false)
+	go r.run()
+	defer r.do(func() { r.remove(p) })
+
+	cond := netsim.Config{Latency: 60 * time.Millisecond, Jitter: 20 * time.Millisecond, Loss: 0.2, Reorder: 0.05}
+	movement := cfg.Movement.Protocol()
+
+	up := netsim.NewLink(cond, func(data []byte) {
+		if msg, err := protocol.Decode(data); err == nil {
+			client.Submit(msg)
+		}
+	})
+	defer up.Close()
+	send := func(msg protocol.Message) {
+		data, err := protocol.Encode(msg)
+		if err != nil {
+			t.Errorf("encode %s: %v", msg.MessageType(), err)
+			return
+		}
+		up.Send(data, false)
+	}
+
+	// 受信側はクライアントと同じく、デコードできたスナップショットに受信確認を返す
+	snaps := make(chan *protocol.EntitySnapshot, 1024)
+	var decoder protocol.SnapshotDecoder
+	down := netsim.NewLink(cond, func(data []byte) {
+		if !protocol.IsEntitySnapshot(data) {
+			return
+		}
+		snap, err := decoder.Decode(data)
+		if err != nil {
+			return
+		}
+		send(&protocol.SnapshotAck{Seq: snap.Seq})
+		snaps <- snap
+	})
+	defer down.Close()
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		for {
+			select {
+			case data := <-client.Send:
+				down.Send(data, !protocol.IsEntitySnapshot(data))
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	// 予測はクライアントの predictor と同じ手順: 入力をすぐ適用し、スナップショットが届いたら未処理の入力をやり直す
+	body := sim.Body{Pos: p.pos}
+	var server sim.Body
+	var pending []protocol.Input
+	seq := uint32(0)
+	reconcile := func(snap *protocol.EntitySnapshot) {
+		for _, e := range snap.Entities {
+			if e.ID != client.PlayerID {
+				continue
+			}
+			if e.Flags&protocol.EntityDead != 0 {
+				t.Fatalf("player died at %+v", e.Position)
+			}
+			i := 0
+			for i < len(pending) && pending[i].Seq <= snap.LastInput {
+				i++
+			}
+			pending = pending[i:]
+			server = sim.Body{Pos: e.Position, Vel: snap.Velocity}
+			body = sim.Body{Pos: e.Position, Vel: snap.Velocity}
+			for k := range pending {
+				body = sim.Step(body, &pending[k], movement)
+			}
+		}
+	}
+
+	frame := time.NewTicker(sim.FrameDuration)
+	defer frame.Stop()
+	deadline := time.Now().Add(5 * time.Second)
+	for i := 0; ; i++ {
+		<-frame.C
+		// 右に、次に左に動いてから手を離す
+		in := protocol.Input{Right: i < 20, Left: i >= 20 && i < 40}
+		if !in.IsEmpty() || body.Moving() || server.Moving() {
+			seq++
+			in.Seq = seq
+			pending = append(pending, in)
+			body = sim.Step(body, &in, movement)
+			send(&in)
+		}
+	drain:
+		for {
+			select {
+			case snap := <-snaps:
+				reconcile(snap)
+			default:
+				break drain
+			}
+		}
+
+		// 止まった後の何も押していない入力は失われても位置が変わらないので、未処理の入力が残っていてもよい
+		if i >= 40 && !server.Moving() && !body.Moving() && body.Pos == server.Pos {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("did not converge: predicted %+v, server %+v, %d inputs pending", body, server, len(pending))
+		}
+	}
+
+	if up.Stats().Dropped+down.Stats().Dropped == 0 {
+		t.Error("no frames were dropped; the test did not exercise loss")
+	}
+}
@@ -0,0 +1,735 @@
+package game
+
+import (
+	"cmp"
+	"errors"
+	"example.com/config"
+	"example.com/domain"
+	"fmt"
+	"github.com/eiei114/dinosaur-jump/protocol"
+	"github.com/eiei114/dinosaur-jump/protocol/sim"
+	"log/slog"
+	"math/rand"
+	"slices"
+	"sync/atomic"
+	"time"
+)
+
+var errRoomClosed = errors.New("room is closed")
+
+const (
+	// npcCount 1部屋あたりのNPCの数
+	npcCount = 3
+	// sendBuffer プレイヤーごとの送信待ちフレーム数。あふれたらスナップショットを捨てる
+	sendBuffer = 64
+	// rankingInterval 部屋内ランキングを送る間隔
+	rankingInterval = 500 * time.Millisecond
+	// inputBurstTicks 何tick分の入力までまとめて受け付けるか
+	inputBurstTicks = 3
+	// pauseLookahead, pauseClearance ポーズさせない「ぶつかる直前」の範囲
+	// 今の速度のまま pauseLookahead の間に、何かに pauseClearance ピクセルより近づくならポーズさせない
+	pauseLookahead = 250 * time.Millisecond
+	pauseClearance = 8
+)
+
+// 死因
+const (
+	CauseWall   = protocol.CauseWall
+	CauseNPC    = protocol.CauseNPC
+	CausePlayer = protocol.CausePlayer
+	CauseIdle   = protocol.CauseIdle
+	// CauseDisconnect 生きたまま部屋を出た。プレイ結果にだけ記録する
+	CauseDisconnect = "disconnect"
+)
+
+// Room 1部屋分の正となるシミュレーション
+// 状態はすべて run のgoroutineだけが触り、外からはinboxへのイベントで操作する
+type Room struct {
+	id     string
+	cfg    config.GameConfig
+	hub    *Hub
+	logger *slog.Logger
+
+	inbox   chan func()
+	done    chan struct{}
+	members atomic.Int32
+
+	tick    uint32
+	rnd     *rand.Rand
+	players map[uint32]*player
+	npcs    []*npc
+	history *history
+}
+
+type player struct {
+	id     uint32
+	userID string
+	name   string
+	pos    protocol.Position
+	// vel 速度。入力が届いたときだけ sim.Step で進める
+	vel   protocol.Velocity
+	alive bool
+	look  protocol.Appearance
+	// spawnTick 出現したtick。生存時間の計算に使う
+	spawnTick uint32
+	// survival アウトになったときの生存時間(ミリ秒)。部屋内ランキングに出す
+	survival int64
+	// lastMoveTick 最後に位置が変わったtick。IdleTimeout の判定に使う
+	lastMoveTick uint32
+	// paused ポーズ中は MaxPause まで放置と衝突の判定から外す。pauseTick はポーズしたtick
+	paused    bool
+	pauseTick uint32
+	// pausedTicks 出現してからポーズしていたtick数の合計。生存時間には数えない
+	pausedTicks uint32
+
+	// lastInput 最後に適用した Input.Seq
+	lastInput uint32
+	// rewind 当たり判定で何tick巻き戻すか。最後の入力が届いたtickと Input.ViewTick の差
+	rewind uint32
+	// inputBudget 今受け付けられる入力の数。tickごとに framesPerTick ずつ増える
+	inputBudget float64
+	encoder     protocol.SnapshotEncoder
+	send        chan []byte
+
+	// conn 接続の世代。再開するたびに増やす
+	conn uint32
+	// connected falseの間は接続が切れていて、再接続を待って凍結されている
+	connected      bool
+	disconnectedAt time.Time
+	// disconnectTick 接続が切れたtick
+	disconnectTick uint32
+	// disconnectedTicks 出現してから接続が切れていたtick数の合計。生存時間には数えない
+	disconnectedTicks uint32
+	resumeToken       string
+}
+
+type npc struct {
+	id  uint32
+	pos protocol.Position
+}
+
+func newRoom(id string, cfg config.GameConfig, hub *Hub, logger *slog.Logger) *Room {
+	r := &Room{
+		id:      id,
+		cfg:     cfg,
+		hub:     hub,
+		logger:  logger,
+		inbox:   make(chan func(), 256),
+		done:    make(chan struct{}),
+		rnd:     rand.New(rand.NewSource(time.Now().UnixNano())),
+		players: make(map[uint32]*player),
+		history: newHistory(cfg.MaxRewindTicks()),
+	}
+	for i := 0; i < npcCount; i++ {
+		r.npcs = append(r.npcs, &npc{
+			id: hub.newEntityID(),
+			pos: protocol.Position{
+				X: float64(r.rnd.Intn(sim.WorldWidth-sim.PlayerWidth*2) + sim.PlayerWidth/2),
+				Y: float64(r.rnd.Intn(sim.WorldHeight-sim.PlayerHeight*2) + sim.PlayerHeight/2),
+			},
+		})
+	}
+	return r
+}
+
+// ID 部屋のID
+func (r *Room) ID() string {
+	return r.id
+}
+
+func (r *Room) size() int {
+	return int(r.members.Load())
+}
+
+// do fnを部屋のgoroutineで実行する。部屋が閉じていればfalseを返す
+func (r *Room) do(fn func()) bool {
+	select {
+	case r.inbox <- fn:
+		return true
+	case <-r.done:
+		return false
+	}
+}
+
+// call fnを部屋のgoroutineで実行して結果を待つ
+func (r *Room) call(fn func() (*Client, error)) (*Client, error) {
+	type result struct {
+		client *Client
+		err    error
+	}
+	reply := make(chan result, 1)
+	ok := r.do(func() {
+		client, err := fn()
+		reply <- result{client: client, err: err}
+	})
+	if !ok {
+		return nil, errRoomClosed
+	}
+	select {
+	case res := <-reply:
+		return res.client, res.err
+	case <-r.done:
+		return nil, errRoomClosed
+	}
+}
+
+func (r *Room) join(user *domain.User) (*Client, error) {
+	return r.call(func() (*Client, error) {
+		if len(r.players) >= r.cfg.RoomSize {
+			return nil, ErrRoomFull
+		}
+		p := &player{
+			id:     r.hub.newEntityID(),
+			userID: user.Id,
+			name:   user.Name,
+			look:   protocol.Appearance{Color: user.Color, Skin: user.Skin}.Normalized(),
+		}
+		r.spawn(p)
+		r.players[p.id] = p
+		r.members.Store(int32(len(r.players)))
+
+		client := r.connect(p, false)
+		r.logger.Info("player joined", "player_id", p.id, "user_id", user.Id, "players", len(r.players))
+		return client, nil
+	})
+}
+
+// resume 切断されたプレイヤーに新しい接続をつなぐ
+func (r *Room) resume(id uint32, userID, token string) (*Client, error) {
+	return r.call(func() (*Client, error) {
+		p, ok := r.players[id]
+		if !ok || p.userID != userID || p.resumeToken != token {
+			return nil, ErrResumeFailed
+		}
+		if p.connected {
+			// 古い接続の切断にまだ気づいていない。新しい接続に置き換える
+			close(p.send)
+		}
+		// 新しい接続のデコーダーは基準を持っていないのでフルスナップショットから送り直す
+		p.encoder.Reset()
+		// 凍結されていた間は動けなかったので、放置の判定はここから数え直す
+		p.lastMoveTick = r.tick
+		if !p.connected {
+			p.disconnectedTicks += r.tick - p.disconnectTick
+		}
+		// クライアントも予測をやり直すので、止まったところから始める
+		p.vel = protocol.Velocity{}
+
+		client := r.connect(p, true)
+		r.logger.Info("player resumed", "player_id", p.id, "user_id", userID)
+		return client, nil
+	})
+}
+
+// connect プレイヤーに新しい接続を割り当て、再開用トークンを発行して Welcome を送る
+func (r *Room) connect(p *player, resumed bool) *Client {
+	p.send = make(chan []byte, sendBuffer)
+	p.conn++
+	p.connected = true
+	if p.resumeToken != "" {
+		r.hub.revokeResumeToken(p.resumeToken)
+	}
+	p.resumeToken = r.hub.issueResumeToken(r, p.id)
+
+	r.sendTo(p, &protocol.Welcome{
+		Version:           protocol.Version,
+		PlayerID:          p.id,
+		Room:              r.id,
+		TickRate:          r.cfg.TickRate,
+		ResumeToken:       p.resumeToken,
+		ResumeGraceMillis: r.cfg.ResumeGrace.Milliseconds(),
+		Resumed:           resumed,
+		IdleTimeoutMillis: r.cfg.IdleTimeout.Milliseconds(),
+		MaxPauseMillis:    r.cfg.MaxPause.Milliseconds(),
+		Movement:          r.cfg.Movement.Protocol(),
+	})
+	r.broadcastRoster()
+	return &Client{PlayerID: p.id, Send: p.send, room: r, conn: p.conn}
+}
+
+// disconnect 接続が切れたプレイヤーを凍結する。再接続の猶予がなければすぐに退出させる
+func (r *Room) disconnect(id, conn uint32) {
+	r.do(func() {
+		p, ok := r.players[id]
+		if !ok || p.conn != conn || !p.connected {
+			return
+		}
+		close(p.send)
+		// 凍結している間の時間はポーズではなく切断として数える
+		if p.paused {
+			r.unpause(p)
+		}
+		p.connected = false
+		p.disconnectedAt = time.Now()
+		p.disconnectTick = r.tick
+		if r.cfg.ResumeGrace <= 0 {
+			r.remove(p)
+			return
+		}
+		r.logger.Info("player disconnected, waiting for resume", "player_id", id, "grace", r.cfg.ResumeGrace)
+	})
+}
+
+// remove プレイヤーを部屋から退出させる
+func (r *Room) remove(p *player) {
+	if p.alive {
+		r.recordMatch(p, CauseDisconnect, nil)
+	}
+	delete(r.players, p.id)
+	r.hub.revokeResumeToken(p.resumeToken)
+	r.members.Store(int32(len(r.players)))
+	r.logger.Info("player left", "player_id", p.id, "players", len(r.players))
+	r.broadcastRoster()
+}
+
+// updateAppearance userIDのプレイヤーがいれば見た目を変える
+func (r *Room) updateAppearance(userID string, look protocol.Appearance) {
+	r.do(func() {
+		changed := false
+		for _, p := range r.players {
+			if p.userID == userID {
+				p.look = look
+				changed = true
+			}
+		}
+		if changed {
+			r.broadcastRoster()
+		}
+	})
+}
+
+// handle プレイヤーから届いたメッセージを処理する
+// 再開で置き換わった古い接続 conn から遅れて届いたものは捨てる
+func (r *Room) handle(id, conn uint32, msg protocol.Message) {
+	r.do(func() {
+		p, ok := r.players[id]
+		if !ok || p.conn != conn || !p.connected {
+			return
+		}
+		switch m := msg.(type) {
+		case *protocol.Input:
+			r.applyInput(p, m)
+		case *protocol.SnapshotAck:
+			p.encoder.Ack(m.Seq)
+		case *protocol.Respawn:
+			if !p.alive {
+				r.spawn(p)
+				r.broadcastRoster()
+			}
+		case *protocol.Pause:
+			r.setPaused(p, m.Paused)
+		}
+	})
+}
+
+// applyInput 1フレーム分の入力でプレイヤーを動かす
+// 1tickで進めるフレーム数は inputBudget までに抑え、超えた分は捨てる。
+// 入力を速く送り続けても、実際の時間より速くは動けない
+func (r *Room) applyInput(p *player, m *protocol.Input) {
+	// 古い入力や重複した入力は捨てる
+	if m.Seq <= p.lastInput {
+		return
+	}
+	if p.inputBudget < 1 {
+		r.logger.Debug("input budget exceeded, dropping input", "player_id", p.id, "seq", m.Seq)
+		return
+	}
+	p.inputBudget--
+	p.lastInput = m.Seq
+	p.rewind = r.rewindFor(m.ViewTick)
+	// ポーズ中は動けない
+	if p.alive && !p.paused {
+		b := sim.Step(sim.Body{Pos: p.pos, Vel: p.vel}, m, r.cfg.Movement.Protocol())
+		if b.Pos != p.pos {
+			p.lastMoveTick = r.tick
+		}
+		p.pos, p.vel = b.Pos, b.Vel
+	}
+}
+
+// framesPerTick 1tickの間にクライアントが進めるフレーム(Input)の数
+func (r *Room) framesPerTick() float64 {
+	return float64(r.cfg.TickInterval()) / float64(sim.FrameDuration)
+}
+
+// refillInputBudget 1tick分のフレーム数だけ入力を受け付けられるようにする
+// 通信の揺らぎで入力がまとめて届いても捨てないよう、inputBurstTicks 分までは貯めておける
+func (r *Room) refillInputBudget(p *player) {
+	p.inputBudget = min(p.inputBudget+r.framesPerTick(), r.framesPerTick()*inputBurstTicks)
+}
+
+// setPaused ポーズの開始と終了
+// 次のときはポーズできない: 生きていない、MaxPause が0、このプレイでポーズできる時間を使い切った、何かにぶつかる直前
+func (r *Room) setPaused(p *player, paused bool) {
+	if p.paused == paused {
+		return
+	}
+	if !paused {
+		r.unpause(p)
+		return
+	}
+	if !p.alive || r.cfg.MaxPause <= 0 {
+		return
+	}
+	if p.pausedTicks >= r.cfg.MaxPauseTicks() {
+		r.logger.Debug("pause refused, no pause time left", "player_id", p.id)
+		return
+	}
+	if r.collisionImminent(p) {
+		r.logger.Debug("pause refused, collision imminent", "player_id", p.id)
+		return
+	}
+	p.paused = true
+	p.pauseTick = r.tick
+	p.vel = protocol.Velocity{}
+	r.logger.Debug("player paused", "player_id", p.id)
+}
+
+// unpause ポーズを終える。ポーズしていた間は放置の時間にも数えない
+func (r *Room) unpause(p *player) {
+	paused := r.tick - p.pauseTick
+	p.pausedTicks += paused
+	p.lastMoveTick += paused
+	p.paused = false
+	r.logger.Debug("player unpaused", "player_id", p.id)
+}
+
+// collisionImminent 今の速度のまま pauseLookahead の間進んだとき、何かに pauseClearance より近づくか
+// ぶつかる直前にポーズして当たり判定から逃げられないようにする
+func (r *Room) collisionImminent(p *player) bool {
+	grid := r.obstacles(r.tick - p.rewind)
+	b := sim.Body{Pos: p.pos, Vel: p.vel}
+	frames := int(pauseLookahead / sim.FrameDuration)
+	for i := 0; i <= frames; i++ {
+		bounds := sim.PlayerHitbox.Bounds(b.Pos)
+		area := sim.Collider{
+			ID:    p.id,
+			Pos:   protocol.Position{X: bounds.X1 - pauseClearance, Y: bounds.Y1 - pauseClearance},
+			Shape: sim.AABB{W: bounds.X2 - bounds.X1 + pauseClearance*2, H: bounds.Y2 - bounds.Y1 + pauseClearance*2},
+		}
+		if len(grid.Collisions(area)) > 0 {
+			return true
+		}
+		b = sim.Step(b, &protocol.Input{}, r.cfg.Movement.Protocol())
+	}
+	return false
+}
+
+func (r *Room) run() {
+	ticker := time.NewTicker(r.cfg.TickInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case fn := <-r.inbox:
+			fn()
+		case t := <-ticker.C:
+			r.step()
+			// 予定の時刻から1tick以上かかったら、次のtickに間に合っていない
+			r.hub.recordTick(time.Since(t) > r.cfg.TickInterval())
+		}
+		if len(r.players) == 0 {
+			r.close()
+			return
+		}
+	}
+}
+
+func (r *Room) close() {
+	r.hub.remove(r)
+	close(r.done)
+}
+
+// step 1tick分シミュレーションを進めて、全員にスナップショットを送る
+func (r *Room) step() {
+	r.tick++
+	r.expire()
+	r.expirePauses()
+	for _, p := range r.players {
+		r.refillInputBudget(p)
+	}
+
+	// NPCの移動量は60FPSのクライアントと同じ速さになるようにtickレートで補正する
+	amount := sim.NPCSpeed * 60 / float64(r.cfg.TickRate)
+	for _, n := range r.npcs {
+		n.pos = sim.MoveNPC(n.pos, r.rnd, amount)
+	}
+
+	r.history.record(r.tick, r.players, r.npcs)
+	r.judge()
+	if r.tick%max(uint32(rankingInterval/r.cfg.TickInterval()), 1) == 0 {
+		r.broadcastRanking()
+	}
+
+	entities := make([]protocol.EntityState, 0, len(r.players)+len(r.npcs))
+	for _, p := range r.players {
+		var flags protocol.EntityFlags
+		if !p.alive {
+			flags |= protocol.EntityDead
+		}
+		if !p.connected {
+			flags |= protocol.EntityDisconnected
+		}
+		if p.paused {
+			flags |= protocol.EntityPaused
+		}
+		entities = append(entities, protocol.EntityState{ID: p.id, Position: p.pos, Flags: flags})
+	}
+	for _, n := range r.npcs {
+		entities = append(entities, protocol.EntityState{ID: n.id, Position: n.pos, Flags: protocol.EntityNPC})
+	}
+
+	for _, p := range r.players {
+		if !p.connected {
+			continue
+		}
+		data, _, err := p.encoder.Encode(&protocol.EntitySnapshot{
+			Tick:      r.tick,
+			LastInput: p.lastInput,
+			Velocity:  p.vel,
+			Entities:  entities,
+		})
+		if err != nil {
+			r.logger.Error("encode snapshot failed", "player_id", p.id, "err", err)
+			continue
+		}
+		r.sendRaw(p, data)
+	}
+}
+
+// expire 再接続の猶予が過ぎたプレイヤーを退出させる
+func (r *Room) expire() {
+	for _, p := range r.players {
+		if !p.connected && time.Since(p.disconnectedAt) > r.cfg.ResumeGrace {
+			r.logger.Info("resume grace expired", "player_id", p.id)
+			r.remove(p)
+		}
+	}
+}
+
+// expirePauses MaxPause を過ぎてもポーズしているプレイヤーを、ポーズしていない扱いに戻す
+// MaxPause は1回のプレイ(出現からアウトまで)でポーズできる時間の合計で、前にポーズしていた分も数える
+func (r *Room) expirePauses() {
+	limit := r.cfg.MaxPauseTicks()
+	for _, p := range r.players {
+		if p.paused && p.pausedTicks+r.tick-p.pauseTick >= limit {
+			r.logger.Info("pause expired", "player_id", p.id)
+			r.unpause(p)
+		}
+	}
+}
+
+// judge 放置と、壁・NPC・他のプレイヤーとの衝突を判定し、当てはまったプレイヤーをアウトにする
+func (r *Room) judge() {
+	var dead []*player
+	var causes []string
+	idle := r.cfg.IdleTicks()
+	// 巻き戻すtickごとに1つ作る。ほとんどのプレイヤーは同じくらいの遅延なので数は少ない
+	obstacles := make(map[uint32]*sim.Grid)
+	for _, p := range r.players {
+		if !p.alive || !p.connected || p.paused {
+			continue
+		}
+		if idle > 0 && r.tick-p.lastMoveTick >= idle {
+			dead = append(dead, p)
+			causes = append(causes, CauseIdle)
+			continue
+		}
+		tick := r.tick - p.rewind
+		grid, ok := obstacles[tick]
+		if !ok {
+			grid = r.obstacles(tick)
+			obstacles[tick] = grid
+		}
+		if cause := collide(p, grid); cause != "" {
+			dead = append(dead, p)
+			causes = append(causes, cause)
+		}
+	}
+	for i, p := range dead {
+		r.kill(p, causes[i])
+	}
+}
+
+// collide pがぶつかったものの死因。何にもぶつかっていなければ空
+func collide(p *player, obstacles *sim.Grid) string {
+	events := obstacles.Collisions(sim.Collider{ID: p.id, Pos: p.pos, Shape: sim.PlayerHitbox})
+	if len(events) == 0 {
+		return ""
+	}
+	return events[0].Cause
+}
+
+// obstacles 壁・NPC・他のプレイヤーの当たり判定を入れた Grid
+// NPCとプレイヤーは tick の時点(プレイヤーが見ていた時点)の位置に置く。壁・NPC・プレイヤーの順に死因を優先する
+func (r *Room) obstacles(tick uint32) *sim.Grid {
+	grid := sim.NewGrid(sim.GridCellSize)
+	for _, w := range sim.WallColliders(sim.Arena()) {
+		grid.Insert(w)
+	}
+	seen, _ := r.history.at(tick)
+	for _, n := range r.npcs {
+		pos := n.pos
+		if e, ok := seen[n.id]; ok {
+			pos = e.pos
+		}
+		grid.Insert(sim.Collider{ID: n.id, Pos: pos, Shape: sim.NPCHitbox, Cause: CauseNPC})
+	}
+	for _, o := range r.players {
+		// 再接続を待っているプレイヤーとポーズ中のプレイヤーは凍結中なので当たらない
+		if !o.alive || !o.connected || o.paused {
+			continue
+		}
+		pos := o.pos
+		if e, ok := seen[o.id]; ok {
+			if !e.alive {
+				continue
+			}
+			pos = e.pos
+		}
+		grid.Insert(sim.Collider{ID: o.id, Pos: pos, Shape: sim.PlayerHitbox, Cause: CausePlayer})
+	}
+	return grid
+}
+
+// rewindFor クライアントが描画していたtickから巻き戻すtick数を決める。最大 MaxRewind まで
+func (r *Room) rewindFor(viewTick uint32) uint32 {
+	if viewTick == 0 || viewTick >= r.tick {
+		return 0
+	}
+	return min(r.tick-viewTick, r.cfg.MaxRewindTicks())
+}
+
+func (r *Room) kill(p *player, cause string) {
+	p.survival = r.survivalMillis(p)
+	p.alive = false
+	r.logger.Info("player died", "player_id", p.id, "cause", cause)
+	r.broadcast(&protocol.Death{PlayerID: p.id, Cause: cause})
+
+	id := p.id
+	r.recordMatch(p, cause, func(result *domain.MatchResult) {
+		r.do(func() {
+			// 保存している間に退出していれば送らない
+			if r.players[id] != p {
+				return
+			}
+			r.sendTo(p, &protocol.RunResult{
+				SurvivalMillis:  p.survival,
+				HighScoreMillis: int64(result.HighScore),
+				NewBest:         result.NewBest,
+				GlobalRank:      result.GlobalRank,
+				TotalPlayers:    result.TotalUsers,
+			})
+		})
+	})
+}
+
+// survivalMillis 生きていれば出現してからポーズ中と切断中を除いた時間、アウトならそのときの生存時間
+func (r *Room) survivalMillis(p *player) int64 {
+	if !p.alive {
+		return p.survival
+	}
+	ticks := r.tick - p.spawnTick - p.pausedTicks - p.disconnectedTicks
+	if p.paused {
+		ticks -= r.tick - p.pauseTick
+	}
+	if !p.connected {
+		ticks -= r.tick - p.disconnectTick
+	}
+	return (time.Duration(ticks) * r.cfg.TickInterval()).Milliseconds()
+}
+
+// recordMatch 出現してからアウトになるまでのプレイ結果を保存する。done は保存できたら呼ばれる
+func (r *Room) recordMatch(p *player, cause string, done func(*domain.MatchResult)) {
+	r.hub.recordMatch(&domain.Match{
+		UserId:         p.userID,
+		Room:           r.id,
+		SurvivalMillis: r.survivalMillis(p),
+		Cause:          cause,
+		EndedAt:        time.Now(),
+	}, done)
+}
+
+// spawn 他のプレイヤーやNPCと重ならない位置にプレイヤーを出現させる
+func (r *Room) spawn(p *player) {
+	occupied := sim.NewGrid(sim.GridCellSize)
+	for _, o := range r.players {
+		if o != p && o.alive {
+			occupied.Insert(sim.Collider{ID: o.id, Pos: o.pos, Shape: sim.PlayerHitbox})
+		}
+	}
+	for _, n := range r.npcs {
+		occupied.Insert(sim.Collider{ID: n.id, Pos: n.pos, Shape: sim.NPCHitbox})
+	}
+	p.pos = sim.SpawnPosition(r.rnd, occupied)
+	p.vel = protocol.Velocity{}
+	p.alive = true
+	p.spawnTick = r.tick
+	p.lastMoveTick = r.tick
+	p.paused = false
+	p.pausedTicks = 0
+	p.disconnectedTicks = 0
+}
+
+// broadcastRoster 名前などを含む部屋の状態を全員に送る。プレイヤーの出入りのときに呼ぶ
+func (r *Room) broadcastRoster() {
+	snap := &protocol.Snapshot{Tick: r.tick}
+	for _, p := range r.players {
+		snap.Players = append(snap.Players, protocol.PlayerInfo{ID: p.id, Name: p.name, Position: p.pos, Appearance: p.look})
+	}
+	for i, n := range r.npcs {
+		snap.Players = append(snap.Players, protocol.PlayerInfo{ID: n.id, Name: npcName(i), Position: n.pos, NPC: true})
+	}
+	r.broadcast(snap)
+}
+
+// broadcastRanking 部屋の全員の生存時間ランキングを送る
+func (r *Room) broadcastRanking() {
+	ranking := &protocol.Ranking{Entries: make([]protocol.RankingEntry, 0, len(r.players))}
+	for _, p := range r.players {
+		ranking.Entries = append(ranking.Entries, protocol.RankingEntry{
+			PlayerID:       p.id,
+			Name:           p.name,
+			SurvivalMillis: r.survivalMillis(p),
+			Alive:          p.alive && p.connected && !p.paused,
+		})
+	}
+	slices.SortFunc(ranking.Entries, func(a, b protocol.RankingEntry) int {
+		if a.SurvivalMillis != b.SurvivalMillis {
+			return cmp.Compare(b.SurvivalMillis, a.SurvivalMillis)
+		}
+		return cmp.Compare(a.PlayerID, b.PlayerID)
+	})
+	r.broadcast(ranking)
+}
+
+func npcName(i int) string {
+	return fmt.Sprintf("NPC%d", i+1)
+}
+
+func (r *Room) broadcast(msg protocol.Message) {
+	for _, p := range r.players {
+		r.sendTo(p, msg)
+	}
+}
+
+func (r *Room) sendTo(p *player, msg protocol.Message) {
+	data, err := protocol.Encode(msg)
+	if err != nil {
+		r.logger.Error("encode message failed", "type", msg.MessageType(), "err", err)
+		return
+	}
+	r.sendRaw(p, data)
+}
+
+// sendRaw 送信キューに積む。詰まっているプレイヤーと接続が切れているプレイヤーの分は捨てる
+func (r *Room) sendRaw(p *player, data []byte) {
+	if !p.connected {
+		return
+	}
+	select {
+	case p.send <- data:
+	default:
+		r.logger.Debug("send buffer full, dropping frame", "player_id", p.id)
+	}
+}
@@ -0,0 +1,262 @@
+package game
+
+import (
+	"example.com/config"
+	"github.com/eiei114/dinosaur-jump/protocol"
+	"github.com/eiei114/dinosaur-jump/protocol/sim"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+// newTestRoom run を動かさずに部屋を作る。テストからは部屋のgoroutineの代わりに直接メソッドを呼ぶ
+func newTestRoom(t *testing.T, cfg config.GameConfig) *Room {
+	t.Helper()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	return newRoom("test", cfg, NewHub(cfg, logger, nil), logger)
+}
+
+// addTestPlayer 接続済みのプレイヤーを pos に置く
+func addTestPlayer(r *Room, pos protocol.Position) *player {
+	p := &player{id: r.hub.newEntityID(), send: make(chan []byte, sendBuffer), connected: true}
+	r.spawn(p)
+	p.pos = pos
+	r.players[p.id] = p
+	return p
+}
+
+func TestInputBudget(t *testing.T) {
+	cfg := config.Default().Game
+	cfg.TickRate = 20
+	r := newTestRoom(t, cfg)
+	r.npcs = nil
+	p := addTestPlayer(r, protocol.Position{X: 300, Y: 300})
+	perTick := int(r.framesPerTick())
+
+	// 1tickの間に大量の入力を送っても、1tick分のフレームしか進まない
+	r.step()
+	seq := uint32(0)
+	for i := 0; i < 100; i++ {
+		seq++
+		r.applyInput(p, &protocol.Input{Seq: seq, Right: true})
+	}
+	if p.lastInput != uint32(perTick) {
+		t.Errorf("applied %d inputs in one tick, want %d", p.lastInput, perTick)
+	}
+
+	// 何tickか入力がなければ、inputBurstTicks 分まで貯まる
+	for i := 0; i < 10; i++ {
+		r.step()
+	}
+	applied := 0
+	for i := 0; i < 100; i++ {
+		seq++
+		before := p.lastInput
+		r.applyInput(p, &protocol.Input{Seq: seq, Right: true})
+		if p.lastInput != before {
+			applied++
+		}
+	}
+	if applied != perTick*inputBurstTicks {
+		t.Errorf("applied %d inputs after idle ticks, want %d", applied, perTick*inputBurstTicks)
+	}
+
+	// 古い入力は予算があっても捨てる
+	r.step()
+	last := p.lastInput
+	r.applyInput(p, &protocol.Input{Seq: 1, Left: true})
+	if p.lastInput != last {
+		t.Errorf("lastInput = %d after an old input, want %d", p.lastInput, last)
+	}
+}
+
+func TestPause(t *testing.T) {
+	cfg := config.Default().Game
+	cfg.TickRate = 20
+	cfg.IdleTimeout = 2 * time.Second
+	cfg.MaxPause = time.Second
+	r := newTestRoom(t, cfg)
+	r.npcs = nil
+	p := addTestPlayer(r, protocol.Position{X: 300, Y: 300})
+
+	// 動かずに1秒経ってからポーズする
+	for i := 0; i < 20; i++ {
+		r.step()
+	}
+	r.setPaused(p, true)
+	if !p.paused {
+		t.Fatal("pause refused in open space")
+	}
+	for i := 0; i < 10; i++ {
+		r.step()
+	}
+	r.setPaused(p, false)
+
+	// ポーズしていた間は放置の時間に数えないので、残りは1秒のまま
+	idleLeft := r.cfg.IdleTicks() - (r.tick - p.lastMoveTick)
+	if want := uint32(20); idleLeft != want {
+		t.Errorf("idle ticks left after unpause = %d, want %d", idleLeft, want)
+	}
+
+	// MaxPause は1回のプレイでの合計。残りの0.5秒で期限が切れる
+	r.setPaused(p, true)
+	for i := 0; i < 10; i++ {
+		r.step()
+	}
+	if p.paused {
+		t.Error("still paused after using up MaxPause")
+	}
+	r.setPaused(p, true)
+	if p.paused {
+		t.Error("paused again after using up MaxPause")
+	}
+
+	// 出現し直したらまたポーズできる
+	r.spawn(p)
+	p.pos = protocol.Position{X: 300, Y: 300}
+	r.setPaused(p, true)
+	if !p.paused {
+		t.Error("pause refused after respawn")
+	}
+}
+
+func TestSurvivalExcludesDisconnect(t *testing.T) {
+	cfg := config.Default().Game
+	cfg.TickRate = 20
+	cfg.MaxPause = time.Second
+	r := newTestRoom(t, cfg)
+	r.npcs = nil
+	p := addTestPlayer(r, protocol.Position{X: 300, Y: 300})
+	steps := func(n int) {
+		for i := 0; i < n; i++ {
+			r.step()
+		}
+	}
+	// 部屋のgoroutineは動かしていないので、inbox に入ったものをここで実行する
+	disconnect := func() {
+		r.disconnect(p.id, p.conn)
+		(<-r.inbox)()
+	}
+	resume := func() {
+		done := make(chan error, 1)
+		go func(token string) {
+			_, err := r.resume(p.id, p.userID, token)
+			done <- err
+		}(p.resumeToken)
+		(<-r.inbox)()
+		if err := <-done; err != nil {
+			t.Fatalf("resume: %v", err)
+		}
+	}
+	check := func(want int64) {
+		t.Helper()
+		if got := r.survivalMillis(p); got != want {
+			t.Errorf("survival = %dms, want %dms", got, want)
+		}
+	}
+
+	steps(20)
+	check(1000)
+
+	// 切断されている間は止まる
+	disconnect()
+	steps(40)
+	check(1000)
+	resume()
+	steps(20)
+	check(2000)
+
+	// ポーズ中に切れたら、そこからは切断として数える。二重には引かない
+	r.setPaused(p, true)
+	steps(10)
+	disconnect()
+	if p.paused {
+		t.Error("still paused after disconnecting")
+	}
+	steps(10)
+	resume()
+	steps(10)
+	check(2500)
+
+	// 出現し直したら数え直す
+	disconnect()
+	steps(10)
+	resume()
+	r.kill(p, protocol.CauseWall)
+	r.spawn(p)
+	steps(20)
+	check(1000)
+}
+
+func TestPauseRefusedBeforeCollision(t *testing.T) {
+	cfg := config.Default().Game
+	cfg.MaxPause = time.Second
+	r := newTestRoom(t, cfg)
+	r.npcs = nil
+	p := addTestPlayer(r, protocol.Position{X: 300, Y: 300})
+	r.step()
+
+	// 壁に向かって速く動いている
+	arena := sim.Arena()
+	p.pos = protocol.Position{X: arena.X2 - sim.PlayerWidth - 20, Y: 300}
+	p.vel = protocol.Velocity{X: cfg.Movement.MaxSpeed}
+	r.setPaused(p, true)
+	if p.paused {
+		t.Error("paused right before hitting the wall")
+	}
+
+	// 同じ場所でも、壁から離れる向きなら止まれる
+	p.vel = protocol.Velocity{X: -cfg.Movement.MaxSpeed}
+	r.setPaused(p, true)
+	if !p.paused {
+		t.Error("pause refused while moving away from the wall")
+	}
+}
+
+func TestRewindJudge(t *testing.T) {
+	cfg := config.Default().Game
+	cfg.TickRate = 20
+	cfg.MaxRewind = 200 * time.Millisecond
+	// NPCは1tickに90px右へ動く。隣のtickの位置とは当たり判定が重ならない
+	npcAt := func(tick uint32) protocol.Position {
+		return protocol.Position{X: 60 + 90*float64(tick-1), Y: 300}
+	}
+	const now = 6
+
+	tests := []struct {
+		name    string
+		latency time.Duration
+		// at プレイヤーを置く位置。何tick目のNPCの位置か
+		at   uint32
+		dead bool
+	}{
+		{name: "0ms/current", latency: 0, at: now, dead: true},
+		{name: "0ms/past", latency: 0, at: now - 2, dead: false},
+		{name: "100ms/seen", latency: 100 * time.Millisecond, at: now - 2, dead: true},
+		{name: "100ms/current", latency: 100 * time.Millisecond, at: now, dead: false},
+		{name: "250ms/seen", latency: 250 * time.Millisecond, at: now - 5, dead: false},
+		{name: "250ms/max rewind", latency: 250 * time.Millisecond, at: now - 4, dead: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRoom(t, cfg)
+			n := &npc{id: r.hub.newEntityID(), pos: npcAt(1)}
+			r.npcs = []*npc{n}
+			p := addTestPlayer(r, npcAt(tt.at))
+			for tick := uint32(1); tick <= now; tick++ {
+				r.tick = tick
+				n.pos = npcAt(tick)
+				r.history.record(r.tick, r.players, r.npcs)
+			}
+			p.lastMoveTick = r.tick
+
+			viewTick := r.tick - uint32(tt.latency/cfg.TickInterval())
+			p.rewind = r.rewindFor(viewTick)
+			r.judge()
+			if p.alive == tt.dead {
+				t.Errorf("alive = %v with rewind %d ticks, want %v", p.alive, p.rewind, !tt.dead)
+			}
+		})
+	}
+}
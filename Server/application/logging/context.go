@@ -0,0 +1,40 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+)
+
+type key string
+
+const (
+	loggerKey    key = "logger"
+	requestIDKey key = "requestID"
+)
+
+// SetLogger Contextへロガーを保存する
+func SetLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey, logger)
+}
+
+// FromContext Contextからロガーを取得する。保存されていなければデフォルトのロガーを返す
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// SetRequestID ContextへリクエストIDを保存する
+func SetRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey, requestID)
+}
+
+// GetRequestIDFromContext ContextからリクエストIDを取得する
+func GetRequestIDFromContext(ctx context.Context) string {
+	var requestID string
+	if ctx.Value(requestIDKey) != nil {
+		requestID = ctx.Value(requestIDKey).(string)
+	}
+	return requestID
+}
@@ -3,20 +3,26 @@ package middleware
 import (
 	"errors"
 	"example.com/application/auth"
+	"example.com/application/logging"
 	"example.com/application/service"
+	"example.com/config"
 	"fmt"
 	"github.com/uptrace/bunrouter"
-	"log"
+	"log/slog"
 	"net/http"
 )
 
 type Middleware struct {
 	UserService *service.UserService
+	Logger      *slog.Logger
+	Config      *config.Config
 }
 
-func NewMiddleware(userService *service.UserService) *Middleware {
+func NewMiddleware(userService *service.UserService, logger *slog.Logger, cfg *config.Config) *Middleware {
 	return &Middleware{
 		UserService: userService,
+		Logger:      logger,
+		Config:      cfg,
 	}
 }
 
@@ -26,46 +32,34 @@ func (m *Middleware) AuthenticateMiddleware() func(bunrouter.HandlerFunc) bunrou
 			ctx := req.Context()
 			token := req.Header.Get("x-token")
 			if token == "" {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
 				return errors.New("x-token is empty")
 			}
 
 			user, err := m.UserService.GetUserByAuthToken(ctx, token)
 			if err != nil {
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 				return err
 			}
 			if user == nil {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
 				return fmt.Errorf("user not found. token=%s", token)
 			}
 
 			ctx = auth.SetUserID(ctx, user.Id)
+			ctx = logging.SetLogger(ctx, logging.FromContext(ctx).With("user_id", user.Id))
 			req = req.WithContext(ctx)
 			return next(w, req)
 		}
 	}
 }
 
-func (m *Middleware) CorsMiddleware() func(bunrouter.HandlerFunc) bunrouter.HandlerFunc {
-	return func(next bunrouter.HandlerFunc) bunrouter.HandlerFunc {
-		return func(w http.ResponseWriter, req bunrouter.Request) error {
-			h := w.Header()
-			h.Set("Access-Control-Allow-Origin", "*")
-			h.Set("Access-Control-Allow-Methods", "GET,POST,PUT,DELETE,OPTIONS")
-			h.Set("Access-Control-Allow-Headers", "Content-Type,Accept,Origin,x-token")
-
-			if req.Method == http.MethodOptions {
-				return nil
-			}
-			return next(w, req)
-		}
-	}
-}
-
 func (m *Middleware) RecoverMiddleware() func(bunrouter.HandlerFunc) bunrouter.HandlerFunc {
 	return func(next bunrouter.HandlerFunc) bunrouter.HandlerFunc {
 		return func(w http.ResponseWriter, req bunrouter.Request) error {
 			defer func() {
 				if r := recover(); r != nil {
-					log.Printf("recovered from panic: %v", r)
+					logging.FromContext(req.Context()).Error("recovered from panic", "panic", r)
 					http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 				}
 			}()
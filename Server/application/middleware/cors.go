@@ -0,0 +1,233 @@
+package middleware
+
+import (
+	"github.com/uptrace/bunrouter"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// corsAllowedHeaders ブラウザから送ってよいリクエストヘッダー
+var corsAllowedHeaders = []string{"Content-Type", "Accept", "Origin", "x-token", RequestIDHeader}
+
+// RouteTable ルートごとに登録されたHTTPメソッドを記録する
+// CORSのプリフライトで、そのルートが実際に受け付けるメソッドだけを返すために使う
+type RouteTable struct {
+	mu      sync.RWMutex
+	methods map[string][]string
+}
+
+func NewRouteTable() *RouteTable {
+	return &RouteTable{methods: make(map[string][]string)}
+}
+
+// Group gにルートを登録しつつ、そのメソッドをテーブルに記録するGroupを返す
+func (t *RouteTable) Group(g *bunrouter.Group) *RouteGroup {
+	return &RouteGroup{Group: g, table: t}
+}
+
+// Methods routeに登録されているメソッドの一覧を返す
+func (t *RouteTable) Methods(route string) []string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.methods[route]
+}
+
+// Routes 登録されているルートと、それぞれのメソッドの一覧を返す
+func (t *RouteTable) Routes() map[string][]string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	routes := make(map[string][]string, len(t.methods))
+	for route, methods := range t.methods {
+		routes[route] = append([]string(nil), methods...)
+	}
+	return routes
+}
+
+func (t *RouteTable) add(method, route string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.methods[route] = append(t.methods[route], method)
+	sort.Strings(t.methods[route])
+}
+
+// RouteGroup 登録したルートをRouteTableに記録するbunrouter.Group
+type RouteGroup struct {
+	*bunrouter.Group
+	table *RouteTable
+}
+
+func (g *RouteGroup) Handle(method, path string, handler bunrouter.HandlerFunc) {
+	g.Group.Handle(method, path, handler)
+	g.table.add(method, path)
+}
+
+func (g *RouteGroup) GET(path string, handler bunrouter.HandlerFunc) {
+	g.Handle(http.MethodGet, path, handler)
+}
+
+func (g *RouteGroup) POST(path string, handler bunrouter.HandlerFunc) {
+	g.Handle(http.MethodPost, path, handler)
+}
+
+func (g *RouteGroup) PUT(path string, handler bunrouter.HandlerFunc) {
+	g.Handle(http.MethodPut, path, handler)
+}
+
+func (g *RouteGroup) DELETE(path string, handler bunrouter.HandlerFunc) {
+	g.Handle(http.MethodDelete, path, handler)
+}
+
+func (g *RouteGroup) PATCH(path string, handler bunrouter.HandlerFunc) {
+	g.Handle(http.MethodPatch, path, handler)
+}
+
+// originPattern 許可オリジン1件分。 host が "*." で始まる場合はサブドメインすべてにマッチする
+type originPattern struct {
+	any    bool
+	scheme string
+	host   string // ポート込み。ワイルドカードの場合は ".example.com" のようなサフィックス
+	suffix bool
+}
+
+func parseOriginPattern(s string) (originPattern, bool) {
+	if s == "*" {
+		return originPattern{any: true}, true
+	}
+	u, err := url.Parse(s)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return originPattern{}, false
+	}
+	p := originPattern{scheme: strings.ToLower(u.Scheme), host: strings.ToLower(u.Host)}
+	if strings.HasPrefix(p.host, "*.") {
+		p.host = p.host[1:]
+		p.suffix = true
+	}
+	return p, true
+}
+
+func (p originPattern) match(origin string) bool {
+	if p.any {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil || !strings.EqualFold(u.Scheme, p.scheme) {
+		return false
+	}
+	host := strings.ToLower(u.Host)
+	if p.suffix {
+		// *.example.com は a.example.com や a.b.example.com にはマッチするが example.com にはマッチしない
+		return len(host) > len(p.host) && strings.HasSuffix(host, p.host)
+	}
+	return host == p.host
+}
+
+// OriginAllowed 設定の許可オリジンに origin が含まれるか
+// CORSの対象外のWebSocketのハンドシェイクでも同じ基準で検証するために使う
+func (m *Middleware) OriginAllowed(origin string) bool {
+	for _, s := range m.Config.CORS.AllowedOrigins {
+		if p, ok := parseOriginPattern(s); ok && p.match(origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// CorsMiddleware 設定の許可オリジンに対してだけCORSヘッダーを返すMiddleware
+// プリフライトには routes に登録されているメソッドだけを許可として返す
+func (m *Middleware) CorsMiddleware(routes *RouteTable) func(bunrouter.HandlerFunc) bunrouter.HandlerFunc {
+	cfg := m.Config.CORS
+
+	var patterns []originPattern
+	allowAny := false
+	for _, s := range cfg.AllowedOrigins {
+		p, ok := parseOriginPattern(s)
+		if !ok {
+			m.Logger.Warn("ignoring invalid CORS origin", "origin", s)
+			continue
+		}
+		allowAny = allowAny || p.any
+		patterns = append(patterns, p)
+	}
+	allowed := func(origin string) bool {
+		for _, p := range patterns {
+			if p.match(origin) {
+				return true
+			}
+		}
+		return false
+	}
+
+	allowHeaders := strings.Join(corsAllowedHeaders, ",")
+	maxAge := strconv.Itoa(int(cfg.MaxAge.Seconds()))
+
+	return func(next bunrouter.HandlerFunc) bunrouter.HandlerFunc {
+		return func(w http.ResponseWriter, req bunrouter.Request) error {
+			origin := req.Header.Get("Origin")
+			if origin == "" {
+				// ブラウザ以外からのリクエストはCORSと関係ない
+				return next(w, req)
+			}
+
+			h := w.Header()
+			h.Add("Vary", "Origin")
+
+			preflight := req.Method == http.MethodOptions && req.Header.Get("Access-Control-Request-Method") != ""
+			if !allowed(origin) {
+				if preflight {
+					w.WriteHeader(http.StatusForbidden)
+					return nil
+				}
+				return next(w, req)
+			}
+
+			// 認証情報付きの場合は "*" を返せないので、常にオリジンをそのまま返す
+			if allowAny && !cfg.AllowCredentials {
+				h.Set("Access-Control-Allow-Origin", "*")
+			} else {
+				h.Set("Access-Control-Allow-Origin", origin)
+			}
+			if cfg.AllowCredentials {
+				h.Set("Access-Control-Allow-Credentials", "true")
+			}
+			h.Set("Access-Control-Expose-Headers", RequestIDHeader)
+
+			if !preflight {
+				return next(w, req)
+			}
+
+			methods := routes.Methods(req.Route())
+			if len(methods) == 0 {
+				return next(w, req)
+			}
+			allowMethods := strings.Join(append(methods[:len(methods):len(methods)], http.MethodOptions), ",")
+			if !containsMethod(methods, req.Header.Get("Access-Control-Request-Method")) {
+				h.Set("Allow", allowMethods)
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return nil
+			}
+
+			h.Add("Vary", "Access-Control-Request-Method")
+			h.Add("Vary", "Access-Control-Request-Headers")
+			h.Set("Access-Control-Allow-Methods", allowMethods)
+			h.Set("Access-Control-Allow-Headers", allowHeaders)
+			if cfg.MaxAge > 0 {
+				h.Set("Access-Control-Max-Age", maxAge)
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return nil
+		}
+	}
+}
+
+func containsMethod(methods []string, method string) bool {
+	for _, m := range methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
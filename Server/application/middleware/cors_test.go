@@ -0,0 +1,194 @@
+package middleware
+
+import (
+	"example.com/config"
+	"github.com/uptrace/bunrouter"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+)
+
+// newCorsRouter CorsMiddleware をかけたルーターを作る。/users は GET と POST、/users/:id は GET だけ
+func newCorsRouter(cors config.CORSConfig) *bunrouter.Router {
+	cfg := config.Default()
+	cfg.CORS = cors
+	m := NewMiddleware(nil, slog.New(slog.NewTextHandler(io.Discard, nil)), cfg)
+
+	routes := NewRouteTable()
+	router := bunrouter.New(bunrouter.Use(m.CorsMiddleware(routes)))
+	ok := func(w http.ResponseWriter, req bunrouter.Request) error {
+		w.WriteHeader(http.StatusOK)
+		return nil
+	}
+	g := routes.Group(&router.Group)
+	g.GET("/users", ok)
+	g.POST("/users", ok)
+	g.GET("/users/:id", ok)
+	return router
+}
+
+func corsRequest(router http.Handler, method, path, origin, requestMethod string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	if origin != "" {
+		req.Header.Set("Origin", origin)
+	}
+	if requestMethod != "" {
+		req.Header.Set("Access-Control-Request-Method", requestMethod)
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestOriginPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		origin  string
+		want    bool
+	}{
+		{"https://example.com", "https://example.com", true},
+		{"https://example.com", "https://EXAMPLE.com", true},
+		{"https://example.com", "http://example.com", false},
+		{"https://example.com", "https://example.com:8443", false},
+		{"https://example.com", "https://a.example.com", false},
+		{"http://localhost:3000", "http://localhost:3000", true},
+		{"http://localhost:3000", "http://localhost:3001", false},
+		// *.example.com はサブドメインだけにマッチする
+		{"https://*.example.com", "https://a.example.com", true},
+		{"https://*.example.com", "https://a.b.example.com", true},
+		{"https://*.example.com", "https://example.com", false},
+		{"https://*.example.com", "https://evilexample.com", false},
+		{"https://*.example.com", "https://a.example.com.evil.com", false},
+		{"https://*.example.com", "http://a.example.com", false},
+		{"*", "https://anything.test", true},
+	}
+	for _, tt := range tests {
+		p, ok := parseOriginPattern(tt.pattern)
+		if !ok {
+			t.Fatalf("parseOriginPattern(%q) failed", tt.pattern)
+		}
+		if got := p.match(tt.origin); got != tt.want {
+			t.Errorf("%q matching %q = %v, want %v", tt.pattern, tt.origin, got, tt.want)
+		}
+	}
+
+	for _, s := range []string{"example.com", "https://", ""} {
+		if _, ok := parseOriginPattern(s); ok {
+			t.Errorf("parseOriginPattern(%q) accepted an invalid origin", s)
+		}
+	}
+}
+
+func TestCorsMiddleware(t *testing.T) {
+	router := newCorsRouter(config.CORSConfig{
+		AllowedOrigins: []string{"https://example.com", "https://*.example.com"},
+		MaxAge:         10 * time.Minute,
+	})
+
+	tests := []struct {
+		name          string
+		method        string
+		path          string
+		origin        string
+		requestMethod string
+		status        int
+		allowOrigin   string
+		allowMethods  string
+	}{
+		{"no origin", http.MethodGet, "/users", "", "", http.StatusOK, "", ""},
+		{"exact origin", http.MethodGet, "/users", "https://example.com", "", http.StatusOK, "https://example.com", ""},
+		{"subdomain", http.MethodGet, "/users", "https://app.example.com", "", http.StatusOK, "https://app.example.com", ""},
+		// 許可していないオリジンでも通常のリクエストは通し、CORSヘッダーを付けない
+		{"disallowed origin", http.MethodGet, "/users", "https://evilexample.com", "", http.StatusOK, "", ""},
+		{"preflight", http.MethodOptions, "/users", "https://example.com", http.MethodPost, http.StatusNoContent, "https://example.com", "GET,POST,OPTIONS"},
+		{"preflight with a param", http.MethodOptions, "/users/42", "https://app.example.com", http.MethodGet, http.StatusNoContent, "https://app.example.com", "GET,OPTIONS"},
+		{"preflight from the apex of a wildcard", http.MethodOptions, "/users", "https://evilexample.com", http.MethodGet, http.StatusForbidden, "", ""},
+		{"preflight from a disallowed origin", http.MethodOptions, "/users", "https://evil.test", http.MethodGet, http.StatusForbidden, "", ""},
+		{"preflight for an unregistered method", http.MethodOptions, "/users/42", "https://example.com", http.MethodDelete, http.StatusMethodNotAllowed, "https://example.com", ""},
+		// 登録されていないルートはルーターに任せて 404 にする
+		{"preflight for an unknown route", http.MethodOptions, "/nope", "https://example.com", http.MethodGet, http.StatusNotFound, "https://example.com", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := corsRequest(router, tt.method, tt.path, tt.origin, tt.requestMethod)
+			h := rec.Header()
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d", rec.Code, tt.status)
+			}
+			if got := h.Get("Access-Control-Allow-Origin"); got != tt.allowOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.allowOrigin)
+			}
+			if got := h.Get("Access-Control-Allow-Methods"); got != tt.allowMethods {
+				t.Errorf("Access-Control-Allow-Methods = %q, want %q", got, tt.allowMethods)
+			}
+			// オリジンによって結果が変わるので、Origin 付きのリクエストには必ず Vary: Origin を返す
+			if vary := h.Values("Vary"); tt.origin != "" && !slices.Contains(vary, "Origin") {
+				t.Errorf("Vary = %q, want it to include Origin", vary)
+			}
+			if h.Get("Access-Control-Allow-Credentials") != "" {
+				t.Error("credentials are allowed although allow_credentials is off")
+			}
+
+			maxAge := ""
+			if tt.status == http.StatusNoContent {
+				maxAge = "600"
+			}
+			if got := h.Get("Access-Control-Max-Age"); got != maxAge {
+				t.Errorf("Access-Control-Max-Age = %q, want %q", got, maxAge)
+			}
+			if tt.status == http.StatusMethodNotAllowed && tt.path == "/users/42" && h.Get("Allow") != "GET,OPTIONS" {
+				t.Errorf("Allow = %q, want GET,OPTIONS", h.Get("Allow"))
+			}
+		})
+	}
+}
+
+func TestCorsMiddlewareMaxAgeDisabled(t *testing.T) {
+	router := newCorsRouter(config.CORSConfig{AllowedOrigins: []string{"https://example.com"}})
+	rec := corsRequest(router, http.MethodOptions, "/users", "https://example.com", http.MethodGet)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusNoContent)
+	}
+	if got := rec.Header().Get("Access-Control-Max-Age"); got != "" {
+		t.Errorf("Access-Control-Max-Age = %q, want none when max_age is 0", got)
+	}
+}
+
+func TestCorsMiddlewareCredentials(t *testing.T) {
+	tests := []struct {
+		name        string
+		cors        config.CORSConfig
+		allowOrigin string
+		credentials string
+	}{
+		{"any origin", config.CORSConfig{AllowedOrigins: []string{"*"}}, "*", ""},
+		// 認証情報付きでは "*" を返さず、オリジンをそのまま返す
+		{"any origin with credentials", config.CORSConfig{AllowedOrigins: []string{"*"}, AllowCredentials: true}, "https://example.com", "true"},
+		{"listed origin with credentials", config.CORSConfig{AllowedOrigins: []string{"https://example.com"}, AllowCredentials: true}, "https://example.com", "true"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := newCorsRouter(tt.cors)
+			for _, method := range []string{http.MethodGet, http.MethodOptions} {
+				requestMethod := ""
+				if method == http.MethodOptions {
+					requestMethod = http.MethodGet
+				}
+				h := corsRequest(router, method, "/users", "https://example.com", requestMethod).Header()
+				if got := h.Get("Access-Control-Allow-Origin"); got != tt.allowOrigin {
+					t.Errorf("%s: Access-Control-Allow-Origin = %q, want %q", method, got, tt.allowOrigin)
+				}
+				if got := h.Get("Access-Control-Allow-Credentials"); got != tt.credentials {
+					t.Errorf("%s: Access-Control-Allow-Credentials = %q, want %q", method, got, tt.credentials)
+				}
+				if h.Get("Access-Control-Allow-Origin") == "*" && h.Get("Access-Control-Allow-Credentials") != "" {
+					t.Errorf("%s: credentials are allowed for any origin", method)
+				}
+			}
+		})
+	}
+}
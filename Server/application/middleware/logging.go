@@ -0,0 +1,108 @@
+package middleware
+
+import (
+	"bufio"
+	"errors"
+	"example.com/application/logging"
+	"github.com/eiei114/dinosaur-jump/protocol"
+	"github.com/google/uuid"
+	"github.com/uptrace/bunrouter"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+)
+
+// RequestIDHeader リクエストIDをやり取りするヘッダー
+const RequestIDHeader = protocol.RequestIDHeader
+
+// RequestIDMiddleware リクエストIDを発行し、ContextとレスポンスヘッダーとロガーにセットするMiddleware
+// クライアントがX-Request-IDを付けてきた場合はそれを引き継ぐ
+func (m *Middleware) RequestIDMiddleware() func(bunrouter.HandlerFunc) bunrouter.HandlerFunc {
+	return func(next bunrouter.HandlerFunc) bunrouter.HandlerFunc {
+		return func(w http.ResponseWriter, req bunrouter.Request) error {
+			requestID := req.Header.Get(RequestIDHeader)
+			if requestID == "" || len(requestID) > 128 {
+				requestID = uuid.NewString()
+			}
+			w.Header().Set(RequestIDHeader, requestID)
+
+			ctx := req.Context()
+			ctx = logging.SetRequestID(ctx, requestID)
+			ctx = logging.SetLogger(ctx, m.Logger.With("request_id", requestID))
+			return next(w, req.WithContext(ctx))
+		}
+	}
+}
+
+// AccessLogMiddleware リクエストごとにメソッド、パス、ステータス、処理時間をログに出すMiddleware
+// RequestIDMiddlewareの内側で使うこと
+func (m *Middleware) AccessLogMiddleware() func(bunrouter.HandlerFunc) bunrouter.HandlerFunc {
+	return func(next bunrouter.HandlerFunc) bunrouter.HandlerFunc {
+		return func(w http.ResponseWriter, req bunrouter.Request) error {
+			start := time.Now()
+			rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+			err := next(rec, req)
+
+			attrs := []any{
+				slog.String("method", req.Method),
+				slog.String("path", req.URL.Path),
+				slog.String("route", req.Route()),
+				slog.Int("status", rec.status),
+				slog.Int("bytes", rec.bytes),
+				slog.Duration("duration", time.Since(start)),
+				slog.String("remote_addr", req.RemoteAddr),
+			}
+			logger := logging.FromContext(req.Context())
+			switch {
+			case err != nil:
+				logger.Error("access", append(attrs, slog.Any("err", err))...)
+			case rec.status >= http.StatusInternalServerError:
+				logger.Error("access", attrs...)
+			default:
+				logger.Info("access", attrs...)
+			}
+			return err
+		}
+	}
+}
+
+// statusRecorder 書き込まれたステータスコードとバイト数を記録するResponseWriter
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int
+	wroteHeader bool
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += n
+	return n, err
+}
+
+// Unwrap http.ResponseControllerから元のResponseWriterを辿れるようにする
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// Hijack WebSocketなどで接続を乗っ取れるようにする
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+	r.status = http.StatusSwitchingProtocols
+	r.wroteHeader = true
+	return hj.Hijack()
+}
@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"github.com/uptrace/bunrouter"
+	"golang.org/x/time/rate"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ipLimiters クライアントIPごとのトークンバケット
+type ipLimiters struct {
+	mu       sync.Mutex
+	limiters map[string]*ipLimiter
+	rps      rate.Limit
+	burst    int
+}
+
+type ipLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// 最後のリクエストからこれだけ経ったIPのバケットは捨てる
+const limiterTTL = 10 * time.Minute
+
+func (l *ipLimiters) allow(ip string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.limiters == nil {
+		l.limiters = make(map[string]*ipLimiter)
+	}
+	v, ok := l.limiters[ip]
+	if !ok {
+		// 増え続けないように新しいIPが来たタイミングで古いものを掃除する
+		for k, old := range l.limiters {
+			if now.Sub(old.lastSeen) > limiterTTL {
+				delete(l.limiters, k)
+			}
+		}
+		v = &ipLimiter{limiter: rate.NewLimiter(l.rps, l.burst)}
+		l.limiters[ip] = v
+	}
+	v.lastSeen = now
+	return v.limiter.AllowN(now, 1)
+}
+
+// RateLimitMiddleware クライアントIPごとにリクエスト数を制限するMiddleware
+// 設定の requests_per_second が0の場合は何もしない
+func (m *Middleware) RateLimitMiddleware() func(bunrouter.HandlerFunc) bunrouter.HandlerFunc {
+	cfg := m.Config.RateLimit
+	limiters := &ipLimiters{rps: rate.Limit(cfg.RequestsPerSecond), burst: cfg.Burst}
+
+	return func(next bunrouter.HandlerFunc) bunrouter.HandlerFunc {
+		if cfg.RequestsPerSecond <= 0 {
+			return next
+		}
+		return func(w http.ResponseWriter, req bunrouter.Request) error {
+			ip, _, err := net.SplitHostPort(req.RemoteAddr)
+			if err != nil {
+				ip = req.RemoteAddr
+			}
+			if !limiters.allow(ip, time.Now()) {
+				w.Header().Set("Retry-After", "1")
+				http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+				return nil
+			}
+			return next(w, req)
+		}
+	}
+}
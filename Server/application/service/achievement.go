@@ -0,0 +1,46 @@
+package service
+
+import (
+	"example.com/domain"
+	"github.com/eiei114/dinosaur-jump/protocol"
+	"slices"
+)
+
+// achievementsOf プレイ結果の集計から解除済みの実績を返す
+func achievementsOf(stats *domain.MatchStats) []string {
+	achievements := []string{}
+	if stats.Matches >= 1 {
+		achievements = append(achievements, protocol.AchievementFirstRun)
+	}
+	if stats.BestSurvivalMillis >= 30_000 {
+		achievements = append(achievements, protocol.AchievementSurvive30)
+	}
+	if stats.BestSurvivalMillis >= 60_000 {
+		achievements = append(achievements, protocol.AchievementSurvive60)
+	}
+	if stats.Matches >= 50 {
+		achievements = append(achievements, protocol.AchievementVeteran)
+	}
+	return achievements
+}
+
+// isUnlocked 実績が不要か、必要な実績を解除済みか
+func isUnlocked(c protocol.Cosmetic, achievements []string) bool {
+	return c.Achievement == "" || slices.Contains(achievements, c.Achievement)
+}
+
+// unlockedCosmetics 実績から今使える色とスキンのIDを返す
+func unlockedCosmetics(achievements []string) (colors, skins []string) {
+	colors, skins = []string{}, []string{}
+	for _, c := range protocol.Colors {
+		if isUnlocked(c.Cosmetic, achievements) {
+			colors = append(colors, c.ID)
+		}
+	}
+	for _, s := range protocol.Skins {
+		if isUnlocked(s, achievements) {
+			skins = append(skins, s.ID)
+		}
+	}
+	return colors, skins
+}
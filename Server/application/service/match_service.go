@@ -0,0 +1,55 @@
+package service
+
+import (
+	"context"
+	"example.com/application/logging"
+	"example.com/domain"
+	"example.com/domain/repository"
+	"github.com/google/uuid"
+)
+
+type MatchService struct {
+	MatchRepository repository.MatchRepository
+	UserRepository  repository.UserRepository
+}
+
+func NewMatchService(MatchRepository repository.MatchRepository, UserRepository repository.UserRepository) *MatchService {
+	return &MatchService{MatchRepository, UserRepository}
+}
+
+// RecordMatch 1回分のプレイの結果を保存し、自己ベストを更新して全ユーザー中の順位を返す
+func (m *MatchService) RecordMatch(ctx context.Context, match *domain.Match) (*domain.MatchResult, error) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return nil, err
+	}
+	match.Id = id.String()
+
+	if err := m.MatchRepository.AddMatch(ctx, match); err != nil {
+		return nil, err
+	}
+	logging.FromContext(ctx).Info("match recorded", "user_id", match.UserId, "survival_ms", match.SurvivalMillis, "cause", match.Cause)
+
+	user, err := m.UserRepository.GetUserByUserId(ctx, match.UserId)
+	if err != nil {
+		return nil, err
+	}
+	result := &domain.MatchResult{HighScore: user.HighScore}
+	if score := int(match.SurvivalMillis); score > user.HighScore {
+		if err := m.UserRepository.UpdateHighScore(ctx, user.Id, score); err != nil {
+			return nil, err
+		}
+		result.HighScore = score
+		result.NewBest = true
+	}
+
+	result.GlobalRank, result.TotalUsers, err = m.UserRepository.GetUserRank(ctx, result.HighScore)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (m *MatchService) GetMatchesByUserId(ctx context.Context, userId string, limit int) ([]*domain.Match, error) {
+	return m.MatchRepository.GetMatchesByUserId(ctx, userId, limit)
+}
@@ -2,17 +2,41 @@ package service
 
 import (
 	"context"
+	"errors"
+	"example.com/application/logging"
 	"example.com/domain"
 	"example.com/domain/repository"
+	"github.com/eiei114/dinosaur-jump/protocol"
 	"github.com/google/uuid"
 )
 
+var (
+	// ErrUnknownCosmetic 存在しない色またはスキンが指定された
+	ErrUnknownCosmetic = errors.New("unknown color or skin")
+	// ErrCosmeticLocked 実績を解除していない色またはスキンが指定された
+	ErrCosmeticLocked = errors.New("color or skin is locked")
+)
+
 type UserService struct {
-	UserRepository repository.UserRepository
+	UserRepository  repository.UserRepository
+	MatchRepository repository.MatchRepository
+}
+
+func NewUserService(UserRepository repository.UserRepository, MatchRepository repository.MatchRepository) *UserService {
+	return &UserService{UserRepository, MatchRepository}
+}
+
+// Profile ユーザーと、プレイ結果から解除された実績・見た目
+type Profile struct {
+	User           *domain.User
+	Achievements   []string
+	UnlockedColors []string
+	UnlockedSkins  []string
 }
 
-func NewUserService(UserRepository repository.UserRepository) *UserService {
-	return &UserService{UserRepository}
+// Appearance 保存されている見た目。未設定なら既定のもの
+func (p *Profile) Appearance() protocol.Appearance {
+	return protocol.Appearance{Color: p.User.Color, Skin: p.User.Skin}.Normalized()
 }
 
 func (u *UserService) Add(ctx context.Context, name string) (string, error) {
@@ -32,6 +56,7 @@ func (u *UserService) Add(ctx context.Context, name string) (string, error) {
 		return "", err
 	}
 
+	logging.FromContext(ctx).Info("user created", "user_id", userID.String(), "name", name)
 	return authToken.String(), nil
 }
 
@@ -48,7 +73,10 @@ func (u *UserService) GetUserByUserId(ctx context.Context, id string) (*domain.U
 
 func (u *UserService) GetUserByAuthToken(ctx context.Context, authToken string) (*domain.User, error) {
 	var user *domain.User
-	user, _ = u.UserRepository.GetUserByAuthToken(ctx, authToken)
+	user, err := u.UserRepository.GetUserByAuthToken(ctx, authToken)
+	if err != nil {
+		logging.FromContext(ctx).Warn("user lookup by auth token failed", "err", err)
+	}
 	return user, nil
 }
 
@@ -59,3 +87,51 @@ func (u *UserService) GetUserRanking(ctx context.Context) ([]*domain.UserRanking
 	}
 	return userRankings, nil
 }
+
+// GetProfile ユーザーの実績と使える色・スキンを集める
+func (u *UserService) GetProfile(ctx context.Context, user *domain.User) (*Profile, error) {
+	stats, err := u.MatchRepository.GetMatchStatsByUserId(ctx, user.Id)
+	if err != nil {
+		return nil, err
+	}
+	achievements := achievementsOf(stats)
+	colors, skins := unlockedCosmetics(achievements)
+	return &Profile{User: user, Achievements: achievements, UnlockedColors: colors, UnlockedSkins: skins}, nil
+}
+
+// UpdateAppearance 色とスキンを変更する。空のフィールドは変更しない
+// 実績を解除していないものは ErrCosmeticLocked を返す
+func (u *UserService) UpdateAppearance(ctx context.Context, user *domain.User, look protocol.Appearance) (*Profile, error) {
+	profile, err := u.GetProfile(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	next := profile.Appearance()
+	if look.Color != "" {
+		c, ok := protocol.FindColor(look.Color)
+		if !ok {
+			return nil, ErrUnknownCosmetic
+		}
+		if !isUnlocked(c.Cosmetic, profile.Achievements) {
+			return nil, ErrCosmeticLocked
+		}
+		next.Color = c.ID
+	}
+	if look.Skin != "" {
+		s, ok := protocol.FindSkin(look.Skin)
+		if !ok {
+			return nil, ErrUnknownCosmetic
+		}
+		if !isUnlocked(s, profile.Achievements) {
+			return nil, ErrCosmeticLocked
+		}
+		next.Skin = s.ID
+	}
+
+	if err := u.UserRepository.UpdateAppearance(ctx, user.Id, next.Color, next.Skin); err != nil {
+		return nil, err
+	}
+	user.Color, user.Skin = next.Color, next.Skin
+	logging.FromContext(ctx).Info("user appearance updated", "color", next.Color, "skin", next.Skin)
+	return profile, nil
+}
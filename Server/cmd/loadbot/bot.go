@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math/rand"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/eiei114/dinosaur-jump/protocol"
+	"github.com/eiei114/dinosaur-jump/protocol/apiclient"
+	"golang.org/x/net/websocket"
+)
+
+const (
+	// loginRetries レート制限などでユーザー作成に失敗したときに試し直す回数
+	loginRetries = 5
+	dialTimeout  = 5 * time.Second
+)
+
+type botConfig struct {
+	serverURL     string
+	room          string
+	inputInterval time.Duration
+	script        string
+}
+
+// bot 1人分のプレイヤー
+type bot struct {
+	index int
+	name  string
+	cfg   botConfig
+	api   *apiclient.Client
+	m     *metrics
+	rnd   *rand.Rand
+
+	ws       *websocket.Conn
+	playerID uint32
+
+	mu      sync.Mutex
+	nextSeq uint32
+	// pending サーバーの反映を待っている入力。Seqの昇順
+	pending []pendingInput
+}
+
+type pendingInput struct {
+	seq    uint32
+	sentAt time.Time
+}
+
+func newBot(index int, name string, cfg botConfig, api *apiclient.Client, m *metrics) *bot {
+	return &bot{
+		index: index,
+		name:  name,
+		cfg:   cfg,
+		api:   api,
+		m:     m,
+		rnd:   rand.New(rand.NewSource(time.Now().UnixNano() + int64(index))),
+	}
+}
+
+// run ctxが終わるまでプレイする
+func (b *bot) run(ctx context.Context) {
+	token, err := b.login(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			b.m.joinFailed.Add(1)
+			slog.Warn("login failed", "bot", b.name, "err", err)
+		}
+		return
+	}
+	if err := b.dial(token); err != nil {
+		b.m.joinFailed.Add(1)
+		slog.Warn("join failed", "bot", b.name, "err", err)
+		return
+	}
+	b.m.connected.Add(1)
+	defer b.m.connected.Add(-1)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		b.readLoop()
+	}()
+
+	ticker := time.NewTicker(b.cfg.inputInterval)
+	defer ticker.Stop()
+	for step := b.index; ; step++ {
+		select {
+		case <-ctx.Done():
+			b.ws.Close()
+			<-done
+			return
+		case <-done:
+			b.m.disconnected.Add(1)
+			slog.Warn("disconnected by server", "bot", b.name)
+			return
+		case <-ticker.C:
+			b.sendInput(step)
+		}
+	}
+}
+
+// login ユーザーを作る。レート制限にかかったら間隔を空けて試し直す
+func (b *bot) login(ctx context.Context) (string, error) {
+	backoff := 500 * time.Millisecond
+	for attempt := 0; ; attempt++ {
+		res, err := b.api.CreateUser(ctx, b.name)
+		if err == nil {
+			return res.Token, nil
+		}
+		var apiErr *apiclient.Error
+		if attempt >= loginRetries || !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusTooManyRequests {
+			return "", err
+		}
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(backoff + time.Duration(b.rnd.Int63n(int64(backoff)))):
+		}
+		backoff *= 2
+	}
+}
+
+func (b *bot) dial(token string) error {
+	cfg, err := websocket.NewConfig(protocol.RealtimeURL(b.cfg.serverURL), b.cfg.serverURL)
+	if err != nil {
+		return err
+	}
+	cfg.Dialer = &net.Dialer{Timeout: dialTimeout}
+	ws, err := websocket.DialConfig(cfg)
+	if err != nil {
+		return err
+	}
+	if err := b.send(ws, &protocol.Hello{Version: protocol.Version, Token: token, Room: b.cfg.room}); err != nil {
+		ws.Close()
+		return err
+	}
+
+	ws.SetReadDeadline(time.Now().Add(dialTimeout))
+	var data []byte
+	if err := websocket.Message.Receive(ws, &data); err != nil {
+		ws.Close()
+		return err
+	}
+	msg, err := protocol.Decode(data)
+	if err != nil {
+		ws.Close()
+		return err
+	}
+	switch m := msg.(type) {
+	case *protocol.Welcome:
+		b.playerID = m.PlayerID
+	case *protocol.Error:
+		ws.Close()
+		return errors.New(m.Code + ": " + m.Message)
+	default:
+		ws.Close()
+		return errors.New("unexpected message: " + string(msg.MessageType()))
+	}
+	ws.SetReadDeadline(time.Time{})
+
+	b.ws = ws
+	return nil
+}
+
+// sendInput スクリプトのstep番目、スクリプトがなければランダムな方向のキーを1フレーム分押す
+func (b *bot) sendInput(step int) {
+	in := protocol.Input{}
+	dir := byte("UDLR"[b.rnd.Intn(4)])
+	if b.cfg.script != "" {
+		dir = b.cfg.script[step%len(b.cfg.script)]
+	}
+	switch dir {
+	case 'U':
+		in.Up = true
+	case 'D':
+		in.Down = true
+	case 'L':
+		in.Left = true
+	case 'R':
+		in.Right = true
+	default:
+		return
+	}
+
+	b.mu.Lock()
+	b.nextSeq++
+	in.Seq = b.nextSeq
+	b.pending = append(b.pending, pendingInput{seq: in.Seq, sentAt: time.Now()})
+	b.mu.Unlock()
+
+	if err := b.send(b.ws, &in); err == nil {
+		b.m.inputs.Add(1)
+	}
+}
+
+func (b *bot) readLoop() {
+	var decoder protocol.SnapshotDecoder
+	var lastSeq uint32
+	for {
+		var data []byte
+		if err := websocket.Message.Receive(b.ws, &data); err != nil {
+			return
+		}
+		b.m.bytes.Add(uint64(len(data)))
+
+		if protocol.IsEntitySnapshot(data) {
+			snap, err := decoder.Decode(data)
+			if err != nil {
+				b.m.decodeErrors.Add(1)
+				continue
+			}
+			// サーバーは送信が詰まったプレイヤーへのスナップショットを捨てるので、Seqが飛んだ分が取りこぼし
+			if lastSeq != 0 && snap.Seq > lastSeq+1 {
+				b.m.dropped.Add(uint64(snap.Seq - lastSeq - 1))
+			}
+			lastSeq = snap.Seq
+			b.m.snapshots.Add(1)
+			b.send(b.ws, &protocol.SnapshotAck{Seq: snap.Seq})
+			b.ack(snap.LastInput)
+			continue
+		}
+
+		msg, err := protocol.Decode(data)
+		if err != nil {
+			b.m.decodeErrors.Add(1)
+			continue
+		}
+		// アウトになってもサーバーは入力の Seq を進めるので、遅延の計測はそのまま続けられる
+		if d, ok := msg.(*protocol.Death); ok && d.PlayerID == b.playerID {
+			b.m.deaths.Add(1)
+			b.send(b.ws, &protocol.Respawn{})
+		}
+	}
+}
+
+// ack サーバーが lastInput まで反映したので、送ってから反映されるまでの時間を記録する
+func (b *bot) ack(lastInput uint32) {
+	now := time.Now()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	n := 0
+	for _, p := range b.pending {
+		if p.seq > lastInput {
+			break
+		}
+		b.m.recordLatency(now.Sub(p.sentAt))
+		n++
+	}
+	b.pending = b.pending[n:]
+}
+
+// send x/net/websocket の書き込みは接続ごとに排他されているので、どのgoroutineから呼んでもよい
+func (b *bot) send(ws *websocket.Conn, msg protocol.Message) error {
+	data, err := protocol.Encode(msg)
+	if err != nil {
+		return err
+	}
+	return websocket.Message.Send(ws, string(data))
+}
@@ -0,0 +1,100 @@
+// loadbot ゲームサーバーの負荷試験用のボット
+// /user/create でログインし、リアルタイム通信で部屋に参加して、ランダムまたはスクリプトどおりに動き回る。
+// 入力がサーバーに反映されるまでの時間のパーセンタイル、取りこぼしたスナップショットの数、
+// サーバーのtickの処理落ちを定期的に表示する
+//
+//	go run ./cmd/loadbot -server http://localhost:8080 -bots 1000 -spawn-rate 100 -duration 1m
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eiei114/dinosaur-jump/protocol/apiclient"
+)
+
+func main() {
+	serverURL := flag.String("server", "http://localhost:8080", "game server base URL")
+	bots := flag.Int("bots", 100, "number of bots")
+	spawnRate := flag.Float64("spawn-rate", 50, "bots started per second")
+	duration := flag.Duration("duration", time.Minute, "how long to run after the first bot starts")
+	room := flag.String("room", "", "room to join (empty = let the server choose)")
+	inputRate := flag.Float64("input-rate", 5, "inputs per second per bot")
+	script := flag.String("script", "", `input script, one of U D L R or "." (no input) per step, looped (empty = random)`)
+	reportInterval := flag.Duration("report-interval", 5*time.Second, "how often to print a report")
+	namePrefix := flag.String("name-prefix", "bot", "prefix of bot user names")
+	flag.Parse()
+
+	if err := validateScript(*script); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid -script: %v\n", err)
+		os.Exit(2)
+	}
+	if *bots < 1 || *spawnRate <= 0 || *inputRate <= 0 {
+		fmt.Fprintln(os.Stderr, "-bots, -spawn-rate and -input-rate must be positive")
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, *duration)
+	defer cancel()
+
+	// 多数のボットが同じサーバーにつなぐので、接続を使い回せるようにしておく
+	httpClient := &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: &http.Transport{MaxIdleConnsPerHost: 256},
+	}
+	api := apiclient.New(*serverURL, apiclient.WithHTTPClient(httpClient))
+
+	m := newMetrics()
+	reporter := newReporter(api, m, *bots, *reportInterval)
+	reporter.start(ctx)
+
+	cfg := botConfig{
+		serverURL:     *serverURL,
+		room:          *room,
+		inputInterval: time.Duration(float64(time.Second) / *inputRate),
+		script:        strings.ToUpper(*script),
+	}
+
+	var wg sync.WaitGroup
+	spawn := time.NewTicker(time.Duration(float64(time.Second) / *spawnRate))
+	defer spawn.Stop()
+spawnLoop:
+	for i := 0; i < *bots; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				break spawnLoop
+			case <-spawn.C:
+			}
+		}
+		b := newBot(i, fmt.Sprintf("%s%d", *namePrefix, i), cfg, api, m)
+		m.started.Add(1)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b.run(ctx)
+		}()
+	}
+
+	wg.Wait()
+	reporter.stop()
+	reporter.summary(os.Stdout)
+}
+
+func validateScript(script string) error {
+	for _, c := range strings.ToUpper(script) {
+		if !strings.ContainsRune("UDLR.", c) {
+			return fmt.Errorf("unknown step %q", c)
+		}
+	}
+	return nil
+}
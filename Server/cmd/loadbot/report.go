@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/eiei114/dinosaur-jump/protocol"
+	"github.com/eiei114/dinosaur-jump/protocol/apiclient"
+)
+
+// metrics 全ボットで共有する計測値
+type metrics struct {
+	started      atomic.Uint64
+	connected    atomic.Int64
+	joinFailed   atomic.Uint64
+	disconnected atomic.Uint64
+	inputs       atomic.Uint64
+	snapshots    atomic.Uint64
+	bytes        atomic.Uint64
+	dropped      atomic.Uint64
+	decodeErrors atomic.Uint64
+	deaths       atomic.Uint64
+
+	mu sync.Mutex
+	// latencies 前回の報告からの、入力を送ってからスナップショットに反映されるまでの時間
+	latencies []time.Duration
+	// all 試験全体の latencies
+	all []time.Duration
+}
+
+func newMetrics() *metrics {
+	return &metrics{}
+}
+
+func (m *metrics) recordLatency(d time.Duration) {
+	m.mu.Lock()
+	m.latencies = append(m.latencies, d)
+	m.mu.Unlock()
+}
+
+// takeLatencies 前回からの計測値を取り出す
+func (m *metrics) takeLatencies() []time.Duration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	l := m.latencies
+	m.latencies = nil
+	m.all = append(m.all, l...)
+	return l
+}
+
+type percentiles struct {
+	n                  int
+	p50, p90, p99, max time.Duration
+}
+
+func percentilesOf(samples []time.Duration) percentiles {
+	if len(samples) == 0 {
+		return percentiles{}
+	}
+	s := append([]time.Duration(nil), samples...)
+	sort.Slice(s, func(i, j int) bool { return s[i] < s[j] })
+	at := func(q float64) time.Duration {
+		return s[int(q*float64(len(s)-1))]
+	}
+	return percentiles{n: len(s), p50: at(0.50), p90: at(0.90), p99: at(0.99), max: s[len(s)-1]}
+}
+
+func (p percentiles) String() string {
+	if p.n == 0 {
+		return "n/a"
+	}
+	r := func(d time.Duration) time.Duration { return d.Round(100 * time.Microsecond) }
+	return fmt.Sprintf("p50 %v p90 %v p99 %v max %v", r(p.p50), r(p.p90), r(p.p99), r(p.max))
+}
+
+// counters ある時点での計測値。差分を取って1秒あたりの値にする
+type counters struct {
+	at        time.Time
+	inputs    uint64
+	snapshots uint64
+	bytes     uint64
+}
+
+// reporter 定期的に計測値とサーバーの状況を表示する
+// bots は 接続中/起動済み/指定数 の順に表示する
+type reporter struct {
+	api      *apiclient.Client
+	m        *metrics
+	bots     int
+	interval time.Duration
+	started  time.Time
+	// base 試験を始める前のサーバーの状況。tickの処理落ちは差分で表示する
+	base *protocol.ServerStatsResponse
+	prev counters
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func newReporter(api *apiclient.Client, m *metrics, bots int, interval time.Duration) *reporter {
+	return &reporter{api: api, m: m, bots: bots, interval: interval}
+}
+
+func (r *reporter) start(ctx context.Context) {
+	r.started = time.Now()
+	r.prev = counters{at: r.started}
+	r.base = r.serverStats(ctx)
+	if r.base == nil {
+		fmt.Fprintln(os.Stderr, "warning: could not get server stats; tick overruns will not be reported")
+	}
+
+	ctx, r.cancel = context.WithCancel(context.Background())
+	r.done = make(chan struct{})
+	go func() {
+		defer close(r.done)
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				r.report(ctx, os.Stdout)
+			}
+		}
+	}()
+}
+
+func (r *reporter) stop() {
+	r.cancel()
+	<-r.done
+}
+
+func (r *reporter) report(ctx context.Context, w io.Writer) {
+	now := counters{
+		at:        time.Now(),
+		inputs:    r.m.inputs.Load(),
+		snapshots: r.m.snapshots.Load(),
+		bytes:     r.m.bytes.Load(),
+	}
+	secs := now.at.Sub(r.prev.at).Seconds()
+	rate := func(cur, prev uint64) float64 { return float64(cur-prev) / secs }
+
+	fmt.Fprintf(w, "[%6s] bots %d/%d/%d failed %d | in %.0f/s snap %.0f/s %.1fKB/s | input latency %v | dropped %d decode errors %d | deaths %d%s\n",
+		now.at.Sub(r.started).Round(time.Second),
+		r.m.connected.Load(), r.m.started.Load(), r.bots, r.m.joinFailed.Load()+r.m.disconnected.Load(),
+		rate(now.inputs, r.prev.inputs), rate(now.snapshots, r.prev.snapshots), rate(now.bytes, r.prev.bytes)/1024,
+		percentilesOf(r.m.takeLatencies()),
+		r.m.dropped.Load(), r.m.decodeErrors.Load(), r.m.deaths.Load(),
+		r.serverLine(ctx),
+	)
+	r.prev = now
+}
+
+// summary 試験全体の結果を表示する
+func (r *reporter) summary(w io.Writer) {
+	r.m.takeLatencies()
+	elapsed := time.Since(r.started)
+	fmt.Fprintf(w, "\n--- summary (%v) ---\n", elapsed.Round(time.Second))
+	fmt.Fprintf(w, "bots:            %d of %d started, %d failed to join, %d disconnected by server\n",
+		r.m.started.Load(), r.bots, r.m.joinFailed.Load(), r.m.disconnected.Load())
+	fmt.Fprintf(w, "inputs:          %d (%.0f/s)\n", r.m.inputs.Load(), float64(r.m.inputs.Load())/elapsed.Seconds())
+	fmt.Fprintf(w, "snapshots:       %d (%.0f/s, %.1fKB/s)\n", r.m.snapshots.Load(),
+		float64(r.m.snapshots.Load())/elapsed.Seconds(), float64(r.m.bytes.Load())/1024/elapsed.Seconds())
+	fmt.Fprintf(w, "input latency:   %v (n=%d)\n", percentilesOf(r.m.all), len(r.m.all))
+	fmt.Fprintf(w, "dropped:         %d snapshots, %d decode errors\n", r.m.dropped.Load(), r.m.decodeErrors.Load())
+	fmt.Fprintf(w, "deaths:          %d\n", r.m.deaths.Load())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if st := r.serverStats(ctx); st != nil && r.base != nil {
+		ticks := st.Ticks - r.base.Ticks
+		overruns := st.TickOverruns - r.base.TickOverruns
+		ratio := 0.0
+		if ticks > 0 {
+			ratio = float64(overruns) / float64(ticks) * 100
+		}
+		fmt.Fprintf(w, "server ticks:    %d, %d overruns (%.2f%%)\n", ticks, overruns, ratio)
+	}
+}
+
+func (r *reporter) serverLine(ctx context.Context) string {
+	st := r.serverStats(ctx)
+	if st == nil || r.base == nil {
+		return ""
+	}
+	return fmt.Sprintf(" | server rooms %d players %d overruns %d",
+		st.Rooms, st.Players, st.TickOverruns-r.base.TickOverruns)
+}
+
+func (r *reporter) serverStats(ctx context.Context) *protocol.ServerStatsResponse {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	st, err := r.api.GetStats(ctx)
+	if err != nil {
+		return nil
+	}
+	return st
+}
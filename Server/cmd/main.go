@@ -1,34 +1,70 @@
 package main
 
 import (
+	"example.com/application/game"
 	"example.com/application/middleware"
 	"example.com/application/service"
 	"example.com/config"
 	infrastructure "example.com/infrastructure/persistence"
 	_interface "example.com/interface/handler"
+	"fmt"
 	"github.com/uptrace/bunrouter"
-	"log"
+	"log/slog"
 	"net/http"
+	"os"
 )
 
 func main() {
-	db, _ := config.NewDBConnection()
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid config:\n%v\n", err)
+		os.Exit(2)
+	}
+
+	logger := config.NewLogger(cfg.Log)
+	slog.SetDefault(logger)
+	fmt.Printf("effective config:\n%s", cfg)
+
+	db, err := config.NewDBConnection(cfg.Database)
+	if err != nil {
+		logger.Error("failed to connect to database", "err", err)
+		os.Exit(1)
+	}
 
 	userRepository := infrastructure.NewUserRepository(db)
-	userService := service.NewUserService(userRepository)
-	userHandler := _interface.NewUserHandler(userService)
-	middleware := middleware.NewMiddleware(userService)
-
-	r := bunrouter.New()
-	r.Use(middleware.RecoverMiddleware())
-	r.Use(middleware.CorsMiddleware())
-
-	r.POST("/user/create", userHandler.UserCreateHandle())
-	r.POST("/user/get", userHandler.UserGetHandle())
-	r.POST("/move", userHandler.MoveHandle())
-	r.POST("/destroy", userHandler.DestroyHandle())
-	r.GET("/users/get", userHandler.UserRankingGetHandle())
-
-	log.Println("listening on http://localhost:8080")
-	log.Println(http.ListenAndServe(":8080", r))
+	matchRepository := infrastructure.NewMatchRepository(db)
+	userService := service.NewUserService(userRepository, matchRepository)
+	matchService := service.NewMatchService(matchRepository, userRepository)
+	hub := game.NewHub(cfg.Game, logger, matchService)
+	userHandler := _interface.NewUserHandler(userService, hub)
+	// CORSのプリフライトでルートごとのメソッドを返すため、登録内容を記録しておく
+	routes := middleware.NewRouteTable()
+	middleware := middleware.NewMiddleware(userService, logger, cfg)
+
+	// Group.Use は新しいGroupを返すだけなので、ルーター自体のMiddlewareはオプションで渡す
+	// リクエストIDとアクセスログは、他のMiddlewareが返すエラーも記録できるよう一番外側にする
+	router := bunrouter.New(
+		bunrouter.Use(
+			middleware.RequestIDMiddleware(),
+			middleware.AccessLogMiddleware(),
+		),
+		bunrouter.Use(
+			middleware.RecoverMiddleware(),
+			middleware.CorsMiddleware(routes),
+			middleware.RateLimitMiddleware(),
+		),
+	)
+	r := routes.Group(&router.Group)
+	realtimeHandler := _interface.NewRealtimeHandler(userService, hub, middleware.OriginAllowed, cfg.NetSim)
+
+	registerRoutes(r, middleware, userHandler, realtimeHandler)
+
+	if cfg.NetSim.Enabled() {
+		logger.Warn("network simulator is enabled for the realtime channel", "netsim", cfg.NetSim)
+	}
+	logger.Info("listening", "addr", cfg.Server.Addr)
+	if err := http.ListenAndServe(cfg.Server.Addr, router); err != nil {
+		logger.Error("server stopped", "err", err)
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"example.com/application/middleware"
+	_interface "example.com/interface/handler"
+	"example.com/interface/openapi"
+	"github.com/eiei114/dinosaur-jump/protocol"
+)
+
+// registerRoutes REST APIとリアルタイム通信のルートを登録する
+// ここに足したルートは interface/openapi/openapi.json にも書く(routes_test.go で確かめている)
+func registerRoutes(r *middleware.RouteGroup, mw *middleware.Middleware, userHandler *_interface.UserHandler, realtimeHandler *_interface.RealtimeHandler) {
+	r.POST("/user/create", userHandler.UserCreateHandle())
+	r.POST("/user/get", userHandler.UserGetHandle())
+	r.PUT("/user/appearance", mw.AuthenticateMiddleware()(userHandler.UserAppearanceHandle()))
+	r.POST("/move", userHandler.MoveHandle())
+	r.POST("/destroy", userHandler.DestroyHandle())
+	r.GET("/users/get", userHandler.UserRankingGetHandle())
+	r.GET("/stats", realtimeHandler.StatsHandle())
+	r.GET("/healthz", realtimeHandler.HealthHandle())
+	r.GET("/openapi.json", openapi.SpecHandle())
+	r.GET(protocol.RealtimePath, realtimeHandler.RealtimeHandle())
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"example.com/application/middleware"
+	"example.com/application/service"
+	"example.com/config"
+	_interface "example.com/interface/handler"
+	"example.com/interface/openapi"
+	"github.com/uptrace/bunrouter"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+var httpMethods = map[string]bool{"GET": true, "PUT": true, "POST": true, "DELETE": true, "OPTIONS": true, "HEAD": true, "PATCH": true, "TRACE": true}
+
+// TestRoutesInSpec 登録したルートとメソッドがすべて openapi.json に書かれていて、余分なものもないこと
+func TestRoutesInSpec(t *testing.T) {
+	var spec struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(openapi.Spec(), &spec); err != nil {
+		t.Fatalf("parse openapi.json: %v", err)
+	}
+
+	routes := middleware.NewRouteTable()
+	mw := middleware.NewMiddleware(nil, slog.Default(), config.Default())
+	userHandler := _interface.NewUserHandler(&service.UserService{}, nil)
+	realtimeHandler := _interface.NewRealtimeHandler(nil, nil, mw.OriginAllowed, config.Default().NetSim)
+	registerRoutes(routes.Group(&bunrouter.New().Group), mw, userHandler, realtimeHandler)
+
+	registered := routes.Routes()
+	for route, methods := range registered {
+		ops, ok := spec.Paths[route]
+		if !ok {
+			t.Errorf("%s is registered but missing from openapi.json", route)
+			continue
+		}
+		for _, method := range methods {
+			if _, ok := ops[strings.ToLower(method)]; !ok {
+				t.Errorf("%s %s is registered but missing from openapi.json", method, route)
+			}
+		}
+	}
+	for path, ops := range spec.Paths {
+		for op := range ops {
+			method := strings.ToUpper(op)
+			if !httpMethods[method] {
+				// parameters や summary などメソッド以外の項目
+				continue
+			}
+			found := false
+			for _, m := range registered[path] {
+				found = found || m == method
+			}
+			if !found {
+				t.Errorf("%s %s is in openapi.json but not registered", method, path)
+			}
+		}
+	}
+}
@@ -0,0 +1,503 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/eiei114/dinosaur-jump/protocol"
+	"github.com/eiei114/dinosaur-jump/protocol/netsim"
+	"github.com/eiei114/dinosaur-jump/protocol/sim"
+	"gopkg.in/yaml.v3"
+)
+
+// Config サーバー全体の設定
+// デフォルト値 → 設定ファイル(YAML) → 環境変数 → コマンドラインフラグ の順に上書きされる
+type Config struct {
+	Server    ServerConfig    `yaml:"server"`
+	Database  DatabaseConfig  `yaml:"database"`
+	CORS      CORSConfig      `yaml:"cors"`
+	Game      GameConfig      `yaml:"game"`
+	RateLimit RateLimitConfig `yaml:"rate_limit"`
+	Log       LogConfig       `yaml:"log"`
+	// NetSim リアルタイム通信に遅延やパケットロスを加える(ローカルでの動作確認用)。送信・受信の両方向にかかる
+	NetSim netsim.Config `yaml:"netsim"`
+}
+
+type ServerConfig struct {
+	Addr string `yaml:"addr"`
+}
+
+type DatabaseConfig struct {
+	Backend string `yaml:"backend"`
+	// DSN が空の場合は MySQL の各項目から組み立てる
+	DSN      string `yaml:"dsn"`
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+	Host     string `yaml:"host"`
+	Port     string `yaml:"port"`
+	Name     string `yaml:"name"`
+}
+
+type CORSConfig struct {
+	// AllowedOrigins "https://example.com" や "https://*.example.com"(サブドメインすべて)、"*"(すべて)
+	AllowedOrigins   []string `yaml:"allowed_origins"`
+	AllowCredentials bool     `yaml:"allow_credentials"`
+	// MaxAge プリフライトの結果をブラウザにキャッシュさせる時間
+	MaxAge time.Duration `yaml:"max_age"`
+}
+
+type GameConfig struct {
+	// TickRate サーバーのシミュレーション更新回数(回/秒)
+	TickRate int `yaml:"tick_rate"`
+	// RoomSize 1部屋あたりの最大プレイヤー数
+	RoomSize int `yaml:"room_size"`
+	// MaxRooms 同時に開いておける部屋の最大数。満員の部屋しかなく新しく作れなければ参加を断る
+	MaxRooms int `yaml:"max_rooms"`
+	// MaxRewind 当たり判定でプレイヤーが見ていた過去の状態まで巻き戻せる最大時間。0なら巻き戻さない
+	MaxRewind time.Duration `yaml:"max_rewind"`
+	// ResumeGrace 接続が切れたプレイヤーを部屋に残して再接続を待つ時間。0なら待たずに退出させる
+	ResumeGrace time.Duration `yaml:"resume_grace"`
+	// IdleTimeout これだけの時間動かなかったプレイヤーをアウトにする。0なら判定しない
+	IdleTimeout time.Duration `yaml:"idle_timeout"`
+	// MaxPause ポーズ中のプレイヤーを放置と衝突の判定から外しておける時間。1回のプレイ(出現からアウトまで)での合計。0ならポーズしても守られない
+	MaxPause time.Duration `yaml:"max_pause"`
+	// Movement プレイヤーの動き方。クライアントにも Welcome で伝え、同じ値で予測させる
+	Movement MovementConfig `yaml:"movement"`
+}
+
+type MovementConfig struct {
+	// Acceleration キーを押している方向への加速度(ピクセル/秒²)
+	Acceleration float64 `yaml:"acceleration"`
+	// Friction 常にかかる減速度(ピクセル/秒²)。Acceleration より小さくないと動き出せない
+	Friction float64 `yaml:"friction"`
+	// MaxSpeed 速さの上限(ピクセル/秒)
+	MaxSpeed float64 `yaml:"max_speed"`
+}
+
+type RateLimitConfig struct {
+	// RequestsPerSecond クライアントIPごとの1秒あたりのリクエスト数。0なら無制限
+	RequestsPerSecond float64 `yaml:"requests_per_second"`
+	Burst             int     `yaml:"burst"`
+}
+
+type LogConfig struct {
+	Level  string `yaml:"level"`
+	Format string `yaml:"format"`
+}
+
+const redacted = "REDACTED"
+
+// Default 何も指定されなかったときの設定
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{Addr: ":8080"},
+		Database: DatabaseConfig{
+			Backend:  "mysql",
+			User:     "root",
+			Password: "dinosaur",
+			Host:     "localhost",
+			Port:     "3306",
+			Name:     "user_database",
+		},
+		CORS: CORSConfig{AllowedOrigins: []string{"*"}, MaxAge: 10 * time.Minute},
+		Game: GameConfig{
+			TickRate:    30,
+			RoomSize:    16,
+			MaxRooms:    64,
+			MaxRewind:   200 * time.Millisecond,
+			ResumeGrace: 15 * time.Second,
+			IdleTimeout: sim.DefaultIdleTimeout,
+			MaxPause:    30 * time.Second,
+			Movement:    MovementConfig(sim.DefaultMovement()),
+		},
+		RateLimit: RateLimitConfig{RequestsPerSecond: 20, Burst: 40},
+		Log:       LogConfig{Level: "info", Format: "text"},
+	}
+}
+
+// Load args(os.Args[1:])と環境変数から設定を読み込み、検証して返す
+func Load(args []string) (*Config, error) {
+	return load(args, os.LookupEnv)
+}
+
+func load(args []string, lookupEnv func(string) (string, bool)) (*Config, error) {
+	fs := flag.NewFlagSet("server", flag.ContinueOnError)
+	configPath := fs.String("config", "", "path to YAML config file (env CONFIG_FILE)")
+	addr := fs.String("addr", "", "listen address")
+	dbBackend := fs.String("db-backend", "", "database backend (mysql)")
+	dbDSN := fs.String("db-dsn", "", "database DSN")
+	corsOrigins := fs.String("cors-origins", "", "comma separated list of allowed CORS origins")
+	corsCredentials := fs.Bool("cors-allow-credentials", false, "allow credentialed CORS requests")
+	corsMaxAge := fs.Duration("cors-max-age", 0, "how long browsers may cache preflight results")
+	tickRate := fs.Int("tick-rate", 0, "simulation ticks per second")
+	roomSize := fs.Int("room-size", 0, "max players per room")
+	maxRooms := fs.Int("max-rooms", 0, "max number of open rooms")
+	maxRewind := fs.Duration("max-rewind", 0, "how far back collisions may be judged against what a player saw (0 = disabled)")
+	resumeGrace := fs.Duration("resume-grace", 0, "how long a disconnected player is kept for resuming (0 = disabled)")
+	idleTimeout := fs.Duration("idle-timeout", 0, "eliminate players who do not move for this long (0 = disabled)")
+	maxPause := fs.Duration("max-pause", 0, "total time per life a paused player is protected from idle and collision checks (0 = disabled)")
+	acceleration := fs.Float64("acceleration", 0, "player acceleration in pixels/s^2")
+	friction := fs.Float64("friction", 0, "player deceleration in pixels/s^2")
+	maxSpeed := fs.Float64("max-speed", 0, "player top speed in pixels/s")
+	rateLimitRPS := fs.Float64("rate-limit-rps", 0, "requests per second per client IP (0 = unlimited)")
+	rateLimitBurst := fs.Int("rate-limit-burst", 0, "rate limit burst size")
+	logLevel := fs.String("log-level", "", "log level (debug|info|warn|error)")
+	logFormat := fs.String("log-format", "", "log format (text|json)")
+	var sim netsim.Config
+	sim.RegisterFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	cfg := Default()
+
+	path := *configPath
+	if path == "" {
+		path, _ = lookupEnv("CONFIG_FILE")
+	}
+	if path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := cfg.loadEnv(lookupEnv); err != nil {
+		return nil, err
+	}
+
+	// 明示的に指定されたフラグだけを反映する
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "addr":
+			cfg.Server.Addr = *addr
+		case "db-backend":
+			cfg.Database.Backend = *dbBackend
+		case "db-dsn":
+			cfg.Database.DSN = *dbDSN
+		case "cors-origins":
+			cfg.CORS.AllowedOrigins = splitList(*corsOrigins)
+		case "cors-allow-credentials":
+			cfg.CORS.AllowCredentials = *corsCredentials
+		case "cors-max-age":
+			cfg.CORS.MaxAge = *corsMaxAge
+		case "tick-rate":
+			cfg.Game.TickRate = *tickRate
+		case "room-size":
+			cfg.Game.RoomSize = *roomSize
+		case "max-rooms":
+			cfg.Game.MaxRooms = *maxRooms
+		case "max-rewind":
+			cfg.Game.MaxRewind = *maxRewind
+		case "resume-grace":
+			cfg.Game.ResumeGrace = *resumeGrace
+		case "idle-timeout":
+			cfg.Game.IdleTimeout = *idleTimeout
+		case "max-pause":
+			cfg.Game.MaxPause = *maxPause
+		case "acceleration":
+			cfg.Game.Movement.Acceleration = *acceleration
+		case "friction":
+			cfg.Game.Movement.Friction = *friction
+		case "max-speed":
+			cfg.Game.Movement.MaxSpeed = *maxSpeed
+		case "rate-limit-rps":
+			cfg.RateLimit.RequestsPerSecond = *rateLimitRPS
+		case "rate-limit-burst":
+			cfg.RateLimit.Burst = *rateLimitBurst
+		case "log-level":
+			cfg.Log.Level = *logLevel
+		case "log-format":
+			cfg.Log.Format = *logFormat
+		case "netsim-latency":
+			cfg.NetSim.Latency = sim.Latency
+		case "netsim-jitter":
+			cfg.NetSim.Jitter = sim.Jitter
+		case "netsim-loss":
+			cfg.NetSim.Loss = sim.Loss
+		case "netsim-reorder":
+			cfg.NetSim.Reorder = sim.Reorder
+		case "netsim-bandwidth":
+			cfg.NetSim.Bandwidth = sim.Bandwidth
+		}
+	})
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func (c *Config) loadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("open config file: %w", err)
+	}
+	defer f.Close()
+
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("parse config file %s: %w", path, err)
+	}
+	return nil
+}
+
+func (c *Config) loadEnv(lookupEnv func(string) (string, bool)) error {
+	str := func(name string, dst *string) {
+		if v, ok := lookupEnv(name); ok && v != "" {
+			*dst = v
+		}
+	}
+	var errs []error
+	integer := func(name string, dst *int) {
+		if v, ok := lookupEnv(name); ok && v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+				return
+			}
+			*dst = n
+		}
+	}
+	float := func(name string, dst *float64) {
+		if v, ok := lookupEnv(name); ok && v != "" {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+				return
+			}
+			*dst = f
+		}
+	}
+	duration := func(name string, dst *time.Duration) {
+		if v, ok := lookupEnv(name); ok && v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+				return
+			}
+			*dst = d
+		}
+	}
+
+	str("LISTEN_ADDR", &c.Server.Addr)
+	str("DB_BACKEND", &c.Database.Backend)
+	str("DB_DSN", &c.Database.DSN)
+	str("MYSQL_USER", &c.Database.User)
+	str("MYSQL_PASSWORD", &c.Database.Password)
+	str("MYSQL_HOST", &c.Database.Host)
+	str("MYSQL_PORT", &c.Database.Port)
+	str("MYSQL_DATABASE", &c.Database.Name)
+	if v, ok := lookupEnv("CORS_ORIGINS"); ok && v != "" {
+		c.CORS.AllowedOrigins = splitList(v)
+	}
+	if v, ok := lookupEnv("CORS_ALLOW_CREDENTIALS"); ok && v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("CORS_ALLOW_CREDENTIALS: %w", err))
+		} else {
+			c.CORS.AllowCredentials = b
+		}
+	}
+	duration("CORS_MAX_AGE", &c.CORS.MaxAge)
+	integer("TICK_RATE", &c.Game.TickRate)
+	integer("ROOM_SIZE", &c.Game.RoomSize)
+	integer("MAX_ROOMS", &c.Game.MaxRooms)
+	duration("MAX_REWIND", &c.Game.MaxRewind)
+	duration("RESUME_GRACE", &c.Game.ResumeGrace)
+	duration("IDLE_TIMEOUT", &c.Game.IdleTimeout)
+	duration("MAX_PAUSE", &c.Game.MaxPause)
+	float("ACCELERATION", &c.Game.Movement.Acceleration)
+	float("FRICTION", &c.Game.Movement.Friction)
+	float("MAX_SPEED", &c.Game.Movement.MaxSpeed)
+	float("RATE_LIMIT_RPS", &c.RateLimit.RequestsPerSecond)
+	integer("RATE_LIMIT_BURST", &c.RateLimit.Burst)
+	str("LOG_LEVEL", &c.Log.Level)
+	str("LOG_FORMAT", &c.Log.Format)
+	duration("NETSIM_LATENCY", &c.NetSim.Latency)
+	duration("NETSIM_JITTER", &c.NetSim.Jitter)
+	float("NETSIM_LOSS", &c.NetSim.Loss)
+	float("NETSIM_REORDER", &c.NetSim.Reorder)
+	integer("NETSIM_BANDWIDTH", &c.NetSim.Bandwidth)
+
+	return errors.Join(errs...)
+}
+
+// Validate 設定値の整合性をチェックする。問題はまとめて返す
+func (c *Config) Validate() error {
+	var errs []error
+
+	if _, _, err := net.SplitHostPort(c.Server.Addr); err != nil {
+		errs = append(errs, fmt.Errorf("server.addr %q: %w", c.Server.Addr, err))
+	}
+
+	switch c.Database.Backend {
+	case "mysql":
+		if c.Database.DSN == "" && (c.Database.Host == "" || c.Database.Name == "") {
+			errs = append(errs, errors.New("database: either dsn or host and name are required"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("database.backend %q: unsupported backend", c.Database.Backend))
+	}
+
+	if len(c.CORS.AllowedOrigins) == 0 {
+		errs = append(errs, errors.New("cors.allowed_origins: at least one origin is required"))
+	}
+	for _, origin := range c.CORS.AllowedOrigins {
+		if err := validateOrigin(origin); err != nil {
+			errs = append(errs, fmt.Errorf("cors.allowed_origins %q: %w", origin, err))
+		}
+		if origin == "*" && c.CORS.AllowCredentials {
+			errs = append(errs, errors.New(`cors: allow_credentials can't be combined with "*"; list the origins explicitly`))
+		}
+	}
+	if c.CORS.MaxAge < 0 {
+		errs = append(errs, fmt.Errorf("cors.max_age %v: must not be negative", c.CORS.MaxAge))
+	}
+
+	if c.Game.TickRate < 1 || c.Game.TickRate > 240 {
+		errs = append(errs, fmt.Errorf("game.tick_rate %d: must be between 1 and 240", c.Game.TickRate))
+	}
+	if c.Game.RoomSize < 1 {
+		errs = append(errs, fmt.Errorf("game.room_size %d: must be positive", c.Game.RoomSize))
+	}
+	if c.Game.MaxRooms < 1 {
+		errs = append(errs, fmt.Errorf("game.max_rooms %d: must be positive", c.Game.MaxRooms))
+	}
+	if c.Game.MaxRewind < 0 || c.Game.MaxRewind > time.Second {
+		errs = append(errs, fmt.Errorf("game.max_rewind %v: must be between 0 and 1s", c.Game.MaxRewind))
+	}
+	if c.Game.ResumeGrace < 0 {
+		errs = append(errs, fmt.Errorf("game.resume_grace %v: must not be negative", c.Game.ResumeGrace))
+	}
+	if c.Game.IdleTimeout < 0 {
+		errs = append(errs, fmt.Errorf("game.idle_timeout %v: must not be negative", c.Game.IdleTimeout))
+	}
+	if c.Game.MaxPause < 0 {
+		errs = append(errs, fmt.Errorf("game.max_pause %v: must not be negative", c.Game.MaxPause))
+	}
+	if m := c.Game.Movement; m.Friction < 0 || m.Acceleration <= m.Friction {
+		errs = append(errs, fmt.Errorf("game.movement: acceleration %v must be greater than friction %v and friction must not be negative", m.Acceleration, m.Friction))
+	}
+	if c.Game.Movement.MaxSpeed <= 0 {
+		errs = append(errs, fmt.Errorf("game.movement.max_speed %v: must be positive", c.Game.Movement.MaxSpeed))
+	}
+
+	if c.RateLimit.RequestsPerSecond < 0 {
+		errs = append(errs, fmt.Errorf("rate_limit.requests_per_second %v: must not be negative", c.RateLimit.RequestsPerSecond))
+	}
+	if c.RateLimit.RequestsPerSecond > 0 && c.RateLimit.Burst < 1 {
+		errs = append(errs, fmt.Errorf("rate_limit.burst %d: must be positive when rate limiting is enabled", c.RateLimit.Burst))
+	}
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Log.Level)); err != nil {
+		errs = append(errs, fmt.Errorf("log.level %q: %w", c.Log.Level, err))
+	}
+	if c.Log.Format != "text" && c.Log.Format != "json" {
+		errs = append(errs, fmt.Errorf("log.format %q: must be text or json", c.Log.Format))
+	}
+
+	if err := c.NetSim.Validate(); err != nil {
+		errs = append(errs, fmt.Errorf("netsim: %w", err))
+	}
+
+	return errors.Join(errs...)
+}
+
+func validateOrigin(origin string) error {
+	if origin == "*" {
+		return nil
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return err
+	}
+	if u.Scheme == "" || u.Host == "" || u.Path != "" || u.RawQuery != "" {
+		return errors.New("must be scheme://host[:port]")
+	}
+	// ワイルドカードは先頭のラベルにだけ使える (https://*.example.com)
+	if host := strings.TrimPrefix(u.Host, "*."); strings.Contains(host, "*") {
+		return errors.New(`wildcard is only allowed as the leading label, e.g. https://*.example.com`)
+	}
+	return nil
+}
+
+// TickInterval 1tickあたりの時間
+func (c GameConfig) TickInterval() time.Duration {
+	return time.Second / time.Duration(c.TickRate)
+}
+
+// MaxRewindTicks MaxRewind を tick 数に直したもの
+func (c GameConfig) MaxRewindTicks() uint32 {
+	return uint32(c.MaxRewind / c.TickInterval())
+}
+
+// IdleTicks IdleTimeout を tick 数に直したもの。0なら判定しない
+func (c GameConfig) IdleTicks() uint32 {
+	return uint32(c.IdleTimeout / c.TickInterval())
+}
+
+// Protocol クライアントに送る形にしたもの
+func (m MovementConfig) Protocol() protocol.Movement {
+	return protocol.Movement(m)
+}
+
+// MaxPauseTicks MaxPause を tick 数に直したもの
+func (c GameConfig) MaxPauseTicks() uint32 {
+	return uint32(c.MaxPause / c.TickInterval())
+}
+
+// Redacted パスワードなどの秘密情報を伏せたコピーを返す
+func (c *Config) Redacted() *Config {
+	r := *c
+	r.CORS.AllowedOrigins = append([]string(nil), c.CORS.AllowedOrigins...)
+	if r.Database.Password != "" {
+		r.Database.Password = redacted
+	}
+	if r.Database.DSN != "" {
+		r.Database.DSN = redactDSN(r.Database.DSN)
+	}
+	return &r
+}
+
+// String 秘密情報を伏せた実効設定をYAMLで返す
+func (c *Config) String() string {
+	b, err := yaml.Marshal(c.Redacted())
+	if err != nil {
+		return fmt.Sprintf("config: %v", err)
+	}
+	return string(b)
+}
+
+// redactDSN user:password@tcp(host)/db 形式のパスワード部分を伏せる
+func redactDSN(dsn string) string {
+	at := strings.LastIndex(dsn, "@")
+	if at < 0 {
+		return dsn
+	}
+	colon := strings.Index(dsn[:at], ":")
+	if colon < 0 {
+		return dsn
+	}
+	return dsn[:colon+1] + redacted + dsn[at:]
+}
+
+func splitList(s string) []string {
+	var list []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
@@ -0,0 +1,193 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// envMap テスト用の環境変数
+func envMap(m map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		v, ok := m[name]
+		return v, ok
+	}
+}
+
+func writeConfigFile(t *testing.T, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeConfigFile(t, `
+server:
+  addr: ":9000"
+game:
+  tick_rate: 20
+  room_size: 8
+  max_rewind: 100ms
+rate_limit:
+  requests_per_second: 5
+  burst: 10
+log:
+  format: json
+`)
+	env := envMap(map[string]string{
+		"CONFIG_FILE":    path,
+		"TICK_RATE":      "40",
+		"ROOM_SIZE":      "12",
+		"RATE_LIMIT_RPS": "7",
+	})
+	cfg, err := load([]string{"-room-size", "4", "-rate-limit-burst", "3"}, env)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	def := Default()
+	tests := []struct {
+		name      string
+		got, want any
+	}{
+		{"default", cfg.Game.MaxRooms, def.Game.MaxRooms},
+		{"default", cfg.Log.Level, def.Log.Level},
+		{"file", cfg.Server.Addr, ":9000"},
+		{"file", cfg.Game.MaxRewind, 100 * time.Millisecond},
+		{"file", cfg.Log.Format, "json"},
+		{"env over file", cfg.Game.TickRate, 40},
+		{"env over file", cfg.RateLimit.RequestsPerSecond, 7.0},
+		{"flag over env", cfg.Game.RoomSize, 4},
+		{"flag over file", cfg.RateLimit.Burst, 3},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestLoadConfigFlagOverridesEnv(t *testing.T) {
+	fromEnv := writeConfigFile(t, "server:\n  addr: \":1111\"\n")
+	fromFlag := writeConfigFile(t, "server:\n  addr: \":2222\"\n")
+	cfg, err := load([]string{"-config", fromFlag}, envMap(map[string]string{"CONFIG_FILE": fromEnv}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server.Addr != ":2222" {
+		t.Errorf("addr = %q, want the file given by -config", cfg.Server.Addr)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		env  map[string]string
+		args []string
+		want string
+	}{
+		{name: "unknown file key", file: "game:\n  tick_rat: 30\n", want: "tick_rat"},
+		{name: "bad env number", env: map[string]string{"TICK_RATE": "fast"}, want: "TICK_RATE"},
+		{name: "bad env duration", env: map[string]string{"MAX_REWIND": "soon"}, want: "MAX_REWIND"},
+		{name: "unknown flag", args: []string{"-no-such-flag"}, want: "no-such-flag"},
+		{name: "invalid value from flag", args: []string{"-rate-limit-rps", "-1"}, want: "rate_limit.requests_per_second"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := map[string]string{}
+			for k, v := range tt.env {
+				env[k] = v
+			}
+			if tt.file != "" {
+				env["CONFIG_FILE"] = writeConfigFile(t, tt.file)
+			}
+			_, err := load(tt.args, envMap(env))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want it to mention %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := Default().Validate(); err != nil {
+		t.Fatalf("default config is invalid: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(c *Config)
+		want   string
+	}{
+		{"addr", func(c *Config) { c.Server.Addr = "8080" }, "server.addr"},
+		{"backend", func(c *Config) { c.Database.Backend = "sqlite" }, "database.backend"},
+		{"database location", func(c *Config) { c.Database.DSN, c.Database.Host = "", "" }, "database"},
+		{"no origins", func(c *Config) { c.CORS.AllowedOrigins = nil }, "cors.allowed_origins"},
+		{"origin with path", func(c *Config) { c.CORS.AllowedOrigins = []string{"https://example.com/app"} }, "cors.allowed_origins"},
+		{"credentials with any origin", func(c *Config) {
+			c.CORS.AllowedOrigins = []string{"*"}
+			c.CORS.AllowCredentials = true
+		}, "allow_credentials"},
+		{"negative max age", func(c *Config) { c.CORS.MaxAge = -time.Second }, "cors.max_age"},
+		{"tick rate", func(c *Config) { c.Game.TickRate = 0 }, "game.tick_rate"},
+		{"room size", func(c *Config) { c.Game.RoomSize = 0 }, "game.room_size"},
+		{"max rooms", func(c *Config) { c.Game.MaxRooms = 0 }, "game.max_rooms"},
+		{"max rewind", func(c *Config) { c.Game.MaxRewind = 2 * time.Second }, "game.max_rewind"},
+		{"resume grace", func(c *Config) { c.Game.ResumeGrace = -time.Second }, "game.resume_grace"},
+		{"idle timeout", func(c *Config) { c.Game.IdleTimeout = -time.Second }, "game.idle_timeout"},
+		{"max pause", func(c *Config) { c.Game.MaxPause = -time.Second }, "game.max_pause"},
+		{"friction over acceleration", func(c *Config) { c.Game.Movement.Friction = c.Game.Movement.Acceleration }, "game.movement"},
+		{"max speed", func(c *Config) { c.Game.Movement.MaxSpeed = 0 }, "game.movement.max_speed"},
+		{"negative rate", func(c *Config) { c.RateLimit.RequestsPerSecond = -1 }, "rate_limit.requests_per_second"},
+		{"no burst", func(c *Config) { c.RateLimit.Burst = 0 }, "rate_limit.burst"},
+		{"log level", func(c *Config) { c.Log.Level = "loud" }, "log.level"},
+		{"log format", func(c *Config) { c.Log.Format = "xml" }, "log.format"},
+		{"netsim", func(c *Config) { c.NetSim.Loss = 2 }, "netsim"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := Default()
+			tt.modify(c)
+			err := c.Validate()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Validate() = %v, want an error about %q", err, tt.want)
+			}
+		})
+	}
+
+	// レート制限が無効ならバーストは見ない
+	c := Default()
+	c.RateLimit = RateLimitConfig{}
+	if err := c.Validate(); err != nil {
+		t.Errorf("Validate() with rate limiting disabled = %v", err)
+	}
+}
+
+func TestStringRedactsSecrets(t *testing.T) {
+	c := Default()
+	c.Database.Password = "hunter2"
+	c.Database.DSN = "dino:s3cret@tcp(db:3306)/user_database"
+
+	s := c.String()
+	for _, secret := range []string{"hunter2", "s3cret"} {
+		if strings.Contains(s, secret) {
+			t.Errorf("effective config contains %q:\n%s", secret, s)
+		}
+	}
+	if !strings.Contains(s, "dino:"+redacted+"@tcp(db:3306)/user_database") {
+		t.Errorf("DSN is not redacted in place:\n%s", s)
+	}
+	if strings.Count(s, redacted) != 2 {
+		t.Errorf("want the password and the DSN redacted:\n%s", s)
+	}
+	// 伏せるのはコピーだけ
+	if c.Database.Password != "hunter2" || !strings.Contains(c.Database.DSN, "s3cret") {
+		t.Error("String modified the config")
+	}
+}
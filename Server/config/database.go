@@ -4,8 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
-	"log"
-	"os"
+	"log/slog"
 	"time"
 
 	_ "github.com/go-sql-driver/mysql"
@@ -14,18 +13,12 @@ import (
 )
 
 // NewDBConnection returns initialized bun.DB
-func NewDBConnection() (*bun.DB, error) {
-	user := getEnvWithDefault("MYSQL_USER", "root")
-	password := getEnvWithDefault("MYSQL_PASSWORD", "dinosaur")
-	host := getEnvWithDefault("MYSQL_HOST", "localhost")
-	port := getEnvWithDefault("MYSQL_PORT", "3306")
-	database := getEnvWithDefault("MYSQL_DATABASE", "user_database")
-
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s", user, password, host, port, database)
+func NewDBConnection(cfg DatabaseConfig) (*bun.DB, error) {
+	dsn := cfg.dataSourceName()
 
 	sqldb, err := sql.Open("mysql", dsn)
 	if err != nil {
-		log.Printf("Error while connecting to database: %+v", err)
+		slog.Error("error while connecting to database", "err", err)
 		return nil, err
 	}
 
@@ -35,19 +28,18 @@ func NewDBConnection() (*bun.DB, error) {
 	defer cancel()
 
 	if _, err := db.ExecContext(ctx, "SELECT 1"); err != nil {
-		log.Printf("Can't connect to database: %+v", err)
+		slog.Error("can't connect to database", "dsn", redactDSN(dsn), "err", err)
 		return nil, err
 	}
 
-	fmt.Println("DB接続")
+	slog.Info("DB接続", "dsn", redactDSN(dsn))
 
 	return db, nil
 }
 
-func getEnvWithDefault(name, def string) string {
-	env := os.Getenv(name)
-	if len(env) != 0 {
-		return env
+func (c DatabaseConfig) dataSourceName() string {
+	if c.DSN != "" {
+		return c.DSN
 	}
-	return def
+	return fmt.Sprintf("%s:%s@tcp(%s:%s)/%s", c.User, c.Password, c.Host, c.Port, c.Name)
 }
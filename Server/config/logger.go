@@ -0,0 +1,28 @@
+package config
+
+import (
+	"io"
+	"log/slog"
+	"os"
+)
+
+// NewLogger returns a slog.Logger configured by LogConfig
+func NewLogger(cfg LogConfig) *slog.Logger {
+	return newLogger(os.Stdout, cfg.Format, cfg.Level)
+}
+
+func newLogger(w io.Writer, format, level string) *slog.Logger {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		l = slog.LevelInfo
+	}
+	opts := &slog.HandlerOptions{Level: l}
+
+	var handler slog.Handler
+	if format == "json" {
+		handler = slog.NewJSONHandler(w, opts)
+	} else {
+		handler = slog.NewTextHandler(w, opts)
+	}
+	return slog.New(handler)
+}
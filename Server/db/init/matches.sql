@@ -0,0 +1,10 @@
+-- プレイ1回分の記録。domain.Match に対応する
+CREATE TABLE IF NOT EXISTS matches (
+    id              VARCHAR(255) NOT NULL PRIMARY KEY,
+    user_id         VARCHAR(255) NOT NULL,
+    room            VARCHAR(255) NOT NULL,
+    survival_millis BIGINT       NOT NULL,
+    cause           VARCHAR(32)  NOT NULL,
+    ended_at        DATETIME(3)  NOT NULL,
+    INDEX idx_matches_user_id_ended_at (user_id, ended_at)
+);
@@ -0,0 +1,10 @@
+-- ユーザー。domain.User に対応する
+CREATE TABLE IF NOT EXISTS users (
+    id         VARCHAR(255) NOT NULL PRIMARY KEY,
+    auth_token VARCHAR(255) NOT NULL,
+    name       VARCHAR(255) NOT NULL,
+    high_score INT          NOT NULL DEFAULT 0,
+    color      VARCHAR(32)  NOT NULL DEFAULT '',
+    skin       VARCHAR(32)  NOT NULL DEFAULT '',
+    UNIQUE INDEX idx_users_auth_token (auth_token)
+);
@@ -0,0 +1,29 @@
+package domain
+
+import "time"
+
+// Match 1回のプレイ(出現してからアウトになるまで)の記録
+type Match struct {
+	Id     string
+	UserId string
+	Room   string
+	// SurvivalMillis 出現してからアウトになるまでの時間(ミリ秒)
+	SurvivalMillis int64
+	// Cause アウトになった理由 (wall / npc / player / idle / disconnect)
+	Cause   string
+	EndedAt time.Time
+}
+
+// MatchResult プレイ結果を保存した後の自己ベストと全ユーザー中の順位
+type MatchResult struct {
+	HighScore  int
+	NewBest    bool
+	GlobalRank int
+	TotalUsers int
+}
+
+// MatchStats ユーザーのこれまでのプレイ結果の集計
+type MatchStats struct {
+	Matches            int
+	BestSurvivalMillis int64
+}
@@ -0,0 +1,13 @@
+package repository
+
+import (
+	"context"
+	"example.com/domain"
+)
+
+type MatchRepository interface {
+	AddMatch(ctx context.Context, match *domain.Match) error
+	// GetMatchesByUserId 新しい順に最大limit件返す
+	GetMatchesByUserId(ctx context.Context, userId string, limit int) ([]*domain.Match, error)
+	GetMatchStatsByUserId(ctx context.Context, userId string) (*domain.MatchStats, error)
+}
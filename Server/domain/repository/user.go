@@ -11,4 +11,9 @@ type UserRepository interface {
 	GetUserByUserId(ctx context.Context, id string) (*domain.User, error)
 	GetUserByAuthToken(ctx context.Context, authToken string) (*domain.User, error)
 	GetUserRanking(ctx context.Context) ([]*domain.UserRanking, error)
+	UpdateAppearance(ctx context.Context, id, color, skin string) error
+	// UpdateHighScore highScore が今の値より大きいときだけ更新する
+	UpdateHighScore(ctx context.Context, id string, highScore int) error
+	// GetUserRank highScore が全ユーザー中何位か(1始まり)と、全ユーザー数を返す
+	GetUserRank(ctx context.Context, highScore int) (rank, total int, err error)
 }
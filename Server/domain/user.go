@@ -4,5 +4,9 @@ type User struct {
 	Id        string
 	AuthToken string
 	Name      string
+	// HighScore 最長の生存時間(ミリ秒)
 	HighScore int
+	// Color Skin 見た目。空なら既定のもの
+	Color string
+	Skin  string
 }
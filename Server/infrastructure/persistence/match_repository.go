@@ -0,0 +1,54 @@
+package infrastructure
+
+import (
+	"context"
+	"example.com/application/logging"
+	"example.com/domain"
+	"github.com/uptrace/bun"
+)
+
+type MatchRepository struct {
+	Conn *bun.DB
+}
+
+func NewMatchRepository(Conn *bun.DB) *MatchRepository {
+	return &MatchRepository{Conn: Conn}
+}
+
+func (m *MatchRepository) AddMatch(ctx context.Context, match *domain.Match) error {
+	_, err := m.Conn.NewInsert().Model(match).Exec(ctx)
+	if err != nil {
+		logging.FromContext(ctx).Error("insert match failed", "user_id", match.UserId, "err", err)
+	}
+	return err
+}
+
+func (m *MatchRepository) GetMatchStatsByUserId(ctx context.Context, userId string) (*domain.MatchStats, error) {
+	stats := new(domain.MatchStats)
+	err := m.Conn.NewSelect().
+		Model((*domain.Match)(nil)).
+		ColumnExpr("COUNT(*) AS matches").
+		ColumnExpr("COALESCE(MAX(survival_millis), 0) AS best_survival_millis").
+		Where("user_id = ?", userId).
+		Scan(ctx, stats)
+	if err != nil {
+		logging.FromContext(ctx).Error("select match stats failed", "user_id", userId, "err", err)
+		return nil, err
+	}
+	return stats, nil
+}
+
+func (m *MatchRepository) GetMatchesByUserId(ctx context.Context, userId string, limit int) ([]*domain.Match, error) {
+	var matches []*domain.Match
+	err := m.Conn.NewSelect().
+		Model(&matches).
+		Where("user_id = ?", userId).
+		OrderExpr("ended_at DESC").
+		Limit(limit).
+		Scan(ctx)
+	if err != nil {
+		logging.FromContext(ctx).Error("select matches failed", "user_id", userId, "err", err)
+		return nil, err
+	}
+	return matches, nil
+}
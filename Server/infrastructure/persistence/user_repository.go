@@ -2,6 +2,7 @@ package infrastructure
 
 import (
 	"context"
+	"example.com/application/logging"
 	"example.com/domain"
 	"github.com/uptrace/bun"
 )
@@ -22,6 +23,9 @@ func (u *UserRepository) AddUser(ctx context.Context, id, authToken, name string
 		HighScore: 0,
 	}
 	_, err := u.Conn.NewInsert().Model(user).Exec(ctx)
+	if err != nil {
+		logging.FromContext(ctx).Error("insert user failed", "user_id", id, "err", err)
+	}
 	return err
 }
 
@@ -30,18 +34,68 @@ func (u *UserRepository) DeleteUser(ctx context.Context, id string) error {
 }
 
 func (u *UserRepository) GetUserByUserId(ctx context.Context, id string) (*domain.User, error) {
-	return nil, nil
+	user := new(domain.User)
+	err := u.Conn.NewSelect().Model(user).Where("id = ?", id).Scan(ctx)
+	if err != nil {
+		logging.FromContext(ctx).Debug("select user by id failed", "user_id", id, "err", err)
+		return nil, err
+	}
+	return user, nil
 }
 
 func (u *UserRepository) GetUserByAuthToken(ctx context.Context, authToken string) (*domain.User, error) {
 	user := new(domain.User)
 	err := u.Conn.NewSelect().Model(user).Where("auth_token = ?", authToken).Scan(ctx)
 	if err != nil {
+		logging.FromContext(ctx).Debug("select user by auth token failed", "err", err)
 		return nil, err
 	}
 	return user, nil
 }
 
+func (u *UserRepository) UpdateAppearance(ctx context.Context, id, color, skin string) error {
+	_, err := u.Conn.NewUpdate().
+		Model((*domain.User)(nil)).
+		Set("color = ?", color).
+		Set("skin = ?", skin).
+		Where("id = ?", id).
+		Exec(ctx)
+	if err != nil {
+		logging.FromContext(ctx).Error("update user appearance failed", "user_id", id, "err", err)
+	}
+	return err
+}
+
+func (u *UserRepository) UpdateHighScore(ctx context.Context, id string, highScore int) error {
+	_, err := u.Conn.NewUpdate().
+		Model((*domain.User)(nil)).
+		Set("high_score = ?", highScore).
+		Where("id = ?", id).
+		Where("high_score < ?", highScore).
+		Exec(ctx)
+	if err != nil {
+		logging.FromContext(ctx).Error("update high score failed", "user_id", id, "err", err)
+	}
+	return err
+}
+
+func (u *UserRepository) GetUserRank(ctx context.Context, highScore int) (int, int, error) {
+	var counts struct {
+		Higher int
+		Total  int
+	}
+	err := u.Conn.NewSelect().
+		Model((*domain.User)(nil)).
+		ColumnExpr("COALESCE(SUM(high_score > ?), 0) AS higher", highScore).
+		ColumnExpr("COUNT(*) AS total").
+		Scan(ctx, &counts)
+	if err != nil {
+		logging.FromContext(ctx).Error("select user rank failed", "err", err)
+		return 0, 0, err
+	}
+	return counts.Higher + 1, counts.Total, nil
+}
+
 func (u *UserRepository) GetUserRanking(ctx context.Context) ([]*domain.UserRanking, error) {
 	var users []domain.User
 
@@ -51,6 +105,7 @@ func (u *UserRepository) GetUserRanking(ctx context.Context) ([]*domain.UserRank
 		OrderExpr("high_score DESC"). // ハイスコアで降順にソート
 		Scan(ctx)
 	if err != nil {
+		logging.FromContext(ctx).Error("select user ranking failed", "err", err)
 		return nil, err
 	}
 
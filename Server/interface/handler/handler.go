@@ -2,6 +2,10 @@ package _interface
 
 import (
 	"encoding/json"
+	"errors"
+	"example.com/application/auth"
+	"example.com/application/game"
+	"example.com/application/logging"
 	"example.com/application/service"
 	"example.com/interface/request"
 	"example.com/interface/response"
@@ -11,10 +15,12 @@ import (
 
 type UserHandler struct {
 	userService service.UserService
+	hub         *game.Hub
 }
 
-func NewUserHandler(userService *service.UserService) *UserHandler {
-	return &UserHandler{userService: *userService}
+// NewUserHandler hub は見た目の変更を参加中の部屋に伝えるために使う
+func NewUserHandler(userService *service.UserService, hub *game.Hub) *UserHandler {
+	return &UserHandler{userService: *userService, hub: hub}
 }
 
 func (u *UserHandler) UserCreateHandle() bunrouter.HandlerFunc {
@@ -28,6 +34,7 @@ func (u *UserHandler) UserCreateHandle() bunrouter.HandlerFunc {
 		ctx := req.Context()
 		authToken, err := u.userService.Add(ctx, requestData.Name)
 		if err != nil {
+			logging.FromContext(ctx).Error("failed to create user", "name", requestData.Name, "err", err)
 			http.Error(w, "Failed to create user", http.StatusInternalServerError)
 			return err
 		}
@@ -62,18 +69,23 @@ func (u *UserHandler) UserGetHandle() bunrouter.HandlerFunc {
 		// Retrieve user by auth token
 		user, err := u.userService.GetUserByAuthToken(ctx, requestData.Token)
 		if err != nil {
+			logging.FromContext(ctx).Error("failed to get user", "err", err)
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return err
 		}
+		if user == nil {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return nil
+		}
 
-		// Prepare the response using UserGetResponse struct
-		responseData := &response.UserGetResponse{
-			Id:        user.Id,
-			Name:      user.Name,
-			HighScore: user.HighScore,
+		profile, err := u.userService.GetProfile(ctx, user)
+		if err != nil {
+			logging.FromContext(ctx).Error("failed to get user profile", "err", err)
+			http.Error(w, "Failed to get user", http.StatusInternalServerError)
+			return err
 		}
 
-		respBytes, err := json.Marshal(responseData)
+		respBytes, err := json.Marshal(userGetResponse(profile))
 		if err != nil {
 			http.Error(w, "Failed to generate response", http.StatusInternalServerError)
 			return err
@@ -87,6 +99,59 @@ func (u *UserHandler) UserGetHandle() bunrouter.HandlerFunc {
 	}
 }
 
+// UserAppearanceHandle 色とスキンを変更する。AuthenticateMiddleware の後ろに置く
+func (u *UserHandler) UserAppearanceHandle() bunrouter.HandlerFunc {
+	return func(w http.ResponseWriter, req bunrouter.Request) error {
+		var requestData request.UserAppearanceRequest
+		if err := json.NewDecoder(req.Body).Decode(&requestData); err != nil {
+			http.Error(w, "Failed to parse request", http.StatusBadRequest)
+			return err
+		}
+
+		ctx := req.Context()
+		user, err := u.userService.GetUserByUserId(ctx, auth.GetUserIDFromContext(ctx))
+		if err != nil {
+			logging.FromContext(ctx).Error("failed to get user", "err", err)
+			http.Error(w, "Failed to get user", http.StatusInternalServerError)
+			return err
+		}
+		if user == nil {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return nil
+		}
+
+		profile, err := u.userService.UpdateAppearance(ctx, user, requestData)
+		switch {
+		case errors.Is(err, service.ErrUnknownCosmetic):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return nil
+		case errors.Is(err, service.ErrCosmeticLocked):
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return nil
+		case err != nil:
+			logging.FromContext(ctx).Error("failed to update appearance", "err", err)
+			http.Error(w, "Failed to update appearance", http.StatusInternalServerError)
+			return err
+		}
+		u.hub.UpdateAppearance(user.Id, profile.Appearance())
+
+		w.Header().Set("Content-Type", "application/json")
+		return json.NewEncoder(w).Encode(userGetResponse(profile))
+	}
+}
+
+func userGetResponse(profile *service.Profile) *response.UserGetResponse {
+	return &response.UserGetResponse{
+		Id:             profile.User.Id,
+		Name:           profile.User.Name,
+		HighScore:      profile.User.HighScore,
+		Appearance:     profile.Appearance(),
+		Achievements:   profile.Achievements,
+		UnlockedColors: profile.UnlockedColors,
+		UnlockedSkins:  profile.UnlockedSkins,
+	}
+}
+
 // MoveHandle プレイヤー移動同期
 func (u *UserHandler) MoveHandle() bunrouter.HandlerFunc {
 	return func(w http.ResponseWriter, req bunrouter.Request) error {
@@ -100,6 +165,7 @@ func (u *UserHandler) UserRankingGetHandle() bunrouter.HandlerFunc {
 		// UserServiceからランキングを取得
 		userRankings, err := u.userService.GetUserRanking(req.Context())
 		if err != nil {
+			logging.FromContext(req.Context()).Error("failed to get user rankings", "err", err)
 			http.Error(w, "Failed to get user rankings", http.StatusInternalServerError)
 			return err
 		}
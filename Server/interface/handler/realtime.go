@@ -0,0 +1,238 @@
+package _interface
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"example.com/application/game"
+	"example.com/application/logging"
+	"example.com/application/service"
+	"example.com/interface/response"
+	"github.com/eiei114/dinosaur-jump/protocol"
+	"github.com/eiei114/dinosaur-jump/protocol/netsim"
+	"github.com/uptrace/bunrouter"
+	"golang.org/x/net/websocket"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+const (
+	// helloTimeout 接続してからHelloが届くまで待つ時間
+	helloTimeout = 10 * time.Second
+	// readTimeout この時間何も届かなければ切断されたとみなす
+	readTimeout = 30 * time.Second
+	// maxMessageSize クライアントから受け付けるメッセージの最大サイズ
+	maxMessageSize = 4 << 10
+)
+
+type RealtimeHandler struct {
+	userService *service.UserService
+	hub         *game.Hub
+	checkOrigin func(origin string) bool
+	netsim      netsim.Config
+}
+
+// NewRealtimeHandler checkOrigin はブラウザから接続されたときのOriginを検証する
+// sim が設定されていれば、Hello の後のやり取りに遅延やパケットロスを加える
+func NewRealtimeHandler(userService *service.UserService, hub *game.Hub, checkOrigin func(origin string) bool, sim netsim.Config) *RealtimeHandler {
+	return &RealtimeHandler{userService: userService, hub: hub, checkOrigin: checkOrigin, netsim: sim}
+}
+
+// RealtimeHandle WebSocketで部屋に参加し、入力の受信とスナップショットの送信を行う
+func (h *RealtimeHandler) RealtimeHandle() bunrouter.HandlerFunc {
+	return func(w http.ResponseWriter, req bunrouter.Request) error {
+		ctx := req.Context()
+		server := websocket.Server{
+			Handshake: func(config *websocket.Config, r *http.Request) error {
+				// ネイティブのクライアントはOriginを付けないことがある。付いている場合だけ検証する
+				if origin := r.Header.Get("Origin"); origin != "" && !h.checkOrigin(origin) {
+					return errors.New("origin not allowed")
+				}
+				return nil
+			},
+			Handler: func(ws *websocket.Conn) {
+				ws.MaxPayloadBytes = maxMessageSize
+				h.serve(ctx, ws)
+			},
+		}
+		server.ServeHTTP(w, req.Request)
+		return nil
+	}
+}
+
+// StatsHandle 部屋とプレイヤーの数、tickの処理が間に合っているかを返す
+func (h *RealtimeHandler) StatsHandle() bunrouter.HandlerFunc {
+	return func(w http.ResponseWriter, req bunrouter.Request) error {
+		st := h.hub.Stats()
+		w.Header().Set("Content-Type", "application/json")
+		return json.NewEncoder(w).Encode(&response.ServerStatsResponse{
+			Rooms:        st.Rooms,
+			Players:      st.Players,
+			Ticks:        st.Ticks,
+			TickOverruns: st.TickOverruns,
+		})
+	}
+}
+
+// HealthHandle 動いていることと、受け付けるプロトコルバージョンを返す
+func (h *RealtimeHandler) HealthHandle() bunrouter.HandlerFunc {
+	return func(w http.ResponseWriter, req bunrouter.Request) error {
+		w.Header().Set("Content-Type", "application/json")
+		return json.NewEncoder(w).Encode(&response.HealthResponse{
+			Status:              "ok",
+			Version:             protocol.Version,
+			MinSupportedVersion: protocol.MinSupportedVersion,
+			Players:             h.hub.Stats().Players,
+		})
+	}
+}
+
+func (h *RealtimeHandler) serve(ctx context.Context, ws *websocket.Conn) {
+	defer ws.Close()
+	logger := logging.FromContext(ctx)
+
+	hello, err := h.readHello(ws)
+	if err != nil {
+		logger.Warn("realtime handshake failed", "err", err)
+		writeMessage(ws, &protocol.Error{Code: "bad_hello", Message: err.Error()})
+		return
+	}
+	if hello.Version < protocol.MinSupportedVersion || hello.Version > protocol.Version {
+		writeMessage(ws, &protocol.Error{Code: "unsupported_version", Message: "please update the client"})
+		return
+	}
+
+	user, err := h.userService.GetUserByAuthToken(ctx, hello.Token)
+	if err != nil {
+		logger.Error("failed to get user", "err", err)
+		writeMessage(ws, &protocol.Error{Code: "internal", Message: "failed to get user"})
+		return
+	}
+	if user == nil {
+		writeMessage(ws, &protocol.Error{Code: "unauthorized", Message: "invalid token"})
+		return
+	}
+
+	// 再開できなければ新しく参加する。Welcome.Resumed でクライアントはどちらになったかを知る
+	var client *game.Client
+	if hello.Resume != "" {
+		client, err = h.hub.Resume(user.Id, hello.Resume)
+		if err != nil {
+			logger.Info("realtime resume failed, joining as a new player", "user_id", user.Id, "err", err)
+		}
+	}
+	if client == nil {
+		client, err = h.hub.Join(user, hello.Room)
+		if err != nil {
+			writeMessage(ws, &protocol.Error{Code: "join_failed", Message: err.Error()})
+			return
+		}
+	}
+	defer client.Disconnect()
+
+	logger = logger.With("user_id", user.Id, "player_id", client.PlayerID, "room", client.RoomID())
+	logger.Info("realtime connected")
+
+	go writeLoop(ws, client.Send, logger, h.netsim)
+	h.readLoop(ws, client, logger)
+	logger.Info("realtime disconnected")
+}
+
+func (h *RealtimeHandler) readHello(ws *websocket.Conn) (*protocol.Hello, error) {
+	ws.SetReadDeadline(time.Now().Add(helloTimeout))
+	var data []byte
+	if err := websocket.Message.Receive(ws, &data); err != nil {
+		return nil, err
+	}
+	msg, err := protocol.Decode(data)
+	if err != nil {
+		return nil, err
+	}
+	hello, ok := msg.(*protocol.Hello)
+	if !ok {
+		return nil, errors.New("first message must be hello")
+	}
+	return hello, nil
+}
+
+func (h *RealtimeHandler) readLoop(ws *websocket.Conn, client *game.Client, logger *slog.Logger) {
+	submit := func(data []byte) {
+		msg, err := protocol.Decode(data)
+		if err != nil {
+			logger.Debug("ignoring malformed message", "err", err)
+			return
+		}
+		switch msg.(type) {
+		case *protocol.Input, *protocol.SnapshotAck, *protocol.Respawn, *protocol.Pause:
+			client.Submit(msg)
+		default:
+			logger.Debug("ignoring unexpected message", "type", msg.MessageType())
+		}
+	}
+	if h.netsim.Enabled() {
+		link := netsim.NewLink(h.netsim, submit)
+		defer link.Close()
+		submit = func(data []byte) {
+			// 入力と受信確認は失われても次のもので取り戻せるので、ロスや順序の入れ替わりの対象にする
+			msg, err := protocol.Decode(data)
+			reliable := true
+			switch msg.(type) {
+			case *protocol.Input, *protocol.SnapshotAck:
+				reliable = false
+			}
+			link.Send(data, reliable && err == nil)
+		}
+	}
+
+	for {
+		ws.SetReadDeadline(time.Now().Add(readTimeout))
+		var data []byte
+		if err := websocket.Message.Receive(ws, &data); err != nil {
+			return
+		}
+		submit(data)
+	}
+}
+
+// writeLoop 部屋からのフレームを送る。バイナリスナップショットはバイナリフレーム、それ以外はテキストフレームで送る
+// sim が設定されていれば、スナップショットはロスや順序の入れ替わりの対象にする
+func writeLoop(ws *websocket.Conn, send <-chan []byte, logger *slog.Logger, sim netsim.Config) {
+	failed := false
+	write := func(data []byte) {
+		if failed {
+			return
+		}
+		var err error
+		if protocol.IsEntitySnapshot(data) {
+			err = websocket.Message.Send(ws, data)
+		} else {
+			err = websocket.Message.Send(ws, string(data))
+		}
+		if err != nil {
+			logger.Debug("realtime write failed", "err", err)
+			ws.Close()
+			failed = true
+		}
+	}
+	if sim.Enabled() {
+		link := netsim.NewLink(sim, write)
+		defer link.Close()
+		write = func(data []byte) {
+			link.Send(data, !protocol.IsEntitySnapshot(data))
+		}
+	}
+
+	// 書き込みに失敗しても、部屋が Disconnect でチャネルを閉じるまで読み捨てる
+	for data := range send {
+		write(data)
+	}
+}
+
+func writeMessage(ws *websocket.Conn, msg protocol.Message) {
+	data, err := protocol.Encode(msg)
+	if err != nil {
+		return
+	}
+	websocket.Message.Send(ws, string(data))
+}
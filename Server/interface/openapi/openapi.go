@@ -0,0 +1,25 @@
+package openapi
+
+import (
+	_ "embed"
+	"github.com/uptrace/bunrouter"
+	"net/http"
+)
+
+//go:embed openapi.json
+var spec []byte
+
+// Spec REST APIのOpenAPI 3 ドキュメントを返す
+func Spec() []byte {
+	return spec
+}
+
+// SpecHandle OpenAPIドキュメントをそのまま返す
+func SpecHandle() bunrouter.HandlerFunc {
+	return func(w http.ResponseWriter, req bunrouter.Request) error {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(spec)
+		return nil
+	}
+}
@@ -1,9 +1,11 @@
 package request
 
-type UserCreateRequest struct {
-	Name string `json:"name"`
-}
+import "github.com/eiei114/dinosaur-jump/protocol"
 
-type UserGetRequest struct {
-	Token string `json:"auth_token"`
-}
+// リクエストの型はクライアントと共有するため protocol パッケージで定義している
+
+type UserCreateRequest = protocol.UserCreateRequest
+
+type UserGetRequest = protocol.UserGetRequest
+
+type UserAppearanceRequest = protocol.UserAppearanceRequest
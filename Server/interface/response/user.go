@@ -1,16 +1,15 @@
 package response
 
-type UserCreateResponse struct {
-	Token string `json:"token"`
-}
+import "github.com/eiei114/dinosaur-jump/protocol"
 
-type UserGetResponse struct {
-	Id        string `json:"id"`
-	Name      string `json:"name"`
-	HighScore int    `json:"highScore"`
-}
+// レスポンスの型はクライアントと共有するため protocol パッケージで定義している
 
-type UserRankingResponse struct {
-	Name      string `json:"name"`
-	HighScore int    `json:"highScore"`
-}
+type UserCreateResponse = protocol.UserCreateResponse
+
+type UserGetResponse = protocol.UserGetResponse
+
+type UserRankingResponse = protocol.UserRankingResponse
+
+type ServerStatsResponse = protocol.ServerStatsResponse
+
+type HealthResponse = protocol.HealthResponse
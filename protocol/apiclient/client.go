@@ -0,0 +1,214 @@
+// Package apiclient はサーバーの interface/openapi/openapi.json に対応するREST APIのクライアント
+// 通信部分は仕様から internal/oapi に生成したもので、ここではエラーの扱いをそろえた使いやすい形にして公開する。
+// スキーマは x-go-type で protocol パッケージの型に対応づけているので、サーバーのハンドラーと同じ型でやり取りする
+package apiclient
+
+//go:generate go run github.com/oapi-codegen/oapi-codegen/v2/cmd/oapi-codegen -config oapi-codegen.yaml ../../Server/interface/openapi/openapi.json
+
+import (
+	"context"
+	"fmt"
+	"github.com/eiei114/dinosaur-jump/protocol"
+	"github.com/eiei114/dinosaur-jump/protocol/apiclient/internal/oapi"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	token      string
+	api        *oapi.ClientWithResponses
+}
+
+type Option func(c *Client)
+
+// WithHTTPClient 使うhttp.Clientを差し替える
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithToken 認証が必要なAPIで x-token ヘッダーに付けるトークンを設定する
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// New baseURL(例: http://localhost:8080)のサーバーに接続するクライアントを返す
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: &http.Client{Timeout: 5 * time.Second},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	// サーバーのURLとして不正な文字列でない限り失敗しない。不正なら呼び出したときに返す
+	c.api, _ = oapi.NewClientWithResponses(c.baseURL, oapi.WithHTTPClient(c.httpClient))
+	return c
+}
+
+// Error サーバーが2xx以外を返したときのエラー
+type Error struct {
+	Method     string
+	Path       string
+	StatusCode int
+	RequestID  string
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s %s: status=%d request_id=%s: %s", e.Method, e.Path, e.StatusCode, e.RequestID, e.Message)
+}
+
+// result 生成したクライアントが返す結果のうち、エラーにするときに使う部分
+type result interface {
+	StatusCode() int
+}
+
+// CreateUser POST /user/create
+func (c *Client) CreateUser(ctx context.Context, name string) (*protocol.UserCreateResponse, error) {
+	if err := c.ready(); err != nil {
+		return nil, err
+	}
+	res, err := c.api.CreateUserWithResponse(ctx, protocol.UserCreateRequest{Name: name})
+	if err := check(http.MethodPost, "/user/create", res, err, res != nil && res.JSON200 != nil); err != nil {
+		return nil, err
+	}
+	return res.JSON200, nil
+}
+
+// GetUser POST /user/get
+func (c *Client) GetUser(ctx context.Context, authToken string) (*protocol.UserGetResponse, error) {
+	if err := c.ready(); err != nil {
+		return nil, err
+	}
+	res, err := c.api.GetUserWithResponse(ctx, protocol.UserGetRequest{Token: authToken})
+	if err := check(http.MethodPost, "/user/get", res, err, res != nil && res.JSON200 != nil); err != nil {
+		return nil, err
+	}
+	return res.JSON200, nil
+}
+
+// UpdateAppearance PUT /user/appearance WithToken で認証トークンを設定しておく
+func (c *Client) UpdateAppearance(ctx context.Context, look protocol.Appearance) (*protocol.UserGetResponse, error) {
+	if err := c.ready(); err != nil {
+		return nil, err
+	}
+	res, err := c.api.UpdateUserAppearanceWithResponse(ctx, &oapi.UpdateUserAppearanceParams{XToken: c.token}, look)
+	if err := check(http.MethodPut, "/user/appearance", res, err, res != nil && res.JSON200 != nil); err != nil {
+		return nil, err
+	}
+	return res.JSON200, nil
+}
+
+// GetUserRanking GET /users/get
+func (c *Client) GetUserRanking(ctx context.Context) ([]protocol.UserRankingResponse, error) {
+	if err := c.ready(); err != nil {
+		return nil, err
+	}
+	res, err := c.api.GetUserRankingWithResponse(ctx)
+	if err := check(http.MethodGet, "/users/get", res, err, res != nil && res.JSON200 != nil); err != nil {
+		return nil, err
+	}
+	return *res.JSON200, nil
+}
+
+// Health GET /healthz
+func (c *Client) Health(ctx context.Context) (*protocol.HealthResponse, error) {
+	if err := c.ready(); err != nil {
+		return nil, err
+	}
+	res, err := c.api.HealthWithResponse(ctx)
+	if err := check(http.MethodGet, "/healthz", res, err, res != nil && res.JSON200 != nil); err != nil {
+		return nil, err
+	}
+	return res.JSON200, nil
+}
+
+// GetStats GET /stats
+func (c *Client) GetStats(ctx context.Context) (*protocol.ServerStatsResponse, error) {
+	if err := c.ready(); err != nil {
+		return nil, err
+	}
+	res, err := c.api.GetStatsWithResponse(ctx)
+	if err := check(http.MethodGet, "/stats", res, err, res != nil && res.JSON200 != nil); err != nil {
+		return nil, err
+	}
+	return res.JSON200, nil
+}
+
+// Move POST /move
+func (c *Client) Move(ctx context.Context) error {
+	if err := c.ready(); err != nil {
+		return err
+	}
+	res, err := c.api.MoveWithResponse(ctx)
+	return check(http.MethodPost, "/move", res, err, true)
+}
+
+// Destroy POST /destroy
+func (c *Client) Destroy(ctx context.Context) error {
+	if err := c.ready(); err != nil {
+		return err
+	}
+	res, err := c.api.DestroyWithResponse(ctx)
+	return check(http.MethodPost, "/destroy", res, err, true)
+}
+
+// ready New でクライアントを作れなかった(baseURLが不正だった)ときのエラー
+func (c *Client) ready() error {
+	if c.api == nil {
+		return fmt.Errorf("apiclient: invalid server URL %q", c.baseURL)
+	}
+	return nil
+}
+
+// check 通信のエラーと2xx以外のステータスをエラーにする
+// decoded は2xxのときにレスポンスの本文を読めたか。JSONでなかった場合などはfalse
+func check(method, path string, res result, err error, decoded bool) error {
+	if err != nil {
+		return fmt.Errorf("%s %s: %w", method, path, err)
+	}
+	var httpRes *http.Response
+	var body []byte
+	switch r := res.(type) {
+	case *oapi.CreateUserResult:
+		httpRes, body = r.HTTPResponse, r.Body
+	case *oapi.GetUserResult:
+		httpRes, body = r.HTTPResponse, r.Body
+	case *oapi.UpdateUserAppearanceResult:
+		httpRes, body = r.HTTPResponse, r.Body
+	case *oapi.GetUserRankingResult:
+		httpRes, body = r.HTTPResponse, r.Body
+	case *oapi.HealthResult:
+		httpRes, body = r.HTTPResponse, r.Body
+	case *oapi.GetStatsResult:
+		httpRes, body = r.HTTPResponse, r.Body
+	case *oapi.MoveResult:
+		httpRes, body = r.HTTPResponse, r.Body
+	case *oapi.DestroyResult:
+		httpRes, body = r.HTTPResponse, r.Body
+	}
+	requestID := httpRes.Header.Get(protocol.RequestIDHeader)
+	if res.StatusCode() < 200 || res.StatusCode() >= 300 {
+		if len(body) > 1024 {
+			body = body[:1024]
+		}
+		return &Error{
+			Method:     method,
+			Path:       path,
+			StatusCode: res.StatusCode(),
+			RequestID:  requestID,
+			Message:    strings.TrimSpace(string(body)),
+		}
+	}
+	if !decoded {
+		return fmt.Errorf("%s %s: decode response (request_id=%s): unexpected content type %q", method, path, requestID, httpRes.Header.Get("Content-Type"))
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package apiclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/eiei114/dinosaur-jump/protocol"
+)
+
+func TestClient(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/user/create", func(w http.ResponseWriter, r *http.Request) {
+		var req protocol.UserCreateRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.Name == "" {
+			w.Header().Set(protocol.RequestIDHeader, "req-1")
+			http.Error(w, "name is empty", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(protocol.UserCreateResponse{Token: "token-" + req.Name})
+	})
+	mux.HandleFunc("/user/appearance", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(protocol.TokenHeader) != "secret" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		var look protocol.Appearance
+		json.NewDecoder(r.Body).Decode(&look)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(protocol.UserGetResponse{Appearance: look})
+	})
+	mux.HandleFunc("/users/get", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode([]protocol.UserRankingResponse{{Name: "a", HighScore: 3000}})
+	})
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	ctx := context.Background()
+
+	created, err := New(srv.URL+"/").CreateUser(ctx, "dino")
+	if err != nil || created.Token != "token-dino" {
+		t.Fatalf("CreateUser = %+v, %v", created, err)
+	}
+
+	_, err = New(srv.URL).CreateUser(ctx, "")
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("CreateUser with empty name: err = %v, want *Error", err)
+	}
+	if apiErr.StatusCode != http.StatusBadRequest || apiErr.RequestID != "req-1" || apiErr.Message != "name is empty" {
+		t.Errorf("CreateUser with empty name: %+v", apiErr)
+	}
+
+	look := protocol.Appearance{Color: "red"}
+	user, err := New(srv.URL, WithToken("secret")).UpdateAppearance(ctx, look)
+	if err != nil || user.Appearance != look {
+		t.Errorf("UpdateAppearance = %+v, %v", user, err)
+	}
+	if _, err := New(srv.URL).UpdateAppearance(ctx, look); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("UpdateAppearance without token: err = %v, want 401", err)
+	}
+
+	ranking, err := New(srv.URL).GetUserRanking(ctx)
+	if err != nil || len(ranking) != 1 || ranking[0].HighScore != 3000 {
+		t.Errorf("GetUserRanking = %+v, %v", ranking, err)
+	}
+
+	// JSONでない2xxはデコードできないのでエラーにする
+	if _, err := New(srv.URL).Health(ctx); err == nil || errors.As(err, &apiErr) {
+		t.Errorf("Health with non-JSON body: err = %v, want a decode error", err)
+	}
+
+	if _, err := New("://bad").Health(ctx); err == nil {
+		t.Error("Health with an invalid URL: want an error")
+	}
+}
@@ -0,0 +1,73 @@
+package protocol
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ErrUnknownMessageType 知らない種類のメッセージを受け取った
+var ErrUnknownMessageType = errors.New("protocol: unknown message type")
+
+// envelope メッセージの種類と中身をまとめたワイヤーフォーマット
+type envelope struct {
+	Type    MessageType     `json:"type"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// Encode メッセージを {"type": ..., "payload": ...} 形式のJSONにする
+func Encode(msg Message) ([]byte, error) {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(&envelope{Type: msg.MessageType(), Payload: payload})
+}
+
+// Decode Encodeしたバイト列からメッセージを復元する
+func Decode(data []byte) (Message, error) {
+	var env envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return nil, fmt.Errorf("protocol: decode envelope: %w", err)
+	}
+
+	msg, err := newMessage(env.Type)
+	if err != nil {
+		return nil, err
+	}
+	if len(env.Payload) > 0 {
+		if err := json.Unmarshal(env.Payload, msg); err != nil {
+			return nil, fmt.Errorf("protocol: decode %s: %w", env.Type, err)
+		}
+	}
+	return msg, nil
+}
+
+func newMessage(t MessageType) (Message, error) {
+	switch t {
+	case TypeHello:
+		return &Hello{}, nil
+	case TypeWelcome:
+		return &Welcome{}, nil
+	case TypeInput:
+		return &Input{}, nil
+	case TypeSnapshot:
+		return &Snapshot{}, nil
+	case TypeSnapshotAck:
+		return &SnapshotAck{}, nil
+	case TypeRespawn:
+		return &Respawn{}, nil
+	case TypePause:
+		return &Pause{}, nil
+	case TypeRanking:
+		return &Ranking{}, nil
+	case TypeDeath:
+		return &Death{}, nil
+	case TypeRunResult:
+		return &RunResult{}, nil
+	case TypeError:
+		return &Error{}, nil
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownMessageType, t)
+	}
+}
@@ -0,0 +1,88 @@
+package protocol
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestEncodeDecodeRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  Message
+	}{
+		{"hello", &Hello{Version: Version, Token: "token", Room: "room-1", Resume: "resume"}},
+		{"welcome", &Welcome{
+			Version:           Version,
+			PlayerID:          7,
+			Room:              "room-1",
+			TickRate:          20,
+			ResumeToken:       "resume",
+			ResumeGraceMillis: 10000,
+			Resumed:           true,
+			IdleTimeoutMillis: 5000,
+			MaxPauseMillis:    30000,
+			Movement:          Movement{Acceleration: 1800, Friction: 1200, MaxSpeed: 300},
+		}},
+		{"input", &Input{Seq: 42, Up: true, Left: true, ViewTick: 100}},
+		{"empty input", &Input{Seq: 1}},
+		{"snapshot", &Snapshot{Tick: 3, Players: []PlayerInfo{
+			{ID: 1, Name: "a", Position: Position{X: 1.5, Y: -2}, Appearance: Appearance{Color: "red", Skin: "cap"}},
+			{ID: 2, Name: "npc", Position: Position{X: 100, Y: 200}, NPC: true},
+		}}},
+		{"snapshot ack", &SnapshotAck{Seq: 9}},
+		{"respawn", &Respawn{}},
+		{"pause", &Pause{Paused: true}},
+		{"ranking", &Ranking{Entries: []RankingEntry{
+			{PlayerID: 1, Name: "a", SurvivalMillis: 12345, Alive: true},
+			{PlayerID: 2, Name: "b", SurvivalMillis: 100},
+		}}},
+		{"death", &Death{PlayerID: 3, Cause: CauseNPC}},
+		{"run result", &RunResult{SurvivalMillis: 5000, HighScoreMillis: 8000, NewBest: true, GlobalRank: 2, TotalPlayers: 10}},
+		{"error", &Error{Code: "bad_request", Message: "unknown room"}},
+	}
+
+	seen := make(map[MessageType]bool)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := Encode(tt.msg)
+			if err != nil {
+				t.Fatalf("Encode: %v", err)
+			}
+			got, err := Decode(data)
+			if err != nil {
+				t.Fatalf("Decode(%s): %v", data, err)
+			}
+			if !reflect.DeepEqual(got, tt.msg) {
+				t.Errorf("round trip = %#v, want %#v", got, tt.msg)
+			}
+		})
+		seen[tt.msg.MessageType()] = true
+	}
+
+	// メッセージの種類を足したらここにも足す
+	for _, typ := range []MessageType{
+		TypeHello, TypeWelcome, TypeInput, TypeSnapshot, TypeSnapshotAck, TypeRespawn,
+		TypePause, TypeRanking, TypeDeath, TypeRunResult, TypeError,
+	} {
+		if !seen[typ] {
+			t.Errorf("no round trip test for %q", typ)
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	if _, err := Decode([]byte(`{"type":"nope","payload":{}}`)); !errors.Is(err, ErrUnknownMessageType) {
+		t.Errorf("unknown type: err = %v, want ErrUnknownMessageType", err)
+	}
+	if _, err := Decode([]byte(`not json`)); err == nil {
+		t.Error("invalid JSON: want an error")
+	}
+	if _, err := Decode([]byte(`{"type":"input","payload":{"seq":"x"}}`)); err == nil {
+		t.Error("invalid payload: want an error")
+	}
+	// 中身のないメッセージはpayloadを省略してもよい
+	if msg, err := Decode([]byte(`{"type":"respawn"}`)); err != nil || !reflect.DeepEqual(msg, &Respawn{}) {
+		t.Errorf("respawn without payload = %#v, %v", msg, err)
+	}
+}
@@ -0,0 +1,84 @@
+package protocol
+
+// Appearance プレイヤーの見た目。空のフィールドは既定のものを使う
+type Appearance struct {
+	Color string `json:"color,omitempty"`
+	Skin  string `json:"skin,omitempty"`
+}
+
+// 実績。プレイ結果からサーバーが判定し、色やスキンの解除に使う
+const (
+	// AchievementFirstRun 1回プレイした
+	AchievementFirstRun = "first_run"
+	// AchievementSurvive30 30秒以上生き残った
+	AchievementSurvive30 = "survive_30s"
+	// AchievementSurvive60 60秒以上生き残った
+	AchievementSurvive60 = "survive_60s"
+	// AchievementVeteran 50回プレイした
+	AchievementVeteran = "veteran"
+)
+
+// Cosmetic 色やスキン。Achievement が空なら最初から使える
+type Cosmetic struct {
+	ID          string
+	Achievement string
+}
+
+// ColorCosmetic プレイヤーの画像に掛ける色
+type ColorCosmetic struct {
+	Cosmetic
+	R, G, B uint8
+}
+
+const (
+	DefaultColor = "mint"
+	DefaultSkin  = "classic"
+)
+
+// Colors 選べる色の一覧
+var Colors = []ColorCosmetic{
+	{Cosmetic{ID: DefaultColor}, 0x00, 0xfc, 0xe3},
+	{Cosmetic{ID: "sky"}, 0x4a, 0x90, 0xe2},
+	{Cosmetic{ID: "lemon"}, 0xf5, 0xd7, 0x3b},
+	{Cosmetic{ID: "coral", Achievement: AchievementFirstRun}, 0xff, 0x7f, 0x50},
+	{Cosmetic{ID: "violet", Achievement: AchievementSurvive30}, 0x9b, 0x59, 0xd0},
+	{Cosmetic{ID: "gold", Achievement: AchievementSurvive60}, 0xff, 0xc1, 0x07},
+}
+
+// Skins 選べるスキンの一覧。描き方はクライアントが決める
+var Skins = []Cosmetic{
+	{ID: DefaultSkin},
+	{ID: "mirror", Achievement: AchievementFirstRun},
+	{ID: "ghost", Achievement: AchievementVeteran},
+}
+
+// FindColor idの色を返す
+func FindColor(id string) (ColorCosmetic, bool) {
+	for _, c := range Colors {
+		if c.ID == id {
+			return c, true
+		}
+	}
+	return ColorCosmetic{}, false
+}
+
+// FindSkin idのスキンを返す
+func FindSkin(id string) (Cosmetic, bool) {
+	for _, s := range Skins {
+		if s.ID == id {
+			return s, true
+		}
+	}
+	return Cosmetic{}, false
+}
+
+// Normalized 空や知らない色・スキンを既定のものに置き換える
+func (a Appearance) Normalized() Appearance {
+	if _, ok := FindColor(a.Color); !ok {
+		a.Color = DefaultColor
+	}
+	if _, ok := FindSkin(a.Skin); !ok {
+		a.Skin = DefaultSkin
+	}
+	return a
+}
@@ -0,0 +1,251 @@
+// Package netsim リアルタイム通信に遅延・ゆらぎ・パケットロス・順序の入れ替わり・帯域制限を加える
+// ローカルホストでも回線の悪い環境を再現して、予測・補間・再接続を試せるようにする
+package netsim
+
+import (
+	"container/heap"
+	"errors"
+	"flag"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// minReorderDelay 順序を入れ替えるフレームに最低限加える遅延
+const minReorderDelay = 10 * time.Millisecond
+
+// Config 片方向の回線の状態。すべて0なら何もしない
+type Config struct {
+	// Latency 片道の遅延
+	Latency time.Duration `yaml:"latency" json:"latency"`
+	// Jitter 遅延のゆらぎ。Latency ± Jitter の範囲でばらつく
+	Jitter time.Duration `yaml:"jitter" json:"jitter"`
+	// Loss フレームを捨てる確率(0〜1)
+	Loss float64 `yaml:"loss" json:"loss"`
+	// Reorder フレームを後続のフレームより遅らせて順序を入れ替える確率(0〜1)
+	Reorder float64 `yaml:"reorder" json:"reorder"`
+	// Bandwidth 帯域(バイト/秒)。0なら無制限。1秒分を超えて溜まったフレームは捨てる
+	Bandwidth int `yaml:"bandwidth" json:"bandwidth"`
+}
+
+// Enabled 何か1つでも設定されているか
+func (c Config) Enabled() bool {
+	return c != Config{}
+}
+
+// Validate 設定値の範囲をチェックする
+func (c Config) Validate() error {
+	var errs []error
+	if c.Latency < 0 {
+		errs = append(errs, fmt.Errorf("latency %v: must not be negative", c.Latency))
+	}
+	if c.Jitter < 0 {
+		errs = append(errs, fmt.Errorf("jitter %v: must not be negative", c.Jitter))
+	}
+	if c.Loss < 0 || c.Loss > 1 {
+		errs = append(errs, fmt.Errorf("loss %v: must be between 0 and 1", c.Loss))
+	}
+	if c.Reorder < 0 || c.Reorder > 1 {
+		errs = append(errs, fmt.Errorf("reorder %v: must be between 0 and 1", c.Reorder))
+	}
+	if c.Bandwidth < 0 {
+		errs = append(errs, fmt.Errorf("bandwidth %d: must not be negative", c.Bandwidth))
+	}
+	return errors.Join(errs...)
+}
+
+// RegisterFlags -netsim-latency などのフラグを fs に登録する。解析すると c に反映される
+func (c *Config) RegisterFlags(fs *flag.FlagSet) {
+	fs.DurationVar(&c.Latency, "netsim-latency", c.Latency, "simulated one-way latency")
+	fs.DurationVar(&c.Jitter, "netsim-jitter", c.Jitter, "simulated latency jitter (+/-)")
+	fs.Float64Var(&c.Loss, "netsim-loss", c.Loss, "simulated frame loss probability (0-1)")
+	fs.Float64Var(&c.Reorder, "netsim-reorder", c.Reorder, "probability that a frame is delayed behind later frames (0-1)")
+	fs.IntVar(&c.Bandwidth, "netsim-bandwidth", c.Bandwidth, "simulated bandwidth in bytes per second (0 = unlimited)")
+}
+
+// Stats Link を通ったフレームの数
+type Stats struct {
+	Sent      uint64
+	Delivered uint64
+	Dropped   uint64
+	Reordered uint64
+}
+
+// Link 片方向の回線
+// Send したフレームは設定に従って遅らせたり捨てたりしてから、1本のgoroutineで順に deliver に渡す
+type Link struct {
+	cfg     Config
+	deliver func([]byte)
+
+	mu     sync.Mutex
+	rnd    *rand.Rand
+	queue  frameQueue
+	seq    uint64
+	last   time.Time // 順序を保つフレームの最後の到着時刻
+	busy   time.Time // 帯域制限で回線が空く時刻
+	queued int       // 帯域制限で送信待ちのバイト数
+	stats  Stats
+
+	wake      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewLink deliver はフレームが届いたときに呼ばれる。呼ばれるのは常に同じgoroutineから
+func NewLink(cfg Config, deliver func([]byte)) *Link {
+	l := &Link{
+		cfg:     cfg,
+		deliver: deliver,
+		rnd:     rand.New(rand.NewSource(time.Now().UnixNano())),
+		wake:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+	go l.run()
+	return l
+}
+
+// Send フレームを送る
+// reliable なフレーム(ハンドシェイクや死亡通知など、届かないと困るもの)は捨てたり順序を入れ替えたりせず、遅延と帯域制限だけをかける
+func (l *Link) Send(data []byte, reliable bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	select {
+	case <-l.done:
+		return
+	default:
+	}
+
+	l.stats.Sent++
+	if !reliable && l.rnd.Float64() < l.cfg.Loss {
+		l.stats.Dropped++
+		return
+	}
+
+	now := time.Now()
+	at := now
+	if l.cfg.Bandwidth > 0 {
+		if !reliable && l.queued+len(data) > l.cfg.Bandwidth {
+			l.stats.Dropped++
+			return
+		}
+		if l.busy.Before(now) {
+			l.busy = now
+		}
+		l.busy = l.busy.Add(time.Duration(len(data)) * time.Second / time.Duration(l.cfg.Bandwidth))
+		l.queued += len(data)
+		at = l.busy
+	}
+
+	at = at.Add(l.cfg.Latency)
+	if l.cfg.Jitter > 0 {
+		at = at.Add(time.Duration(l.rnd.Int63n(int64(2*l.cfg.Jitter))) - l.cfg.Jitter)
+	}
+
+	if !reliable && l.rnd.Float64() < l.cfg.Reorder {
+		// 後から送ったフレームに追い越させる
+		at = at.Add(minReorderDelay + time.Duration(l.rnd.Int63n(int64(l.cfg.Latency/2+l.cfg.Jitter+1))))
+		l.stats.Reordered++
+	} else {
+		// ゆらぎで順序が入れ替わらないようにする
+		if at.Before(l.last) {
+			at = l.last
+		}
+		l.last = at
+	}
+
+	l.seq++
+	heap.Push(&l.queue, &frame{at: at, seq: l.seq, data: data})
+	select {
+	case l.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Stats これまでに通ったフレームの数
+func (l *Link) Stats() Stats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.stats
+}
+
+// Close 回線を閉じる。まだ届いていないフレームは捨てる
+func (l *Link) Close() {
+	l.closeOnce.Do(func() { close(l.done) })
+}
+
+func (l *Link) run() {
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+
+	for {
+		ready, next := l.pop(time.Now())
+		for _, f := range ready {
+			l.deliver(f.data)
+		}
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		if next > 0 {
+			timer.Reset(next)
+		}
+
+		select {
+		case <-l.done:
+			return
+		case <-l.wake:
+		case <-timer.C:
+		}
+	}
+}
+
+// pop 到着時刻を過ぎたフレームを取り出す。次のフレームまでの時間も返す(なければ0)
+func (l *Link) pop(now time.Time) ([]*frame, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var ready []*frame
+	for l.queue.Len() > 0 && !l.queue[0].at.After(now) {
+		f := heap.Pop(&l.queue).(*frame)
+		if l.cfg.Bandwidth > 0 {
+			l.queued -= len(f.data)
+		}
+		l.stats.Delivered++
+		ready = append(ready, f)
+	}
+	if l.queue.Len() == 0 {
+		return ready, 0
+	}
+	return ready, l.queue[0].at.Sub(now)
+}
+
+type frame struct {
+	at   time.Time
+	seq  uint64
+	data []byte
+}
+
+// frameQueue 到着時刻順の優先度付きキュー。同時刻なら送った順
+type frameQueue []*frame
+
+func (q frameQueue) Len() int { return len(q) }
+func (q frameQueue) Less(i, j int) bool {
+	if q[i].at.Equal(q[j].at) {
+		return q[i].seq < q[j].seq
+	}
+	return q[i].at.Before(q[j].at)
+}
+func (q frameQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+func (q *frameQueue) Push(x any)   { *q = append(*q, x.(*frame)) }
+func (q *frameQueue) Pop() any {
+	old := *q
+	f := old[len(old)-1]
+	old[len(old)-1] = nil
+	*q = old[:len(old)-1]
+	return f
+}
@@ -0,0 +1,34 @@
+// Package protocol はクライアントとサーバーで共有する通信メッセージの定義
+// REST APIのリクエスト・レスポンスと、リアルタイム通信のメッセージをここにまとめ、
+// 両者でワイヤーフォーマットが食い違わないようにする
+package protocol
+
+import "strings"
+
+// Version リアルタイム通信のプロトコルバージョン
+// メッセージの互換性がなくなる変更をしたら上げる
+const Version = 2
+
+// MinSupportedVersion サーバーが受け付ける最も古いクライアントのプロトコルバージョン
+const MinSupportedVersion = 2
+
+// RequestIDHeader サーバーがすべてのレスポンスに付けるリクエストIDのヘッダー
+const RequestIDHeader = "X-Request-ID"
+
+// TokenHeader 認証が必要なAPIで認証トークンを付けるヘッダー
+const TokenHeader = "x-token"
+
+// RealtimePath リアルタイム通信(WebSocket)のエンドポイント
+const RealtimePath = "/realtime"
+
+// RealtimeURL REST APIのURL http(s)://host を ws(s)://host/realtime に変換する
+func RealtimeURL(baseURL string) string {
+	u := strings.TrimRight(baseURL, "/")
+	switch {
+	case strings.HasPrefix(u, "https://"):
+		u = "wss://" + strings.TrimPrefix(u, "https://")
+	case strings.HasPrefix(u, "http://"):
+		u = "ws://" + strings.TrimPrefix(u, "http://")
+	}
+	return u + RealtimePath
+}
@@ -0,0 +1,208 @@
+package protocol
+
+// MessageType リアルタイム通信のメッセージの種類
+type MessageType string
+
+const (
+	TypeHello    MessageType = "hello"
+	TypeWelcome  MessageType = "welcome"
+	TypeInput    MessageType = "input"
+	TypeSnapshot MessageType = "snapshot"
+	// TypeSnapshotAck バイナリスナップショット(EntitySnapshot)の受信確認
+	TypeSnapshotAck MessageType = "snapshotAck"
+	TypeRespawn     MessageType = "respawn"
+	TypePause       MessageType = "pause"
+	TypeRanking     MessageType = "ranking"
+	TypeDeath       MessageType = "death"
+	TypeRunResult   MessageType = "runResult"
+	TypeError       MessageType = "error"
+)
+
+// Message リアルタイム通信でやり取りするメッセージ
+type Message interface {
+	MessageType() MessageType
+}
+
+// Position 画面上の座標 (左上が原点、単位はピクセル)
+type Position struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// Velocity 速度(ピクセル/秒)
+type Velocity struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// Movement プレイヤーの動き方の調整値。サーバーの設定で決まり、クライアントは Welcome で受け取って同じ値で予測する
+type Movement struct {
+	// Acceleration キーを押している方向への加速度(ピクセル/秒²)
+	Acceleration float64 `json:"acceleration"`
+	// Friction 常に速さを0に近づける減速度(ピクセル/秒²)。Acceleration より小さくないと動き出せない
+	Friction float64 `json:"friction"`
+	// MaxSpeed 速さの上限(ピクセル/秒)
+	MaxSpeed float64 `json:"maxSpeed"`
+}
+
+// PlayerInfo 部屋にいるプレイヤー1人分の情報
+type PlayerInfo struct {
+	ID       uint32   `json:"id"`
+	Name     string   `json:"name"`
+	Position Position `json:"position"`
+	// NPC サーバーが動かしているキャラクターかどうか
+	NPC bool `json:"npc,omitempty"`
+	// Appearance プレイヤーの色とスキン。NPCでは空
+	Appearance Appearance `json:"appearance,omitempty"`
+}
+
+// Hello クライアント → サーバー: 接続直後に送る
+type Hello struct {
+	Version int    `json:"version"`
+	Token   string `json:"token"`
+	// Room 入る部屋の名前。空なら空きのある部屋に入る。ValidRoomName を満たさなければ断られる
+	Room string `json:"room,omitempty"`
+	// Resume 切断前の Welcome.ResumeToken。指定すると同じ部屋の同じプレイヤーとして続きから再開する
+	Resume string `json:"resume,omitempty"`
+}
+
+// MaxRoomNameLength Hello.Room の最大の長さ
+const MaxRoomNameLength = 32
+
+// ValidRoomName クライアントが指定できる部屋の名前か。英数字と - _ だけで MaxRoomNameLength 文字まで
+func ValidRoomName(name string) bool {
+	if name == "" || len(name) > MaxRoomNameLength {
+		return false
+	}
+	for _, c := range name {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9', c == '-', c == '_':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Welcome サーバー → クライアント: Helloを受け付けたときに返す
+type Welcome struct {
+	Version  int    `json:"version"`
+	PlayerID uint32 `json:"playerId"`
+	Room     string `json:"room"`
+	TickRate int    `json:"tickRate"`
+	// ResumeToken 切断されたときに Hello.Resume に指定する。再開するたびに新しいものが発行される
+	ResumeToken string `json:"resumeToken,omitempty"`
+	// ResumeGraceMillis 切断されてから再開できるまでの猶予(ミリ秒)。0なら再開できない
+	ResumeGraceMillis int64 `json:"resumeGraceMillis,omitempty"`
+	// Resumed 切断前のプレイヤーの続きから再開したか。falseなら新しく参加した
+	Resumed bool `json:"resumed,omitempty"`
+	// IdleTimeoutMillis これだけの時間動かないとアウトになる(ミリ秒)。0なら判定しない
+	IdleTimeoutMillis int64 `json:"idleTimeoutMillis,omitempty"`
+	// MaxPauseMillis ポーズ中に放置と衝突の判定から外れていられる時間(ミリ秒)。1回のプレイでの合計。0ならポーズしても守られない
+	MaxPauseMillis int64 `json:"maxPauseMillis,omitempty"`
+	// Movement この部屋での動き方。クライアントの予測もこれで計算する
+	Movement Movement `json:"movement"`
+}
+
+// Input クライアント → サーバー: 1フレーム分の入力
+// キーを押している間と、離してから止まるまでの間は毎フレーム送る。1つの Input で sim.FrameDuration だけ進む
+// サーバーは実際に経った時間の分(と少しの余裕)しか進めないので、それより速く送った分は捨てられる
+type Input struct {
+	Seq   uint32 `json:"seq"`
+	Up    bool   `json:"up,omitempty"`
+	Down  bool   `json:"down,omitempty"`
+	Left  bool   `json:"left,omitempty"`
+	Right bool   `json:"right,omitempty"`
+	// ViewTick 入力したときに他のプレイヤーとNPCを描画していたtick
+	// サーバーはこの時点まで巻き戻して当たり判定を行う(ラグ補償)
+	ViewTick uint32 `json:"viewTick,omitempty"`
+}
+
+// IsEmpty どのキーも押されていないか
+func (in *Input) IsEmpty() bool {
+	return !in.Up && !in.Down && !in.Left && !in.Right
+}
+
+// Respawn クライアント → サーバー: アウトになった後、もう一度プレイする
+type Respawn struct{}
+
+// Pause クライアント → サーバー: ポーズメニューを開いた・閉じた
+// ポーズ中は MaxPause まで放置と衝突の判定から外れ、生存時間も進まない
+// ポーズできる時間を使い切ったときと、何かにぶつかる直前はポーズを断られる。自分が EntityPaused になったかで分かる
+type Pause struct {
+	Paused bool `json:"paused"`
+}
+
+// Snapshot サーバー → クライアント: あるtickでの部屋の状態
+// 名前などを含むのでプレイヤーの出入りのときだけ送る。毎tickの位置は EntitySnapshot で送る
+type Snapshot struct {
+	Tick    uint32       `json:"tick"`
+	Players []PlayerInfo `json:"players"`
+}
+
+// SnapshotAck クライアント → サーバー: バイナリスナップショットを受信した
+// サーバーは最後に受信確認されたスナップショットとの差分を送ってくる
+type SnapshotAck struct {
+	Seq uint32 `json:"seq"`
+}
+
+// RankingEntry 部屋内ランキングの1件分
+type RankingEntry struct {
+	PlayerID uint32 `json:"playerId"`
+	Name     string `json:"name"`
+	// SurvivalMillis 今回の生存時間(ミリ秒)。アウトになったプレイヤーはそのときの生存時間
+	SurvivalMillis int64 `json:"survivalMillis"`
+	// Alive 生きていれば、次の Ranking までの間もクライアントが生存時間を進めてよい
+	Alive bool `json:"alive,omitempty"`
+}
+
+// Ranking サーバー → クライアント: 部屋内の生存時間ランキング。生存時間の降順で定期的に送る
+type Ranking struct {
+	Entries []RankingEntry `json:"entries"`
+}
+
+// 死因 (Death.Cause)
+const (
+	CauseWall   = "wall"
+	CauseNPC    = "npc"
+	CausePlayer = "player"
+	// CauseIdle 一定時間動かなかった
+	CauseIdle = "idle"
+)
+
+// Death サーバー → クライアント: プレイヤーがアウトになった
+type Death struct {
+	PlayerID uint32 `json:"playerId"`
+	Cause    string `json:"cause"`
+}
+
+// RunResult サーバー → クライアント: アウトになったプレイの結果を保存した後に、本人にだけ送る
+type RunResult struct {
+	SurvivalMillis int64 `json:"survivalMillis"`
+	// HighScoreMillis 今回を含めた自己ベスト
+	HighScoreMillis int64 `json:"highScoreMillis"`
+	// NewBest 今回で自己ベストを更新したか
+	NewBest bool `json:"newBest,omitempty"`
+	// GlobalRank 自己ベストでの全ユーザー中の順位(1始まり)
+	GlobalRank int `json:"globalRank"`
+	// TotalPlayers 全ユーザー数
+	TotalPlayers int `json:"totalPlayers"`
+}
+
+// Error サーバー → クライアント: 処理できなかったメッセージへの応答
+type Error struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (*Hello) MessageType() MessageType       { return TypeHello }
+func (*Welcome) MessageType() MessageType     { return TypeWelcome }
+func (*Input) MessageType() MessageType       { return TypeInput }
+func (*Snapshot) MessageType() MessageType    { return TypeSnapshot }
+func (*SnapshotAck) MessageType() MessageType { return TypeSnapshotAck }
+func (*Respawn) MessageType() MessageType     { return TypeRespawn }
+func (*Pause) MessageType() MessageType       { return TypePause }
+func (*Ranking) MessageType() MessageType     { return TypeRanking }
+func (*Death) MessageType() MessageType       { return TypeDeath }
+func (*RunResult) MessageType() MessageType   { return TypeRunResult }
+func (*Error) MessageType() MessageType       { return TypeError }
@@ -0,0 +1,60 @@
+package protocol
+
+// UserCreateRequest POST /user/create
+type UserCreateRequest struct {
+	Name string `json:"name"`
+}
+
+type UserCreateResponse struct {
+	Token string `json:"token"`
+}
+
+// UserGetRequest POST /user/get
+type UserGetRequest struct {
+	Token string `json:"auth_token"`
+}
+
+type UserGetResponse struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+	// HighScore 最長の生存時間(ミリ秒)
+	HighScore  int        `json:"highScore"`
+	Appearance Appearance `json:"appearance"`
+	// Achievements 解除済みの実績
+	Achievements []string `json:"achievements"`
+	// UnlockedColors UnlockedSkins 今使える色とスキンのID
+	UnlockedColors []string `json:"unlockedColors"`
+	UnlockedSkins  []string `json:"unlockedSkins"`
+}
+
+// UserAppearanceRequest PUT /user/appearance 空のフィールドは変更しない
+// レスポンスは変更後の UserGetResponse
+type UserAppearanceRequest = Appearance
+
+// UserRankingResponse GET /users/get の1件分
+type UserRankingResponse struct {
+	Name string `json:"name"`
+	// HighScore 最長の生存時間(ミリ秒)
+	HighScore int `json:"highScore"`
+}
+
+// HealthResponse GET /healthz サーバーが動いているか。クライアントのサーバー一覧で応答時間を測るのにも使う
+type HealthResponse struct {
+	// Status 動いていれば "ok"
+	Status string `json:"status"`
+	// Version, MinSupportedVersion サーバーが受け付けるリアルタイム通信のプロトコルバージョンの範囲
+	Version             int `json:"version"`
+	MinSupportedVersion int `json:"minSupportedVersion"`
+	// Players 接続しているプレイヤーの数
+	Players int `json:"players"`
+}
+
+// ServerStatsResponse GET /stats リアルタイム通信の負荷の状況
+type ServerStatsResponse struct {
+	Rooms   int `json:"rooms"`
+	Players int `json:"players"`
+	// Ticks 起動してから全部屋で実行したtickの合計
+	Ticks uint64 `json:"ticks"`
+	// TickOverruns 次のtickの時刻までに処理が終わらなかったtickの数
+	TickOverruns uint64 `json:"tickOverruns"`
+}
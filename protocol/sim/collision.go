@@ -0,0 +1,304 @@
+package sim
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"image"
+	_ "image/png"
+	"math"
+	"slices"
+
+	"github.com/eiei114/dinosaur-jump/protocol"
+)
+
+// 当たり判定
+//
+// エンティティごとに形(Shape)を持たせ、Grid で近くにあるものだけに絞り込んでから形どうしを比べる。
+// 形は AABB・円・スプライトの不透明な部分から作る Mask の3種類で、どの組み合わせでも Overlap で比べられる。
+
+// PlayerSprite プレイヤーとNPCの画像。クライアントはこれを描き、当たり判定の形もここから作る
+//
+//go:embed sprites/player.png
+var PlayerSprite []byte
+
+const (
+	// MaskAlphaThreshold Mask でこれ以上の不透明度のピクセルを当たる部分にする
+	MaskAlphaThreshold = 0x80
+
+	// GridCellSize Grid の1マスの大きさ。プレイヤーより少し大きくしておく
+	GridCellSize = 64
+)
+
+var (
+	// PlayerHitbox プレイヤーの当たり判定。スプライトの不透明な部分そのもの
+	PlayerHitbox Shape = mustSpriteMask(PlayerSprite)
+	// NPCHitbox NPCの当たり判定。スプライトより小さい円にして、かすっただけではアウトにならないようにする
+	NPCHitbox Shape = Circle{X: PlayerWidth / 2, Y: PlayerHeight / 2, R: NPCHitboxRadius}
+)
+
+// Shape 当たり判定の形。座標はエンティティの位置(スプライトの左上)からの相対
+type Shape interface {
+	// Bounds pos に置いたときに形を囲む矩形
+	Bounds(pos protocol.Position) Rect
+	// overlapsRect pos に置いたときに r と重なるか
+	overlapsRect(pos protocol.Position, r Rect) bool
+}
+
+// AABB 軸に沿った矩形
+type AABB struct {
+	X, Y, W, H float64
+}
+
+func (a AABB) Bounds(pos protocol.Position) Rect {
+	return Rect{X1: pos.X + a.X, Y1: pos.Y + a.Y, X2: pos.X + a.X + a.W, Y2: pos.Y + a.Y + a.H}
+}
+
+func (a AABB) overlapsRect(pos protocol.Position, r Rect) bool {
+	return a.Bounds(pos).Overlaps(r)
+}
+
+// Circle 中心が (X, Y) で半径 R の円
+type Circle struct {
+	X, Y, R float64
+}
+
+func (c Circle) Bounds(pos protocol.Position) Rect {
+	x, y := pos.X+c.X, pos.Y+c.Y
+	return Rect{X1: x - c.R, Y1: y - c.R, X2: x + c.R, Y2: y + c.R}
+}
+
+func (c Circle) overlapsRect(pos protocol.Position, r Rect) bool {
+	x, y := pos.X+c.X, pos.Y+c.Y
+	dx := x - clamp(x, r.X1, r.X2)
+	dy := y - clamp(y, r.Y1, r.Y2)
+	return dx*dx+dy*dy < c.R*c.R
+}
+
+// Mask ピクセル単位の形。1ピクセルが1x1の正方形になる
+type Mask struct {
+	W, H  int
+	solid []bool
+}
+
+// NewMask img の不透明度が MaskAlphaThreshold 以上のピクセルを当たる部分にする
+func NewMask(img image.Image) *Mask {
+	b := img.Bounds()
+	m := &Mask{W: b.Dx(), H: b.Dy(), solid: make([]bool, b.Dx()*b.Dy())}
+	for y := 0; y < m.H; y++ {
+		for x := 0; x < m.W; x++ {
+			_, _, _, a := img.At(b.Min.X+x, b.Min.Y+y).RGBA()
+			m.solid[y*m.W+x] = a>>8 >= MaskAlphaThreshold
+		}
+	}
+	return m
+}
+
+// mustSpriteMask スプライトの画像から Mask を作る。大きさが PlayerWidth x PlayerHeight でなければ panic する
+func mustSpriteMask(data []byte) *Mask {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		panic(fmt.Sprintf("sim: decode sprite: %v", err))
+	}
+	m := NewMask(img)
+	if m.W != PlayerWidth || m.H != PlayerHeight {
+		panic(fmt.Sprintf("sim: sprite is %dx%d, want %dx%d", m.W, m.H, PlayerWidth, PlayerHeight))
+	}
+	return m
+}
+
+// Solid (x, y) のピクセルが当たる部分か。範囲外はfalse
+func (m *Mask) Solid(x, y int) bool {
+	return x >= 0 && x < m.W && y >= 0 && y < m.H && m.solid[y*m.W+x]
+}
+
+func (m *Mask) Bounds(pos protocol.Position) Rect {
+	return Rect{X1: pos.X, Y1: pos.Y, X2: pos.X + float64(m.W), Y2: pos.Y + float64(m.H)}
+}
+
+func (m *Mask) overlapsRect(pos protocol.Position, r Rect) bool {
+	found := false
+	m.eachSolid(pos, r, func(Rect) bool {
+		found = true
+		return false
+	})
+	return found
+}
+
+// eachSolid r と重なる当たる部分のピクセルの矩形を順に f に渡す。f がfalseを返したら止める
+func (m *Mask) eachSolid(pos protocol.Position, r Rect, f func(Rect) bool) {
+	x0 := max(int(math.Floor(r.X1-pos.X)), 0)
+	y0 := max(int(math.Floor(r.Y1-pos.Y)), 0)
+	x1 := min(int(math.Ceil(r.X2-pos.X)), m.W)
+	y1 := min(int(math.Ceil(r.Y2-pos.Y)), m.H)
+	for y := y0; y < y1; y++ {
+		for x := x0; x < x1; x++ {
+			if !m.solid[y*m.W+x] {
+				continue
+			}
+			px := Rect{X1: pos.X + float64(x), Y1: pos.Y + float64(y), X2: pos.X + float64(x+1), Y2: pos.Y + float64(y+1)}
+			if px.Overlaps(r) && !f(px) {
+				return
+			}
+		}
+	}
+}
+
+// Overlap apos に置いた a と bpos に置いた b が重なっているか
+// 形の組み合わせで比べ方が分からなければ、Bounds が重なっていれば重なっているとみなす
+func Overlap(a Shape, apos protocol.Position, b Shape, bpos protocol.Position) bool {
+	a, b = shapeValue(a), shapeValue(b)
+	ab, bb := a.Bounds(apos), b.Bounds(bpos)
+	if !ab.Overlaps(bb) {
+		return false
+	}
+	// Mask は重なっている範囲のピクセルごとに相手と比べる。AABB は Bounds そのものなので相手の形と比べる
+	switch a := a.(type) {
+	case *Mask:
+		return maskOverlap(a, apos, b, bpos, bb)
+	case AABB:
+		return b.overlapsRect(bpos, ab)
+	}
+	switch b := b.(type) {
+	case *Mask:
+		return maskOverlap(b, bpos, a, apos, ab)
+	case AABB:
+		return a.overlapsRect(apos, bb)
+	}
+	if ac, ok := a.(Circle); ok {
+		if bc, ok := b.(Circle); ok {
+			dx := (apos.X + ac.X) - (bpos.X + bc.X)
+			dy := (apos.Y + ac.Y) - (bpos.Y + bc.Y)
+			r := ac.R + bc.R
+			return dx*dx+dy*dy < r*r
+		}
+	}
+	return true
+}
+
+// shapeValue *AABB と *Circle を値にして、Overlap で値と同じように扱えるようにする
+func shapeValue(s Shape) Shape {
+	switch s := s.(type) {
+	case *AABB:
+		return *s
+	case *Circle:
+		return *s
+	}
+	return s
+}
+
+func maskOverlap(m *Mask, mpos protocol.Position, o Shape, opos protocol.Position, obounds Rect) bool {
+	found := false
+	m.eachSolid(mpos, obounds, func(px Rect) bool {
+		found = o.overlapsRect(opos, px)
+		return !found
+	})
+	return found
+}
+
+// Collider 当たり判定を持つもの
+type Collider struct {
+	// ID 同じIDどうしは当たらない。壁など区別しなくてよいものは0
+	ID    uint32
+	Pos   protocol.Position
+	Shape Shape
+	// Cause これにぶつかったときの死因 (protocol.CauseWall など)
+	Cause string
+}
+
+// Bounds 今の位置での形を囲む矩形
+func (c *Collider) Bounds() Rect {
+	return c.Shape.Bounds(c.Pos)
+}
+
+// Event 衝突。Other にぶつかったことを表す
+type Event struct {
+	Other *Collider
+	Cause string
+}
+
+// Grid 当たり判定の候補を絞り込むための格子
+// Collider を入れておき、Collisions で近くのマスにあるものとだけ形を比べる
+type Grid struct {
+	cellSize  float64
+	colliders []*Collider
+	cells     map[[2]int][]int
+}
+
+// NewGrid 1マスが cellSize の格子を作る
+func NewGrid(cellSize float64) *Grid {
+	return &Grid{cellSize: cellSize, cells: make(map[[2]int][]int)}
+}
+
+// Reset 入れたものをすべて取り除く。毎フレーム作り直すときに使う
+func (g *Grid) Reset() {
+	g.colliders = g.colliders[:0]
+	clear(g.cells)
+}
+
+// Insert c を重なっているマスすべてに入れる
+func (g *Grid) Insert(c Collider) {
+	i := len(g.colliders)
+	g.colliders = append(g.colliders, &c)
+	g.eachCell(c.Bounds(), func(cell [2]int) {
+		g.cells[cell] = append(g.cells[cell], i)
+	})
+}
+
+// Collisions c とぶつかっているものを、入れた順に返す
+// 同じIDのものは除く。先に入れたものほど優先する死因にしておけば、先頭が死因になる
+func (g *Grid) Collisions(c Collider) []Event {
+	var candidates []int
+	g.eachCell(c.Bounds(), func(cell [2]int) {
+		candidates = append(candidates, g.cells[cell]...)
+	})
+	slices.Sort(candidates)
+	candidates = slices.Compact(candidates)
+
+	var events []Event
+	for _, i := range candidates {
+		o := g.colliders[i]
+		if c.ID != 0 && o.ID == c.ID {
+			continue
+		}
+		if Overlap(c.Shape, c.Pos, o.Shape, o.Pos) {
+			events = append(events, Event{Other: o, Cause: o.Cause})
+		}
+	}
+	return events
+}
+
+func (g *Grid) eachCell(r Rect, f func([2]int)) {
+	x0, y0 := int(math.Floor(r.X1/g.cellSize)), int(math.Floor(r.Y1/g.cellSize))
+	x1, y1 := int(math.Floor(r.X2/g.cellSize)), int(math.Floor(r.Y2/g.cellSize))
+	for y := y0; y <= y1; y++ {
+		for x := x0; x <= x1; x++ {
+			f([2]int{x, y})
+		}
+	}
+}
+
+// Arena 壁の内側。プレイヤーが動ける範囲
+func Arena() Rect {
+	return Rect{X1: WallThickness, Y1: WallThickness, X2: WorldWidth - WallThickness, Y2: WorldHeight - WallThickness}
+}
+
+// WallColliders inner を囲む厚さ WallThickness の四辺の壁
+func WallColliders(inner Rect) []Collider {
+	const t = WallThickness
+	walls := []Rect{
+		{X1: inner.X1 - t, Y1: inner.Y1 - t, X2: inner.X1, Y2: inner.Y2 + t}, // 左
+		{X1: inner.X2, Y1: inner.Y1 - t, X2: inner.X2 + t, Y2: inner.Y2 + t}, // 右
+		{X1: inner.X1, Y1: inner.Y1 - t, X2: inner.X2, Y2: inner.Y1},         // 上
+		{X1: inner.X1, Y1: inner.Y2, X2: inner.X2, Y2: inner.Y2 + t},         // 下
+	}
+	colliders := make([]Collider, len(walls))
+	for i, w := range walls {
+		colliders[i] = Collider{
+			Pos:   protocol.Position{X: w.X1, Y: w.Y1},
+			Shape: AABB{W: w.X2 - w.X1, H: w.Y2 - w.Y1},
+			Cause: protocol.CauseWall,
+		}
+	}
+	return colliders
+}
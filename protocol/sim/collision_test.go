@@ -0,0 +1,227 @@
+package sim
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/eiei114/dinosaur-jump/protocol"
+)
+
+// testMask w x h の Mask。solid が true を返すピクセルを当たる部分にする
+func testMask(w, h int, solid func(x, y int) bool) *Mask {
+	img := image.NewAlpha(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if solid(x, y) {
+				img.SetAlpha(x, y, color.Alpha{A: 0xff})
+			}
+		}
+	}
+	return NewMask(img)
+}
+
+// oddShape Overlap が比べ方を知らない形。Bounds だけで判定される
+type oddShape struct {
+	w, h float64
+}
+
+func (o oddShape) Bounds(pos protocol.Position) Rect {
+	return Rect{X1: pos.X, Y1: pos.Y, X2: pos.X + o.w, Y2: pos.Y + o.h}
+}
+
+func (o oddShape) overlapsRect(pos protocol.Position, r Rect) bool {
+	return o.Bounds(pos).Overlaps(r)
+}
+
+func at(x, y float64) protocol.Position {
+	return protocol.Position{X: x, Y: y}
+}
+
+func TestOverlap(t *testing.T) {
+	box := AABB{W: 10, H: 10}
+	small := AABB{W: 2, H: 2}
+	circle := Circle{R: 5}
+	dot := Circle{R: 2}
+	// 左半分(x < 5)だけが当たる 10x10 の Mask
+	half := testMask(10, 10, func(x, y int) bool { return x < 5 })
+
+	tests := []struct {
+		name string
+		a    Shape
+		apos protocol.Position
+		b    Shape
+		bpos protocol.Position
+		want bool
+	}{
+		{"AABB/AABB overlapping", box, at(0, 0), box, at(5, 5), true},
+		{"AABB/AABB touching", box, at(0, 0), box, at(10, 0), false},
+		{"AABB/AABB disjoint", box, at(0, 0), box, at(20, 20), false},
+
+		{"AABB/Circle overlapping", box, at(0, 0), circle, at(13, 5), true},
+		{"AABB/Circle touching", box, at(0, 0), circle, at(15, 5), false},
+		{"AABB/Circle near the corner", box, at(0, 0), circle, at(14, 14), false},
+		{"AABB/Circle disjoint", box, at(0, 0), circle, at(30, 30), false},
+
+		{"Circle/Circle overlapping", circle, at(0, 0), circle, at(9, 0), true},
+		{"Circle/Circle touching", circle, at(0, 0), circle, at(10, 0), false},
+		{"Circle/Circle disjoint", circle, at(0, 0), circle, at(7, 8), false},
+
+		{"Mask/AABB overlapping", half, at(0, 0), small, at(4, 4), true},
+		{"Mask/AABB touching", half, at(0, 0), small, at(5, 4), false},
+		{"Mask/AABB in the empty part", half, at(0, 0), small, at(7, 4), false},
+		{"Mask/AABB disjoint", half, at(0, 0), small, at(20, 20), false},
+
+		{"Mask/Circle overlapping", half, at(0, 0), dot, at(6, 5), true},
+		{"Mask/Circle touching", half, at(0, 0), dot, at(7, 5), false},
+		{"Mask/Circle disjoint", half, at(0, 0), dot, at(20, 20), false},
+
+		{"Mask/Mask overlapping", half, at(0, 0), half, at(4, 0), true},
+		{"Mask/Mask touching", half, at(0, 0), half, at(5, 0), false},
+		{"Mask/Mask touching from the left", half, at(0, 0), half, at(-5, 0), false},
+		{"Mask/Mask disjoint", half, at(0, 0), half, at(30, 0), false},
+
+		{"*AABB/*Circle overlapping", &box, at(0, 0), &circle, at(13, 5), true},
+		{"*AABB/*Circle touching", &box, at(0, 0), &circle, at(15, 5), false},
+		{"*Circle/Mask overlapping", &dot, at(6, 5), half, at(0, 0), true},
+		{"unknown/Circle by bounds", oddShape{w: 10, h: 10}, at(0, 0), circle, at(14, 14), true},
+		{"unknown/Circle disjoint", oddShape{w: 10, h: 10}, at(0, 0), circle, at(30, 30), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Overlap(tt.a, tt.apos, tt.b, tt.bpos); got != tt.want {
+				t.Errorf("Overlap(a, b) = %v, want %v", got, tt.want)
+			}
+			if got := Overlap(tt.b, tt.bpos, tt.a, tt.apos); got != tt.want {
+				t.Errorf("Overlap(b, a) = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGrid(t *testing.T) {
+	g := NewGrid(GridCellSize)
+	// マスの境目(64)をまたぐ
+	g.Insert(Collider{ID: 1, Pos: at(60, 60), Shape: AABB{W: 10, H: 10}, Cause: "first"})
+	g.Insert(Collider{ID: 2, Pos: at(62, 62), Shape: AABB{W: 10, H: 10}, Cause: "second"})
+	g.Insert(Collider{ID: 3, Pos: at(130, 130), Shape: AABB{W: 10, H: 10}, Cause: "far"})
+	// 負の座標のマス
+	g.Insert(Collider{ID: 4, Pos: at(-5, -5), Shape: AABB{W: 10, H: 10}, Cause: "negative"})
+
+	causes := func(events []Event) string {
+		var s []string
+		for _, e := range events {
+			s = append(s, e.Cause)
+		}
+		return strings.Join(s, ",")
+	}
+	tests := []struct {
+		name  string
+		query Collider
+		want  string
+	}{
+		{"from the right cell", Collider{Pos: at(68, 68), Shape: AABB{W: 4, H: 4}}, "first,second"},
+		{"from the left cell", Collider{Pos: at(59, 63), Shape: AABB{W: 4, H: 4}}, "first,second"},
+		{"from the upper cell", Collider{Pos: at(63, 50), Shape: AABB{W: 4, H: 11}}, "first"},
+		{"same ID is skipped", Collider{ID: 1, Pos: at(68, 68), Shape: AABB{W: 4, H: 4}}, "second"},
+		{"nothing nearby", Collider{Pos: at(300, 300), Shape: AABB{W: 4, H: 4}}, ""},
+		{"touching only", Collider{Pos: at(140, 130), Shape: AABB{W: 4, H: 4}}, ""},
+		{"negative coordinates", Collider{Pos: at(1, 1), Shape: AABB{W: 2, H: 2}}, "negative"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := causes(g.Collisions(tt.query)); got != tt.want {
+				t.Errorf("Collisions = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	g.Reset()
+	if events := g.Collisions(Collider{Pos: at(68, 68), Shape: AABB{W: 4, H: 4}}); len(events) != 0 {
+		t.Errorf("Collisions after Reset = %d events, want none", len(events))
+	}
+}
+
+func TestWallColliders(t *testing.T) {
+	inner := Arena()
+	walls := WallColliders(inner)
+	if len(walls) != 4 {
+		t.Fatalf("got %d walls, want 4", len(walls))
+	}
+	g := NewGrid(GridCellSize)
+	for _, w := range walls {
+		if w.Cause != protocol.CauseWall {
+			t.Errorf("wall cause = %q, want %q", w.Cause, protocol.CauseWall)
+		}
+		g.Insert(w)
+	}
+
+	player := AABB{W: PlayerWidth, H: PlayerHeight}
+	tests := []struct {
+		name string
+		pos  protocol.Position
+		hit  bool
+	}{
+		{"center", at((inner.X1+inner.X2)/2, (inner.Y1+inner.Y2)/2), false},
+		{"touching the top left", at(inner.X1, inner.Y1), false},
+		{"touching the bottom right", at(inner.X2-PlayerWidth, inner.Y2-PlayerHeight), false},
+		{"into the left wall", at(inner.X1-1, 300), true},
+		{"into the right wall", at(inner.X2-PlayerWidth+1, 300), true},
+		{"into the top wall", at(300, inner.Y1-1), true},
+		{"into the bottom wall", at(300, inner.Y2-PlayerHeight+1), true},
+		{"into a corner", at(inner.X1-PlayerWidth, inner.Y1-PlayerHeight), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events := g.Collisions(Collider{Pos: tt.pos, Shape: player})
+			if hit := len(events) > 0; hit != tt.hit {
+				t.Errorf("hit = %v, want %v", hit, tt.hit)
+			}
+		})
+	}
+}
+
+func TestPlayerHitbox(t *testing.T) {
+	m, ok := PlayerHitbox.(*Mask)
+	if !ok {
+		t.Fatalf("PlayerHitbox is %T, want *Mask", PlayerHitbox)
+	}
+	if m.W != PlayerWidth || m.H != PlayerHeight {
+		t.Errorf("PlayerHitbox is %dx%d, want %dx%d", m.W, m.H, PlayerWidth, PlayerHeight)
+	}
+
+	sprite := func(w, h int) []byte {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, image.NewAlpha(image.Rect(0, 0, w, h))); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"narrow", sprite(40, PlayerHeight), fmt.Sprintf("40x%d", PlayerHeight)},
+		{"tall", sprite(PlayerWidth, 64), fmt.Sprintf("%dx64", PlayerWidth)},
+		{"not an image", []byte("not a png"), "decode sprite"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				r := recover()
+				if r == nil || !strings.Contains(fmt.Sprint(r), tt.want) {
+					t.Errorf("panic = %v, want one mentioning %q", r, tt.want)
+				}
+			}()
+			mustSpriteMask(tt.data)
+		})
+	}
+	if m := mustSpriteMask(sprite(PlayerWidth, PlayerHeight)); m.W != PlayerWidth {
+		t.Errorf("a %dx%d sprite was rejected", PlayerWidth, PlayerHeight)
+	}
+}
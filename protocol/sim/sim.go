@@ -0,0 +1,145 @@
+// Package sim はクライアントとサーバーで共有するゲームのシミュレーション
+// サーバーが正として計算し、クライアントは同じ関数で自分の動きを予測する。
+// ここにない計算をどちらか片方だけで行うと予測がずれるので注意
+package sim
+
+import (
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/eiei114/dinosaur-jump/protocol"
+)
+
+const (
+	WorldWidth  = 640
+	WorldHeight = 640
+
+	// PlayerWidth PlayerHeight プレイヤーとNPCのスプライト(PlayerSprite)の大きさ
+	PlayerWidth  = 50
+	PlayerHeight = 50
+
+	// WallThickness 画面の四辺にある壁の厚さ
+	WallThickness = 50
+
+	// FrameDuration 1つの Input で進める時間。クライアントの1フレーム(60FPS)
+	FrameDuration = time.Second / 60
+
+	// NPCHitboxRadius NPCの当たり判定(NPCHitbox)の円の半径
+	NPCHitboxRadius = 15
+
+	// NPCSpeed 60FPSで1フレームあたりにNPCが動く距離
+	NPCSpeed = 5.0
+
+	// DefaultIdleTimeout これだけの時間動かなかったプレイヤーはアウトになる
+	DefaultIdleTimeout = 5 * time.Second
+)
+
+// DefaultMovement サーバーの設定がないときの動き方
+// 最高速度はNPCと同じで、0.2秒ほどで最高速度に達し、離すと0.25秒ほどで止まる
+func DefaultMovement() protocol.Movement {
+	return protocol.Movement{Acceleration: 2700, Friction: 1200, MaxSpeed: NPCSpeed * 60}
+}
+
+// Body 入力で動くプレイヤーの位置と速度
+type Body struct {
+	Pos protocol.Position
+	Vel protocol.Velocity
+}
+
+// Moving 止まっていないか。止まるまでは何も押していなくても Input を送り続ける
+func (b Body) Moving() bool {
+	return b.Vel != protocol.Velocity{}
+}
+
+// Step 1フレーム分(FrameDuration)の入力で速度と位置を進める
+// 押している方向に加速し、常に摩擦で減速して、速さは MaxSpeed までに抑える。斜めでも速くはならない
+func Step(b Body, in *protocol.Input, m protocol.Movement) Body {
+	dt := FrameDuration.Seconds()
+
+	var dx, dy float64
+	if in.Up {
+		dy--
+	}
+	if in.Down {
+		dy++
+	}
+	if in.Left {
+		dx--
+	}
+	if in.Right {
+		dx++
+	}
+	if l := math.Hypot(dx, dy); l > 0 {
+		b.Vel.X += dx / l * m.Acceleration * dt
+		b.Vel.Y += dy / l * m.Acceleration * dt
+	}
+
+	speed := math.Hypot(b.Vel.X, b.Vel.Y)
+	if next := min(speed-m.Friction*dt, m.MaxSpeed); next > 0 {
+		b.Vel.X *= next / speed
+		b.Vel.Y *= next / speed
+	} else {
+		b.Vel = protocol.Velocity{}
+	}
+
+	b.Pos.X += b.Vel.X * dt
+	b.Pos.Y += b.Vel.Y * dt
+	return b
+}
+
+// Rect 当たり判定用の矩形 (X1,Y1 が左上、X2,Y2 が右下)
+type Rect struct {
+	X1, Y1, X2, Y2 float64
+}
+
+// Overlaps 2つの矩形が重なっているか
+func (r Rect) Overlaps(o Rect) bool {
+	return r.X1 < o.X2 && r.X2 > o.X1 && r.Y1 < o.Y2 && r.Y2 > o.Y1
+}
+
+// MoveNPC NPCをランダムな方向に amount だけ動かし、画面内に収める
+func MoveNPC(pos protocol.Position, rnd *rand.Rand, amount float64) protocol.Position {
+	switch rnd.Intn(4) { // 0:上, 1:下, 2:左, 3:右
+	case 0:
+		pos.Y -= amount
+	case 1:
+		pos.Y += amount
+	case 2:
+		pos.X -= amount
+	case 3:
+		pos.X += amount
+	}
+
+	// NPCがスクリーンから出ないようにする
+	pos.X = clamp(pos.X, 0, WorldWidth-PlayerWidth)
+	pos.Y = clamp(pos.Y, 0, WorldHeight-PlayerHeight)
+	return pos
+}
+
+// SpawnPosition PlayerHitbox が occupied に入っているどれにも当たらない出現位置を探す
+// 見つからなければ最後に試した位置を返す
+func SpawnPosition(rnd *rand.Rand, occupied *Grid) protocol.Position {
+	const attempts = 32
+	var pos protocol.Position
+	for i := 0; i < attempts; i++ {
+		pos = protocol.Position{
+			X: float64(WallThickness + rnd.Intn(WorldWidth-2*WallThickness-PlayerWidth+1)),
+			Y: float64(WallThickness + rnd.Intn(WorldHeight-2*WallThickness-PlayerHeight+1)),
+		}
+		if len(occupied.Collisions(Collider{Pos: pos, Shape: PlayerHitbox})) == 0 {
+			return pos
+		}
+	}
+	return pos
+}
+
+func clamp(v, lo, hi float64) float64 {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
@@ -0,0 +1,162 @@
+package sim
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/eiei114/dinosaur-jump/protocol"
+)
+
+func speed(b Body) float64 {
+	return math.Hypot(b.Vel.X, b.Vel.Y)
+}
+
+func TestStepAcceleratesToMaxSpeed(t *testing.T) {
+	m := DefaultMovement()
+	perFrame := (m.Acceleration - m.Friction) * FrameDuration.Seconds()
+	in := &protocol.Input{Right: true}
+
+	var b Body
+	for i := 1; i <= 60; i++ {
+		prev := b
+		b = Step(b, in, m)
+		want := math.Min(float64(i)*perFrame, m.MaxSpeed)
+		if math.Abs(speed(b)-want) > 1e-9 {
+			t.Fatalf("frame %d: speed = %v, want %v", i, speed(b), want)
+		}
+		if b.Vel.Y != 0 || b.Pos.Y != 0 {
+			t.Fatalf("frame %d: moved off the x axis: %+v", i, b)
+		}
+		if b.Pos.X <= prev.Pos.X {
+			t.Fatalf("frame %d: did not move right: %v -> %v", i, prev.Pos.X, b.Pos.X)
+		}
+	}
+	if speed(b) != m.MaxSpeed {
+		t.Errorf("speed after a second = %v, want exactly MaxSpeed %v", speed(b), m.MaxSpeed)
+	}
+}
+
+func TestStepFrictionStopsExactly(t *testing.T) {
+	m := DefaultMovement()
+	b := Body{Pos: protocol.Position{X: 300, Y: 300}, Vel: protocol.Velocity{X: m.MaxSpeed * 0.6, Y: -m.MaxSpeed * 0.8}}
+	frames := int(math.Ceil(m.MaxSpeed / (m.Friction * FrameDuration.Seconds())))
+
+	var in protocol.Input
+	for i := 1; i <= frames; i++ {
+		before := speed(b)
+		b = Step(b, &in, m)
+		if speed(b) >= before {
+			t.Fatalf("frame %d: speed did not decrease: %v -> %v", i, before, speed(b))
+		}
+	}
+	if b.Vel != (protocol.Velocity{}) || b.Moving() {
+		t.Fatalf("velocity after %d frames = %+v, want exactly zero", frames, b.Vel)
+	}
+	// 止まったらそれ以上動かない
+	stopped := b
+	for i := 0; i < 10; i++ {
+		b = Step(b, &in, m)
+	}
+	if b != stopped {
+		t.Errorf("a stopped body moved: %+v -> %+v", stopped, b)
+	}
+}
+
+func TestStepDiagonal(t *testing.T) {
+	m := DefaultMovement()
+	straight := Step(Body{}, &protocol.Input{Right: true}, m)
+	diagonal := Step(Body{}, &protocol.Input{Up: true, Right: true}, m)
+	if math.Abs(speed(diagonal)-speed(straight)) > 1e-9 {
+		t.Errorf("diagonal speed after one frame = %v, want %v", speed(diagonal), speed(straight))
+	}
+	if math.Abs(diagonal.Vel.X+diagonal.Vel.Y) > 1e-9 || diagonal.Vel.X <= 0 {
+		t.Errorf("diagonal velocity = %+v, want up and right equally", diagonal.Vel)
+	}
+
+	b := Body{}
+	for i := 0; i < 120; i++ {
+		b = Step(b, &protocol.Input{Down: true, Left: true}, m)
+	}
+	if math.Abs(speed(b)-m.MaxSpeed) > 1e-9 {
+		t.Errorf("diagonal top speed = %v, want MaxSpeed %v", speed(b), m.MaxSpeed)
+	}
+
+	// 反対向きのキーは打ち消し合う
+	if b := Step(Body{}, &protocol.Input{Left: true, Right: true}, m); b.Moving() {
+		t.Errorf("left and right together moved: %+v", b)
+	}
+}
+
+func TestStepDeterministic(t *testing.T) {
+	m := DefaultMovement()
+	rnd := rand.New(rand.NewSource(1))
+	inputs := make([]protocol.Input, 600)
+	for i := range inputs {
+		inputs[i] = protocol.Input{Seq: uint32(i + 1), Up: rnd.Intn(3) == 0, Down: rnd.Intn(3) == 0, Left: rnd.Intn(3) == 0, Right: rnd.Intn(3) == 0}
+	}
+	run := func(b Body, inputs []protocol.Input) Body {
+		for i := range inputs {
+			b = Step(b, &inputs[i], m)
+		}
+		return b
+	}
+
+	start := Body{Pos: protocol.Position{X: 300, Y: 300}}
+	first := run(start, inputs)
+	if second := run(start, inputs); second != first {
+		t.Fatalf("same inputs gave different states: %+v and %+v", first, second)
+	}
+	// 突き合わせでは途中の状態から残りの入力をやり直す。一度に進めたときと同じ結果になる
+	mid := run(start, inputs[:250])
+	if replayed := run(mid, inputs[250:]); replayed != first {
+		t.Errorf("replaying from the middle gave %+v, want %+v", replayed, first)
+	}
+}
+
+func TestMoveNPCStaysInWorld(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	corners := []protocol.Position{
+		{X: 0, Y: 0},
+		{X: WorldWidth - PlayerWidth, Y: 0},
+		{X: 0, Y: WorldHeight - PlayerHeight},
+		{X: WorldWidth - PlayerWidth, Y: WorldHeight - PlayerHeight},
+	}
+	for _, pos := range corners {
+		for i := 0; i < 200; i++ {
+			next := MoveNPC(pos, rnd, NPCSpeed*3)
+			if next.X < 0 || next.X > WorldWidth-PlayerWidth || next.Y < 0 || next.Y > WorldHeight-PlayerHeight {
+				t.Fatalf("MoveNPC(%+v) = %+v, outside the world", pos, next)
+			}
+			if moved := math.Abs(next.X-pos.X) + math.Abs(next.Y-pos.Y); moved > NPCSpeed*3 {
+				t.Fatalf("MoveNPC(%+v) moved %v, more than the amount", pos, moved)
+			}
+			pos = next
+		}
+	}
+
+	// 端でなければちょうど amount だけ動く
+	center := protocol.Position{X: 300, Y: 300}
+	next := MoveNPC(center, rnd, NPCSpeed)
+	if moved := math.Abs(next.X-center.X) + math.Abs(next.Y-center.Y); moved != NPCSpeed {
+		t.Errorf("MoveNPC from the center moved %v, want %v", moved, NPCSpeed)
+	}
+}
+
+func TestSpawnPosition(t *testing.T) {
+	arena := Arena()
+	// 左の3分の1をふさいでおく
+	occupied := NewGrid(GridCellSize)
+	occupied.Insert(Collider{Pos: protocol.Position{X: arena.X1, Y: arena.Y1}, Shape: AABB{W: (arena.X2 - arena.X1) / 3, H: arena.Y2 - arena.Y1}})
+
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 200; i++ {
+		pos := SpawnPosition(rnd, occupied)
+		if pos.X < arena.X1 || pos.X+PlayerWidth > arena.X2 || pos.Y < arena.Y1 || pos.Y+PlayerHeight > arena.Y2 {
+			t.Fatalf("spawned at %+v, outside the arena %+v", pos, arena)
+		}
+		if events := occupied.Collisions(Collider{Pos: pos, Shape: PlayerHitbox}); len(events) > 0 {
+			t.Fatalf("spawned at %+v, on top of an occupied area", pos)
+		}
+	}
+}
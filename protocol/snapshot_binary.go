@@ -0,0 +1,465 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// 位置同期用のバイナリスナップショット
+//
+// JSONの Snapshot は毎tick全員分の名前と座標を送るので人数が増えると重い。
+// こちらは座標を固定小数点に量子化し、クライアントが受信確認(SnapshotAck)した
+// 最後のスナップショットとの差分だけを送る。
+//
+// フォーマット (整数はすべてvarint、符号付きはzigzag):
+//
+//	magic(1) version(1) kind(1)
+//	seq baseSeq(kind=delta のときだけ) tick lastInput velocityX velocityY
+//	更新エンティティ数 { id mask [x] [y] [flags] }...
+//	削除エンティティ数 { id }...
+//
+// full の場合 x, y は量子化した絶対値、delta の場合は基準スナップショットからの差分。
+// 基準に存在しないエンティティは差分の基準を0として全項目を送る。
+// velocity は受信側のプレイヤーの速度で、差分にせず毎回量子化した絶対値を送る。
+
+const (
+	snapshotMagic   = 'S'
+	snapshotVersion = 3
+
+	snapshotFull  = 0
+	snapshotDelta = 1
+
+	// PositionScale 座標の量子化の細かさ。1/16ピクセル単位で送る
+	PositionScale = 16
+
+	// MaxSnapshotEntities 1スナップショットに含められるエンティティ数の上限
+	MaxSnapshotEntities = 4096
+
+	// snapshotHistory 差分の基準として保持しておくスナップショットの数
+	snapshotHistory = 64
+)
+
+const (
+	fieldX = 1 << iota
+	fieldY
+	fieldFlags
+	fieldAll = fieldX | fieldY | fieldFlags
+)
+
+// EntityFlags エンティティの状態を表すビットフラグ
+type EntityFlags uint8
+
+const (
+	// EntityNPC サーバーが動かしているキャラクター
+	EntityNPC EntityFlags = 1 << iota
+	// EntityDead アウトになったプレイヤー
+	EntityDead
+	// EntityDisconnected 接続が切れて再接続を待っているプレイヤー。動かず、当たり判定もない
+	EntityDisconnected
+	// EntityPaused ポーズ中のプレイヤー。動かず、当たり判定もない
+	EntityPaused
+)
+
+// EntityState スナップショットに含まれるエンティティ1体分の状態
+type EntityState struct {
+	ID       uint32
+	Position Position
+	Flags    EntityFlags
+}
+
+// EntitySnapshot あるtickでの全エンティティの状態
+type EntitySnapshot struct {
+	// Seq 送信側が振る通し番号。SnapshotAckで送り返す
+	Seq  uint32
+	Tick uint32
+	// LastInput 受信側のプレイヤーについて、このスナップショットまでに処理した最後の Input.Seq
+	// クライアントはこれより後の入力を予測で再適用する
+	LastInput uint32
+	// Velocity 受信側のプレイヤーの、LastInput を処理した時点の速度
+	// クライアントは位置と合わせてここから入力をやり直す
+	Velocity Velocity
+	Entities []EntityState
+}
+
+var (
+	// ErrUnknownBaseline 差分の基準になるスナップショットを受信していない
+	// 受信確認を送らずにいれば送信側はフルスナップショットに戻る
+	ErrUnknownBaseline = errors.New("protocol: unknown snapshot baseline")
+	// ErrMalformedSnapshot バイト列がスナップショットとして解釈できない
+	ErrMalformedSnapshot = errors.New("protocol: malformed snapshot")
+	// ErrTooManyEntities エンティティが MaxSnapshotEntities を超えていてエンコードできない
+	// 受信側はこれを超えるスナップショットを不正として捨てるので、送る前に断る
+	ErrTooManyEntities = errors.New("protocol: too many snapshot entities")
+)
+
+// quantized 量子化済みのエンティティ状態。送信側と受信側で同じ値を基準として保持する
+type quantized struct {
+	x, y  int32
+	flags EntityFlags
+}
+
+type quantizedSnapshot struct {
+	seq      uint32
+	entities map[uint32]quantized
+}
+
+func quantize(v float64) int32 {
+	q := math.Round(v * PositionScale)
+	if q > math.MaxInt32 {
+		return math.MaxInt32
+	}
+	if q < math.MinInt32 {
+		return math.MinInt32
+	}
+	return int32(q)
+}
+
+func dequantize(q int32) float64 {
+	return float64(q) / PositionScale
+}
+
+// snapshotRing 直近のスナップショットをseqで引けるように保持するリングバッファ
+type snapshotRing struct {
+	buf [snapshotHistory]*quantizedSnapshot
+}
+
+func (r *snapshotRing) put(s *quantizedSnapshot) {
+	r.buf[s.seq%snapshotHistory] = s
+}
+
+func (r *snapshotRing) get(seq uint32) *quantizedSnapshot {
+	s := r.buf[seq%snapshotHistory]
+	if s == nil || s.seq != seq {
+		return nil
+	}
+	return s
+}
+
+// SnapshotEncoder 接続1本分のスナップショットのエンコーダー
+// 接続ごとに受信確認の状況が違うので、クライアントごとに1つ作る
+type SnapshotEncoder struct {
+	history snapshotRing
+	nextSeq uint32
+	acked   uint32
+	hasAck  bool
+}
+
+// Ack クライアントからseqのスナップショットの受信確認が来た
+func (e *SnapshotEncoder) Ack(seq uint32) {
+	// 古い受信確認が後から届いても基準を巻き戻さない
+	if e.hasAck && int32(seq-e.acked) <= 0 {
+		return
+	}
+	if e.history.get(seq) == nil {
+		return
+	}
+	e.acked = seq
+	e.hasAck = true
+}
+
+// Reset 受信確認をなかったことにし、次はフルスナップショットを送る
+func (e *SnapshotEncoder) Reset() {
+	e.hasAck = false
+}
+
+// Encode snap をエンコードし、振ったseqと一緒に返す。snap.Seq は無視してエンコーダーが振る
+// 受信確認済みのスナップショットが履歴に残っていればその差分、なければフルスナップショットになる
+// エンティティが MaxSnapshotEntities を超えていれば ErrTooManyEntities を返し、seqも履歴も進めない
+func (e *SnapshotEncoder) Encode(snap *EntitySnapshot) ([]byte, uint32, error) {
+	cur := &quantizedSnapshot{seq: e.nextSeq + 1, entities: make(map[uint32]quantized, len(snap.Entities))}
+	for _, ent := range snap.Entities {
+		cur.entities[ent.ID] = quantized{
+			x:     quantize(ent.Position.X),
+			y:     quantize(ent.Position.Y),
+			flags: ent.Flags,
+		}
+	}
+	if len(cur.entities) > MaxSnapshotEntities {
+		return nil, 0, fmt.Errorf("%w: %d > %d", ErrTooManyEntities, len(cur.entities), MaxSnapshotEntities)
+	}
+	e.nextSeq = cur.seq
+
+	var base *quantizedSnapshot
+	if e.hasAck {
+		base = e.history.get(e.acked)
+	}
+	e.history.put(cur)
+
+	return encodeSnapshot(cur, base, snap), cur.seq, nil
+}
+
+func encodeSnapshot(cur, base *quantizedSnapshot, snap *EntitySnapshot) []byte {
+	buf := make([]byte, 0, 16+len(cur.entities)*8)
+	buf = append(buf, snapshotMagic, snapshotVersion)
+	if base == nil {
+		buf = append(buf, snapshotFull)
+		buf = binary.AppendUvarint(buf, uint64(cur.seq))
+	} else {
+		buf = append(buf, snapshotDelta)
+		buf = binary.AppendUvarint(buf, uint64(cur.seq))
+		buf = binary.AppendUvarint(buf, uint64(base.seq))
+	}
+	buf = binary.AppendUvarint(buf, uint64(snap.Tick))
+	buf = binary.AppendUvarint(buf, uint64(snap.LastInput))
+	buf = binary.AppendVarint(buf, int64(quantize(snap.Velocity.X)))
+	buf = binary.AppendVarint(buf, int64(quantize(snap.Velocity.Y)))
+
+	// 出力を決定的にするためIDの昇順で書く
+	ids := make([]uint32, 0, len(cur.entities))
+	for id := range cur.entities {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	type change struct {
+		id   uint32
+		mask byte
+		prev quantized
+	}
+	changes := make([]change, 0, len(ids))
+	for _, id := range ids {
+		q := cur.entities[id]
+		var prev quantized
+		mask := byte(fieldAll)
+		if base != nil {
+			if p, ok := base.entities[id]; ok {
+				prev = p
+				mask = 0
+				if q.x != p.x {
+					mask |= fieldX
+				}
+				if q.y != p.y {
+					mask |= fieldY
+				}
+				if q.flags != p.flags {
+					mask |= fieldFlags
+				}
+				if mask == 0 {
+					continue
+				}
+			}
+		}
+		changes = append(changes, change{id: id, mask: mask, prev: prev})
+	}
+
+	buf = binary.AppendUvarint(buf, uint64(len(changes)))
+	for _, c := range changes {
+		q := cur.entities[c.id]
+		buf = binary.AppendUvarint(buf, uint64(c.id))
+		buf = append(buf, c.mask)
+		if c.mask&fieldX != 0 {
+			buf = binary.AppendVarint(buf, int64(q.x)-int64(c.prev.x))
+		}
+		if c.mask&fieldY != 0 {
+			buf = binary.AppendVarint(buf, int64(q.y)-int64(c.prev.y))
+		}
+		if c.mask&fieldFlags != 0 {
+			buf = append(buf, byte(q.flags))
+		}
+	}
+
+	var removed []uint32
+	if base != nil {
+		for id := range base.entities {
+			if _, ok := cur.entities[id]; !ok {
+				removed = append(removed, id)
+			}
+		}
+		sort.Slice(removed, func(i, j int) bool { return removed[i] < removed[j] })
+	}
+	buf = binary.AppendUvarint(buf, uint64(len(removed)))
+	for _, id := range removed {
+		buf = binary.AppendUvarint(buf, uint64(id))
+	}
+	return buf
+}
+
+// SnapshotDecoder 接続1本分のスナップショットのデコーダー
+type SnapshotDecoder struct {
+	history snapshotRing
+}
+
+// Decode バイト列からスナップショットを復元する
+// 差分の基準を持っていない場合は ErrUnknownBaseline を返す
+func (d *SnapshotDecoder) Decode(data []byte) (*EntitySnapshot, error) {
+	r := snapshotReader{data: data}
+
+	magic, version, kind := r.byte(), r.byte(), r.byte()
+	if r.err != nil || magic != snapshotMagic {
+		return nil, fmt.Errorf("%w: bad header", ErrMalformedSnapshot)
+	}
+	if version != snapshotVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrMalformedSnapshot, version)
+	}
+
+	seq := r.uint32()
+	var base *quantizedSnapshot
+	switch kind {
+	case snapshotFull:
+	case snapshotDelta:
+		baseSeq := r.uint32()
+		if r.err != nil {
+			return nil, r.err
+		}
+		if base = d.history.get(baseSeq); base == nil {
+			return nil, fmt.Errorf("%w: seq=%d base=%d", ErrUnknownBaseline, seq, baseSeq)
+		}
+	default:
+		return nil, fmt.Errorf("%w: unknown kind %d", ErrMalformedSnapshot, kind)
+	}
+	tick := r.uint32()
+	lastInput := r.uint32()
+	vx, vy := r.add(0), r.add(0)
+
+	cur := &quantizedSnapshot{seq: seq, entities: make(map[uint32]quantized)}
+	if base != nil {
+		for id, q := range base.entities {
+			cur.entities[id] = q
+		}
+	}
+
+	n := r.count()
+	for i := 0; i < n && r.err == nil; i++ {
+		id := r.uint32()
+		mask := r.byte()
+		if mask&^fieldAll != 0 {
+			r.fail("unknown field mask")
+			break
+		}
+		q, ok := cur.entities[id]
+		if !ok && mask != fieldAll {
+			// 初登場のエンティティは全項目そろっていないといけない
+			r.fail("partial update for new entity")
+			break
+		}
+		if mask&fieldX != 0 {
+			q.x = r.add(q.x)
+		}
+		if mask&fieldY != 0 {
+			q.y = r.add(q.y)
+		}
+		if mask&fieldFlags != 0 {
+			q.flags = EntityFlags(r.byte())
+		}
+		cur.entities[id] = q
+	}
+
+	removed := r.count()
+	for i := 0; i < removed && r.err == nil; i++ {
+		delete(cur.entities, r.uint32())
+	}
+
+	if r.err == nil && r.pos != len(r.data) {
+		r.fail("trailing bytes")
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	if len(cur.entities) > MaxSnapshotEntities {
+		return nil, fmt.Errorf("%w: too many entities", ErrMalformedSnapshot)
+	}
+
+	d.history.put(cur)
+
+	snap := &EntitySnapshot{
+		Seq:       seq,
+		Tick:      tick,
+		LastInput: lastInput,
+		Velocity:  Velocity{X: dequantize(vx), Y: dequantize(vy)},
+		Entities:  make([]EntityState, 0, len(cur.entities)),
+	}
+	for id, q := range cur.entities {
+		snap.Entities = append(snap.Entities, EntityState{
+			ID:       id,
+			Position: Position{X: dequantize(q.x), Y: dequantize(q.y)},
+			Flags:    q.flags,
+		})
+	}
+	sort.Slice(snap.Entities, func(i, j int) bool { return snap.Entities[i].ID < snap.Entities[j].ID })
+	return snap, nil
+}
+
+// IsEntitySnapshot data がバイナリスナップショットかどうか
+// リアルタイム通信ではJSONメッセージとバイナリスナップショットが同じ接続に流れるので、先頭で見分ける
+func IsEntitySnapshot(data []byte) bool {
+	return len(data) > 0 && data[0] == snapshotMagic
+}
+
+// snapshotReader 最初のエラーを覚えておき、以降の読み取りを無視するリーダー
+type snapshotReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (r *snapshotReader) fail(reason string) {
+	if r.err == nil {
+		r.err = fmt.Errorf("%w: %s at offset %d", ErrMalformedSnapshot, reason, r.pos)
+	}
+}
+
+func (r *snapshotReader) byte() byte {
+	if r.err != nil {
+		return 0
+	}
+	if r.pos >= len(r.data) {
+		r.fail("unexpected end")
+		return 0
+	}
+	b := r.data[r.pos]
+	r.pos++
+	return b
+}
+
+func (r *snapshotReader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(r.data[r.pos:])
+	if n <= 0 {
+		r.fail("bad uvarint")
+		return 0
+	}
+	r.pos += n
+	return v
+}
+
+func (r *snapshotReader) uint32() uint32 {
+	v := r.uvarint()
+	if v > math.MaxUint32 {
+		r.fail("uint32 overflow")
+		return 0
+	}
+	return uint32(v)
+}
+
+func (r *snapshotReader) count() int {
+	v := r.uvarint()
+	if v > MaxSnapshotEntities {
+		r.fail("too many entries")
+		return 0
+	}
+	return int(v)
+}
+
+// add base に差分を足す
+func (r *snapshotReader) add(base int32) int32 {
+	if r.err != nil {
+		return 0
+	}
+	d, n := binary.Varint(r.data[r.pos:])
+	if n <= 0 {
+		r.fail("bad varint")
+		return 0
+	}
+	r.pos += n
+	v := int64(base) + d
+	if v > math.MaxInt32 || v < math.MinInt32 {
+		r.fail("position overflow")
+		return 0
+	}
+	return int32(v)
+}
@@ -0,0 +1,238 @@
+package protocol
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func testEntities(n int) []EntityState {
+	entities := make([]EntityState, n)
+	for i := range entities {
+		entities[i] = EntityState{
+			ID:       uint32(i + 1),
+			Position: Position{X: float64(i*7%600) + 0.5, Y: float64(i*13%400) + 0.25},
+		}
+		if i%4 == 0 {
+			entities[i].Flags = EntityNPC
+		}
+	}
+	return entities
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	var enc SnapshotEncoder
+	var dec SnapshotDecoder
+	snap := &EntitySnapshot{
+		Tick:      10,
+		LastInput: 5,
+		Velocity:  Velocity{X: 120.5, Y: -30},
+		Entities:  testEntities(5),
+	}
+
+	data, seq, err := enc.Encode(snap)
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	if data[2] != snapshotFull {
+		t.Errorf("first snapshot kind = %d, want full", data[2])
+	}
+	got, err := dec.Decode(data)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	want := *snap
+	want.Seq = seq
+	if !reflect.DeepEqual(got, &want) {
+		t.Errorf("round trip = %+v, want %+v", got, &want)
+	}
+}
+
+func TestSnapshotQuantization(t *testing.T) {
+	var enc SnapshotEncoder
+	var dec SnapshotDecoder
+	data, _, err := enc.Encode(&EntitySnapshot{Entities: []EntityState{{ID: 1, Position: Position{X: 10.01, Y: -3.33}}}})
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	got, err := dec.Decode(data)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	pos := got.Entities[0].Position
+	if d := pos.X - 10.01; d > 0.5/PositionScale || d < -0.5/PositionScale {
+		t.Errorf("x = %v, want within 1/%d of 10.01", pos.X, 2*PositionScale)
+	}
+	if d := pos.Y + 3.33; d > 0.5/PositionScale || d < -0.5/PositionScale {
+		t.Errorf("y = %v, want within 1/%d of -3.33", pos.Y, 2*PositionScale)
+	}
+}
+
+func TestSnapshotDelta(t *testing.T) {
+	var enc SnapshotEncoder
+	var dec SnapshotDecoder
+
+	first := &EntitySnapshot{Tick: 1, Entities: testEntities(4)}
+	data, seq, err := enc.Encode(first)
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	if _, err := dec.Decode(data); err != nil {
+		t.Fatalf("Decode full: %v", err)
+	}
+	enc.Ack(seq)
+
+	// 1体は動き、1体はフラグが変わり、1体は消え、1体が新しく出てくる
+	next := &EntitySnapshot{Tick: 2, Entities: []EntityState{
+		{ID: 1, Position: Position{X: 100, Y: 100}, Flags: EntityNPC},
+		first.Entities[1],
+		{ID: 3, Position: first.Entities[2].Position, Flags: EntityDead},
+		{ID: 9, Position: Position{X: 1, Y: 2}},
+	}}
+	delta, seq, err := enc.Encode(next)
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	if delta[2] != snapshotDelta {
+		t.Fatalf("kind after ack = %d, want delta", delta[2])
+	}
+	full, _, _ := (&SnapshotEncoder{}).Encode(next)
+	if len(delta) >= len(full) {
+		t.Errorf("delta is %d bytes, full is %d bytes; want delta smaller", len(delta), len(full))
+	}
+
+	got, err := dec.Decode(delta)
+	if err != nil {
+		t.Fatalf("Decode delta: %v", err)
+	}
+	want := *next
+	want.Seq = seq
+	if !reflect.DeepEqual(got, &want) {
+		t.Errorf("delta round trip = %+v, want %+v", got, &want)
+	}
+
+	// 基準を受け取っていないデコーダーには差分を復元できない
+	if _, err := new(SnapshotDecoder).Decode(delta); !errors.Is(err, ErrUnknownBaseline) {
+		t.Errorf("delta without baseline: err = %v, want ErrUnknownBaseline", err)
+	}
+
+	// Reset したらフルスナップショットに戻る
+	enc.Reset()
+	data, _, _ = enc.Encode(next)
+	if data[2] != snapshotFull {
+		t.Errorf("kind after Reset = %d, want full", data[2])
+	}
+}
+
+func TestSnapshotTooManyEntities(t *testing.T) {
+	var enc SnapshotEncoder
+	if _, _, err := enc.Encode(&EntitySnapshot{Entities: testEntities(MaxSnapshotEntities)}); err != nil {
+		t.Fatalf("Encode with MaxSnapshotEntities entities: %v", err)
+	}
+	_, seq, err := enc.Encode(&EntitySnapshot{Entities: testEntities(MaxSnapshotEntities + 1)})
+	if !errors.Is(err, ErrTooManyEntities) {
+		t.Fatalf("Encode with too many entities: err = %v, want ErrTooManyEntities", err)
+	}
+	// 失敗したエンコードでseqを使わない
+	if _, seq, _ = enc.Encode(&EntitySnapshot{}); seq != 2 {
+		t.Errorf("seq after a failed Encode = %d, want 2", seq)
+	}
+}
+
+func TestSnapshotDecodeMalformed(t *testing.T) {
+	var enc SnapshotEncoder
+	data, _, _ := enc.Encode(&EntitySnapshot{Tick: 1, Entities: testEntities(3)})
+	for _, tt := range []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"bad magic", append([]byte{'X'}, data[1:]...)},
+		{"bad version", append([]byte{snapshotMagic, snapshotVersion + 1}, data[2:]...)},
+		{"bad kind", append([]byte{snapshotMagic, snapshotVersion, 9}, data[3:]...)},
+		{"truncated", data[:len(data)-1]},
+		{"trailing bytes", append(append([]byte(nil), data...), 0)},
+	} {
+		if _, err := new(SnapshotDecoder).Decode(tt.data); !errors.Is(err, ErrMalformedSnapshot) {
+			t.Errorf("%s: err = %v, want ErrMalformedSnapshot", tt.name, err)
+		}
+	}
+}
+
+func FuzzDecodeSnapshot(f *testing.F) {
+	var enc SnapshotEncoder
+	full, seq, _ := enc.Encode(&EntitySnapshot{Tick: 1, Entities: testEntities(3)})
+	enc.Ack(seq)
+	delta, _, _ := enc.Encode(&EntitySnapshot{Tick: 2, Entities: testEntities(4)})
+	f.Add(full)
+	f.Add(delta)
+	f.Add([]byte{snapshotMagic, snapshotVersion, snapshotFull})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		// 差分も試せるよう、基準になるフルスナップショットを先に渡しておく
+		var dec SnapshotDecoder
+		if _, err := dec.Decode(full); err != nil {
+			t.Fatalf("Decode seed: %v", err)
+		}
+		snap, err := dec.Decode(data)
+		if err != nil {
+			return
+		}
+		if len(snap.Entities) > MaxSnapshotEntities {
+			t.Errorf("decoded %d entities, more than MaxSnapshotEntities", len(snap.Entities))
+		}
+		for i := 1; i < len(snap.Entities); i++ {
+			if snap.Entities[i-1].ID >= snap.Entities[i].ID {
+				t.Fatalf("entities are not sorted by unique ID: %v", snap.Entities)
+			}
+		}
+	})
+}
+
+// benchmarkEntities ベンチマークで送る1部屋分のエンティティ数
+const benchmarkEntities = 64
+
+func BenchmarkSnapshotBinary(b *testing.B) {
+	var enc SnapshotEncoder
+	var dec SnapshotDecoder
+	snap := &EntitySnapshot{Entities: testEntities(benchmarkEntities)}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		// 毎tick受信確認が返ってくる想定で、全員が少しずつ動いた差分を送る
+		snap.Tick = uint32(i)
+		for j := range snap.Entities {
+			snap.Entities[j].Position.X += 1
+		}
+		data, seq, err := enc.Encode(snap)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := dec.Decode(data); err != nil {
+			b.Fatal(err)
+		}
+		enc.Ack(seq)
+		b.SetBytes(int64(len(data)))
+	}
+}
+
+func BenchmarkSnapshotJSON(b *testing.B) {
+	snap := &Snapshot{Players: make([]PlayerInfo, benchmarkEntities)}
+	for i, ent := range testEntities(benchmarkEntities) {
+		snap.Players[i] = PlayerInfo{ID: ent.ID, Name: "player", Position: ent.Position, NPC: ent.Flags&EntityNPC != 0}
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		snap.Tick = uint32(i)
+		for j := range snap.Players {
+			snap.Players[j].Position.X += 1
+		}
+		data, err := Encode(snap)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := Decode(data); err != nil {
+			b.Fatal(err)
+		}
+		b.SetBytes(int64(len(data)))
+	}
+}
@@ -0,0 +1,8 @@
+//go:build tools
+
+// Package tools は go generate で使うコマンドのバージョンを go.mod で固定するためのもの
+package tools
+
+import (
+	_ "github.com/oapi-codegen/oapi-codegen/v2/cmd/oapi-codegen"
+)